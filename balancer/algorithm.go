@@ -0,0 +1,211 @@
+package balancer
+
+import (
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancing algorithm names.
+const (
+	RoundRobin         = "round-robin"
+	WeightedRoundRobin = "weighted-round-robin"
+	LeastConnections   = "least-connections"
+	RandomTwoChoices   = "random-two-choices"
+	IPHash             = "ip-hash"
+)
+
+// Picker represents the balancing algorithm interface,
+// who picks the upstream server to forward the given request.
+// Pickers are called concurrently and must return nil if there is no available upstream.
+type Picker interface {
+	Pick(req *http.Request, upstreams []*Upstream) *Upstream
+}
+
+// PickerUpdater is implemented by the pickers who precompute their state
+// from the balanced upstream servers, such as the consistent hashing ring.
+// Update is called with every upstream, regardless of its availability,
+// when the balancer is created and every time its upstreams change.
+type PickerUpdater interface {
+	Update(upstreams []*Upstream)
+}
+
+// PickerFunc represents the function interface for pickers.
+type PickerFunc func(req *http.Request, upstreams []*Upstream) *Upstream
+
+// Pick calls f(req, upstreams).
+func (f PickerFunc) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	return f(req, upstreams)
+}
+
+// Algorithms stores the available balancing algorithms by name.
+var Algorithms = map[string]func() Picker{
+	RoundRobin:         NewRoundRobin,
+	WeightedRoundRobin: NewWeightedRoundRobin,
+	LeastConnections:   NewLeastConnections,
+	RandomTwoChoices:   NewRandomTwoChoices,
+	IPHash:             NewIPHash,
+	ConsistentHash:     func() Picker { return NewConsistentHash(ClientIPKey) },
+}
+
+// NewPicker creates a new picker of the given balancing algorithm name.
+func NewPicker(name string) (Picker, error) {
+	factory, ok := Algorithms[name]
+	if !ok {
+		return nil, errors.New("balancer: unsupported algorithm: " + name)
+	}
+	return factory(), nil
+}
+
+// roundRobin picks the upstreams in turns, ignoring the weights.
+type roundRobin struct {
+	next uint64
+}
+
+// NewRoundRobin creates a new round robin picker.
+func NewRoundRobin() Picker {
+	return &roundRobin{}
+}
+
+func (r *roundRobin) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	n := atomic.AddUint64(&r.next, 1) - 1
+	return upstreams[n%uint64(len(upstreams))]
+}
+
+// weightedRoundRobin implements the smooth weighted round robin algorithm,
+// interleaving the upstreams proportionally to their weights.
+type weightedRoundRobin struct {
+	sync.Mutex
+	current map[*Upstream]int
+}
+
+// NewWeightedRoundRobin creates a new smooth weighted round robin picker.
+func NewWeightedRoundRobin() Picker {
+	return &weightedRoundRobin{current: make(map[*Upstream]int)}
+}
+
+func (r *weightedRoundRobin) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	r.Lock()
+	defer r.Unlock()
+
+	var best *Upstream
+	total := 0
+	for _, u := range upstreams {
+		total += u.Weight
+		r.current[u] += u.Weight
+		if best == nil || r.current[u] > r.current[best] {
+			best = u
+		}
+	}
+	if best != nil {
+		r.current[best] -= total
+	}
+
+	// Forget the state of removed upstreams
+	if len(r.current) > len(upstreams) {
+		r.current = make(map[*Upstream]int)
+	}
+	return best
+}
+
+// leastConnections picks the upstream with the fewest active requests relative to its weight.
+type leastConnections struct {
+	next uint64
+}
+
+// NewLeastConnections creates a new weighted least connections picker.
+// Ties are broken in turns.
+func NewLeastConnections() Picker {
+	return &leastConnections{}
+}
+
+func (l *leastConnections) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	offset := int(atomic.AddUint64(&l.next, 1) % uint64(len(upstreams)))
+	var best *Upstream
+	for i := range upstreams {
+		u := upstreams[(offset+i)%len(upstreams)]
+		if best == nil || lessLoaded(u, best) {
+			best = u
+		}
+	}
+	return best
+}
+
+// randomTwoChoices picks two random upstreams and chooses the less loaded one.
+type randomTwoChoices struct {
+	sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRandomTwoChoices creates a new power of two random choices picker.
+func NewRandomTwoChoices() Picker {
+	return &randomTwoChoices{rand: rand.New(rand.NewSource(rand.Int63()))}
+}
+
+func (r *randomTwoChoices) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	if len(upstreams) < 2 {
+		if len(upstreams) == 0 {
+			return nil
+		}
+		return upstreams[0]
+	}
+
+	r.Lock()
+	i := r.rand.Intn(len(upstreams))
+	j := r.rand.Intn(len(upstreams) - 1)
+	r.Unlock()
+	if j >= i {
+		j++
+	}
+
+	if lessLoaded(upstreams[j], upstreams[i]) {
+		return upstreams[j]
+	}
+	return upstreams[i]
+}
+
+// ipHash picks the upstream based on the client IP hash,
+// so the same client is always forwarded to the same upstream.
+type ipHash struct{}
+
+// NewIPHash creates a new weighted client IP hash picker.
+func NewIPHash() Picker {
+	return ipHash{}
+}
+
+func (ipHash) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	total := 0
+	for _, u := range upstreams {
+		total += u.Weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(ClientIPKey(req)))
+
+	slot := int(hash.Sum32() % uint32(total))
+	for _, u := range upstreams {
+		if slot < u.Weight {
+			return u
+		}
+		slot -= u.Weight
+	}
+	return upstreams[len(upstreams)-1]
+}
+
+// lessLoaded checks if the upstream a has fewer active requests than b relative to their weights.
+func lessLoaded(a, b *Upstream) bool {
+	return a.Active()*int64(b.Weight) < b.Active()*int64(a.Weight)
+}
@@ -0,0 +1,96 @@
+package balancer
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func newUpstreams(weights ...int) []*Upstream {
+	upstreams := []*Upstream{}
+	for i, weight := range weights {
+		upstreams = append(upstreams, &Upstream{URL: string(rune('a' + i)), Weight: weight})
+	}
+	return upstreams
+}
+
+// pickURLs picks n upstreams returning the picked URLs.
+func pickURLs(p Picker, upstreams []*Upstream, n int) string {
+	picked := ""
+	for i := 0; i < n; i++ {
+		picked += p.Pick(httptest.NewRequest("GET", "/", nil), upstreams).URL
+	}
+	return picked
+}
+
+func TestRoundRobin(t *testing.T) {
+	st.Expect(t, pickURLs(NewRoundRobin(), newUpstreams(3, 1, 1), 6), "abcabc")
+	st.Expect(t, NewRoundRobin().Pick(nil, nil), (*Upstream)(nil))
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	// Smooth weighted round robin interleaves the heavier upstream
+	st.Expect(t, pickURLs(NewWeightedRoundRobin(), newUpstreams(5, 1, 1), 7), "aabacaa")
+	st.Expect(t, pickURLs(NewWeightedRoundRobin(), newUpstreams(1, 1), 4), "abab")
+	st.Expect(t, NewWeightedRoundRobin().Pick(nil, nil), (*Upstream)(nil))
+}
+
+func TestLeastConnections(t *testing.T) {
+	upstreams := newUpstreams(1, 1, 2)
+	upstreams[0].active = 1
+	upstreams[1].active = 0
+	upstreams[2].active = 1
+	st.Expect(t, pickURLs(NewLeastConnections(), upstreams, 3), "bbb")
+
+	// The weight is taken into account
+	upstreams[1].active = 2
+	st.Expect(t, pickURLs(NewLeastConnections(), upstreams, 3), "ccc")
+
+	// Ties are broken in turns
+	upstreams = newUpstreams(1, 1)
+	st.Expect(t, pickURLs(NewLeastConnections(), upstreams, 4), "baba")
+	st.Expect(t, NewLeastConnections().Pick(nil, nil), (*Upstream)(nil))
+}
+
+func TestRandomTwoChoices(t *testing.T) {
+	upstreams := newUpstreams(1, 1)
+	upstreams[0].active = 5
+	st.Expect(t, pickURLs(NewRandomTwoChoices(), upstreams, 5), "bbbbb")
+	st.Expect(t, pickURLs(NewRandomTwoChoices(), upstreams[:1], 2), "aa")
+	st.Expect(t, NewRandomTwoChoices().Pick(nil, nil), (*Upstream)(nil))
+
+	// Every upstream is picked
+	picked := map[string]bool{}
+	for _, u := range pickURLs(NewRandomTwoChoices(), newUpstreams(1, 1, 1), 100) {
+		picked[string(u)] = true
+	}
+	st.Expect(t, len(picked), 3)
+}
+
+func TestIPHash(t *testing.T) {
+	upstreams := newUpstreams(1, 1, 1)
+	picker := NewIPHash()
+
+	picked := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "10.0.0." + string(rune('0'+i%10)) + ":1234"
+		first := picker.Pick(req, upstreams)
+		req.RemoteAddr = "10.0.0." + string(rune('0'+i%10)) + ":5678"
+		st.Expect(t, picker.Pick(req, upstreams), first)
+		picked[first.URL] = true
+	}
+	st.Expect(t, len(picked) > 1, true)
+	st.Expect(t, picker.Pick(httptest.NewRequest("GET", "/", nil), nil), (*Upstream)(nil))
+}
+
+func TestNewPicker(t *testing.T) {
+	for name := range Algorithms {
+		p, err := NewPicker(name)
+		st.Expect(t, err, nil)
+		st.Reject(t, p, nil)
+	}
+	_, err := NewPicker("foo")
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,412 @@
+// Package balancer implements an HTTP and websocket load balancer who forwards
+// the incoming traffic to multiple upstream servers using pluggable algorithms.
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// ErrNoUpstream is used when there is no upstream server available to forward the request.
+var ErrNoUpstream = utils.ErrUnavailable
+
+// Upstream represents an upstream server who receives the balanced traffic.
+type Upstream struct {
+	// URL stores the upstream server URL, using any target syntax supported by forward.Target.
+	URL string `json:"url"`
+	// Weight stores the relative upstream weight used by weight aware algorithms.
+	// Defaults to 1.
+	Weight int `json:"weight,omitempty"`
+
+	active    int64
+	handler   http.Handler
+	transport http.RoundTripper
+	health    healthState
+	circuit   *circuit
+	breaker   *Breaker
+}
+
+// Active returns the number of requests currently forwarded to the upstream.
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+// OptSetter represents the balancer setter function.
+type OptSetter func(b *Balancer) error
+
+// Algorithm defines the balancing algorithm by its registered name, such as RoundRobin.
+func Algorithm(name string) OptSetter {
+	return func(b *Balancer) error {
+		picker, err := NewPicker(name)
+		if err != nil {
+			return err
+		}
+		b.picker = picker
+		return nil
+	}
+}
+
+// Custom defines a custom balancing algorithm.
+func Custom(p Picker) OptSetter {
+	return func(b *Balancer) error {
+		b.picker = p
+		return nil
+	}
+}
+
+// Forward defines the forwarder options used with every upstream server,
+// such as forward.StripPrefix or forward.Timeout.
+func Forward(opts ...forward.OptSetter) OptSetter {
+	return func(b *Balancer) error {
+		b.forward = append(b.forward, opts...)
+		return nil
+	}
+}
+
+// ErrorHandler is a function who handles the balancer errors.
+func ErrorHandler(h utils.ErrorHandler) OptSetter {
+	return func(b *Balancer) error {
+		b.errHandler = h
+		return nil
+	}
+}
+
+// Logger specifies the logger to use.
+func Logger(l utils.Logger) OptSetter {
+	return func(b *Balancer) error {
+		b.log = l
+		return nil
+	}
+}
+
+// Balancer forwards the incoming traffic to the upstream
+// server picked by the balancing algorithm.
+type Balancer struct {
+	sync.RWMutex
+	id         string
+	upstreams  []*Upstream
+	health     *HealthCheck
+	breaker    *Breaker
+	affinity   *Affinity
+	hedge      *Hedge
+	hedges     HedgeStats
+	budget     hedgeBudget
+	stop       chan struct{}
+	onClose    []func()
+	picker     Picker
+	forward    []forward.OptSetter
+	trusted    []*net.IPNet
+	errHandler utils.ErrorHandler
+	log        utils.Logger
+}
+
+// New creates a new load balancer for the given upstream servers.
+// Weighted round robin is used by default.
+func New(upstreams []Upstream, setters ...OptSetter) (*Balancer, error) {
+	b := &Balancer{id: utils.NewID()}
+	for _, s := range setters {
+		if err := s(b); err != nil {
+			return nil, err
+		}
+	}
+	if b.picker == nil {
+		b.picker = NewWeightedRoundRobin()
+	}
+	if b.log == nil {
+		b.log = utils.NullLogger
+	}
+	if b.errHandler == nil {
+		b.errHandler = utils.DefaultHandler
+	}
+	if len(upstreams) == 0 {
+		return nil, errors.New("balancer: at least one upstream is required")
+	}
+
+	for _, upstream := range upstreams {
+		u, err := b.newUpstream(upstream)
+		if err != nil {
+			return nil, err
+		}
+		b.upstreams = append(b.upstreams, u)
+	}
+	b.trusted = b.upstreams[0].handler.(*forward.Forwarder).TrustedProxies()
+	b.updatePicker()
+
+	if b.health != nil {
+		b.stop = make(chan struct{})
+		go b.checkHealth(b.stop)
+	}
+	register(b)
+	return b, nil
+}
+
+// ID returns the balancer unique identifier.
+func (b *Balancer) ID() string {
+	return b.id
+}
+
+// Close stops the upstream health checks and unregisters the balancer.
+func (b *Balancer) Close() error {
+	b.Lock()
+	if b.stop != nil {
+		close(b.stop)
+		b.stop = nil
+	}
+	onClose := b.onClose
+	b.onClose = nil
+	b.Unlock()
+
+	unregister(b)
+	for _, fn := range onClose {
+		fn()
+	}
+	return nil
+}
+
+// OnClose registers a function called once the balancer is closed.
+func (b *Balancer) OnClose(fn func()) {
+	b.Lock()
+	defer b.Unlock()
+	b.onClose = append(b.onClose, fn)
+}
+
+// Must returns the given balancer, panicking if err is not nil.
+// Useful to define balancers as final handlers, who are closed once replaced.
+func Must(b *Balancer, err error) *Balancer {
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// To returns an http.HandlerFunc who balances the incoming traffic
+// across the given upstream servers.
+// The balancer is never closed, use New to control its lifetime.
+func To(upstreams []Upstream, setters ...OptSetter) func(w http.ResponseWriter, r *http.Request) {
+	b, err := New(upstreams, setters...)
+	if err != nil {
+		panic(err)
+	}
+	return b.ServeHTTP
+}
+
+// newUpstream creates the upstream and its forwarder based on the given upstream definition.
+func (b *Balancer) newUpstream(upstream Upstream) (*Upstream, error) {
+	if upstream.Weight < 0 {
+		return nil, fmt.Errorf("balancer: upstream weight cannot be negative: %s", upstream.URL)
+	}
+	if upstream.Weight == 0 {
+		upstream.Weight = 1
+	}
+
+	u := &Upstream{URL: upstream.URL, Weight: upstream.Weight}
+	opts := append([]forward.OptSetter{forward.Target(upstream.URL), forward.Logger(b.log)}, b.forward...)
+	if b.breaker != nil {
+		u.circuit = &circuit{}
+		u.breaker = b.breaker
+		opts = append(opts, forward.Observe(outcomeObserver{}))
+	}
+
+	fwd, err := forward.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	u.handler = fwd
+	u.transport = fwd.RoundTripper()
+	return u, nil
+}
+
+// Update replaces the balanced upstream servers, such as on service discovery changes.
+// The state of the unchanged upstreams, such as their health, is preserved.
+// Requests fail with ErrNoUpstream while there are no upstreams.
+func (b *Balancer) Update(upstreams []Upstream) error {
+	current := make(map[string]*Upstream)
+	for _, u := range b.Upstreams() {
+		current[u.URL] = u
+	}
+
+	list := []*Upstream{}
+	for _, upstream := range upstreams {
+		if u, ok := current[upstream.URL]; ok && (u.Weight == upstream.Weight || upstream.Weight == 0 && u.Weight == 1) {
+			list = append(list, u)
+			continue
+		}
+		u, err := b.newUpstream(upstream)
+		if err != nil {
+			return err
+		}
+		list = append(list, u)
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.upstreams = list
+	b.updatePicker()
+	return nil
+}
+
+// updatePicker updates the picker with the balanced upstreams, if it implements PickerUpdater.
+func (b *Balancer) updatePicker() {
+	if p, ok := b.picker.(PickerUpdater); ok {
+		p.Update(b.upstreams)
+	}
+}
+
+// Upstreams returns the balanced upstream servers.
+func (b *Balancer) Upstreams() []*Upstream {
+	b.RLock()
+	defer b.RUnlock()
+	return append([]*Upstream{}, b.upstreams...)
+}
+
+// Available returns the upstream servers who can receive traffic.
+func (b *Balancer) Available() []*Upstream {
+	available := []*Upstream{}
+	for _, u := range b.Upstreams() {
+		if u.Healthy() && u.available() {
+			available = append(available, u)
+		}
+	}
+	return available
+}
+
+// ServeHTTP forwards the request to the available upstream picked by the balancing algorithm.
+func (b *Balancer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if len(b.trusted) > 0 {
+		req = req.WithContext(context.WithValue(req.Context(), trustedProxiesKey{}, b.trusted))
+	}
+	upstream := b.pick(req)
+	if upstream == nil {
+		err := b.circuitError()
+		b.log.Errorf("No upstream available for %v %v: %v", req.Method, req.URL, err)
+		b.errHandler.ServeHTTP(w, req, err)
+		return
+	}
+
+	if b.hedgeable(req) {
+		b.serveHedged(w, req, upstream)
+		return
+	}
+	b.serve(w, req, upstream)
+}
+
+// serve forwards the request to the given upstream if its circuit allows it,
+// otherwise another available upstream is picked, such as when a concurrent
+// request takes the last half-open trial of the upstream.
+func (b *Balancer) serve(w http.ResponseWriter, req *http.Request, upstream *Upstream) {
+	tried := []*Upstream{}
+	for {
+		if ok, trial := upstream.acquire(); ok {
+			b.forwardTo(w, req, upstream, trial)
+			return
+		}
+		tried = append(tried, upstream)
+		if upstream = b.pick(req, tried...); upstream == nil {
+			err := b.circuitError()
+			b.log.Errorf("No upstream available for %v %v: %v", req.Method, req.URL, err)
+			b.errHandler.ServeHTTP(w, req, err)
+			return
+		}
+	}
+}
+
+// forwardTo forwards the request to the given acquired upstream,
+// reporting the request outcome to the upstream circuit.
+func (b *Balancer) forwardTo(w http.ResponseWriter, req *http.Request, upstream *Upstream, trial bool) {
+	if b.affinity != nil {
+		b.affinity.issue(w, req, upstream)
+	}
+	if upstream.circuit != nil {
+		var o *outcome
+		req, o = withOutcome(req)
+		defer func() {
+			if o.canceled {
+				upstream.release(trial)
+				return
+			}
+			if upstream.report(trial, o.err) {
+				b.logCircuit(upstream)
+			}
+		}()
+	}
+
+	atomic.AddInt64(&upstream.active, 1)
+	defer atomic.AddInt64(&upstream.active, -1)
+	upstream.handler.ServeHTTP(w, req)
+}
+
+// pick picks the available upstream to forward the given request, except
+// the given excluded upstreams, honoring the affinity cookie if enabled.
+func (b *Balancer) pick(req *http.Request, exclude ...*Upstream) *Upstream {
+	available := b.Available()
+	if len(exclude) > 0 {
+		available = without(available, exclude)
+	}
+	if b.affinity != nil {
+		if upstream := b.affinity.sticky(req, available); upstream != nil {
+			return upstream
+		}
+	}
+	return b.picker.Pick(req, available)
+}
+
+// without returns the given upstreams except the excluded ones.
+func without(upstreams, exclude []*Upstream) []*Upstream {
+	list := []*Upstream{}
+	for _, u := range upstreams {
+		excluded := false
+		for _, e := range exclude {
+			excluded = excluded || u == e
+		}
+		if !excluded {
+			list = append(list, u)
+		}
+	}
+	return list
+}
+
+// logCircuit logs the upstream circuit state change.
+func (b *Balancer) logCircuit(u *Upstream) {
+	if state := u.Circuit(); state == CircuitOpen {
+		b.log.Errorf("Upstream %v circuit is open: %v", u.URL, u.CircuitError())
+	} else {
+		b.log.Infof("Upstream %v circuit is %v", u.URL, state)
+	}
+}
+
+// ParseUpstreams parses a comma separated list of upstream servers
+// with optional weights, such as "http://10.0.0.1:8080 weight=3, http://10.0.0.2:8080".
+func ParseUpstreams(list string) ([]Upstream, error) {
+	upstreams := []Upstream{}
+	for _, entry := range strings.Split(list, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+
+		upstream := Upstream{URL: fields[0]}
+		for _, field := range fields[1:] {
+			value := strings.TrimPrefix(field, "weight=")
+			weight, err := strconv.Atoi(value)
+			if value == field || err != nil || weight < 1 {
+				return nil, fmt.Errorf("balancer: invalid upstream param: %s", field)
+			}
+			upstream.Weight = weight
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	if len(upstreams) == 0 {
+		return nil, errors.New("balancer: at least one upstream is required")
+	}
+	return upstreams, nil
+}
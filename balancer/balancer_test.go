@@ -0,0 +1,151 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+// newUpstreamServer creates a test upstream server who replies with the given name.
+func newUpstreamServer(name string) *httptest.Server {
+	return testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestBalancer(t *testing.T) {
+	a, b := newUpstreamServer("a"), newUpstreamServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	proxy := testutils.NewHandler(To([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin)))
+	defer proxy.Close()
+
+	bodies := []string{}
+	for i := 0; i < 4; i++ {
+		res, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, res.StatusCode, http.StatusOK)
+		bodies = append(bodies, string(body))
+	}
+	st.Expect(t, bodies, []string{"a", "b", "a", "b"})
+}
+
+func TestBalancerForwardOptions(t *testing.T) {
+	var path string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To([]Upstream{{URL: srv.URL}}, Forward(forward.StripPrefix("/api"))))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL + "/api/users")
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, path, "/users")
+}
+
+func TestBalancerNoUpstream(t *testing.T) {
+	none := PickerFunc(func(req *http.Request, upstreams []*Upstream) *Upstream {
+		return nil
+	})
+	b, err := New([]Upstream{{URL: "http://localhost"}}, Custom(none))
+	st.Expect(t, err, nil)
+
+	w := httptest.NewRecorder()
+	b.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusServiceUnavailable)
+}
+
+func TestBalancerActiveRequests(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	release := make(chan struct{})
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		wg.Done()
+		<-release
+	})
+	defer srv.Close()
+
+	b, err := New([]Upstream{{URL: srv.URL, Weight: 2}})
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(b)
+	defer proxy.Close()
+
+	done := make(chan struct{})
+	go func() {
+		testutils.Get(proxy.URL)
+		close(done)
+	}()
+
+	wg.Wait()
+	upstream := b.Upstreams()[0]
+	st.Expect(t, upstream.Active(), int64(1))
+	st.Expect(t, upstream.Weight, 2)
+
+	close(release)
+	<-done
+	st.Expect(t, upstream.Active(), int64(0))
+}
+
+func TestBalancerInvalid(t *testing.T) {
+	_, err := New(nil)
+	st.Reject(t, err, nil)
+
+	_, err = New([]Upstream{{URL: "http://localhost", Weight: -1}})
+	st.Reject(t, err, nil)
+
+	_, err = New([]Upstream{{URL: "http://localhost"}}, Algorithm("foo"))
+	st.Reject(t, err, nil)
+
+	_, err = New([]Upstream{{URL: "unix://"}})
+	st.Reject(t, err, nil)
+}
+
+func TestParseUpstreams(t *testing.T) {
+	upstreams, err := ParseUpstreams("http://10.0.0.1:8080 weight=3, http://10.0.0.2:8080,")
+	st.Expect(t, err, nil)
+	st.Expect(t, upstreams, []Upstream{{URL: "http://10.0.0.1:8080", Weight: 3}, {URL: "http://10.0.0.2:8080"}})
+
+	_, err = ParseUpstreams("http://10.0.0.1:8080 weight=0")
+	st.Reject(t, err, nil)
+
+	_, err = ParseUpstreams("http://10.0.0.1:8080 foo")
+	st.Reject(t, err, nil)
+
+	_, err = ParseUpstreams(" , ")
+	st.Reject(t, err, nil)
+}
+
+func TestBalancerUpdate(t *testing.T) {
+	a, b := newUpstreamServer("a"), newUpstreamServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL, Weight: 2}})
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	previous := lb.Upstreams()
+
+	st.Expect(t, lb.Update([]Upstream{{URL: b.URL, Weight: 2}}), nil)
+	st.Expect(t, lb.Upstreams(), []*Upstream{previous[1]})
+
+	st.Expect(t, lb.Update([]Upstream{{URL: a.URL, Weight: 3}, {URL: b.URL, Weight: 2}}), nil)
+	upstreams := lb.Upstreams()
+	st.Expect(t, upstreams[0].Weight, 3)
+	st.Expect(t, upstreams[1], previous[1])
+
+	st.Reject(t, lb.Update([]Upstream{{URL: a.URL, Weight: -1}}), nil)
+
+	st.Expect(t, lb.Update(nil), nil)
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusServiceUnavailable)
+}
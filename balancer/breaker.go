@@ -0,0 +1,281 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// ErrCircuitOpen is used when the circuit breaker of every healthy upstream is open.
+// It wraps utils.ErrUnavailable, so it is replied with a 503 Service Unavailable.
+var ErrCircuitOpen = fmt.Errorf("circuit breaker is open: %w", utils.ErrUnavailable)
+
+var (
+	// DefaultBreakerFailures stores the default number of consecutive
+	// failures required to open the upstream circuit.
+	DefaultBreakerFailures = 5
+
+	// DefaultBreakerOpenTimeout stores the default time an upstream
+	// circuit stays open before allowing trial requests.
+	DefaultBreakerOpenTimeout = 30 * time.Second
+
+	// DefaultBreakerHalfOpenRequests stores the default number of
+	// successful trial requests required to close the upstream circuit.
+	DefaultBreakerHalfOpenRequests = 1
+)
+
+// CircuitState represents the upstream circuit breaker state.
+type CircuitState int
+
+const (
+	// CircuitClosed is used when the upstream receives traffic normally.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen is used when the upstream is ejected after consecutive failures.
+	CircuitOpen
+	// CircuitHalfOpen is used when the upstream receives a limited
+	// number of trial requests to decide if the circuit can be closed.
+	CircuitHalfOpen
+)
+
+// String returns the circuit state name.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker defines the passive outlier detection of the upstream servers.
+// Upstream connection errors and 5xx responses are considered failures.
+// Zero values are replaced by the defaults.
+type Breaker struct {
+	// Failures stores the consecutive failures required to open the circuit.
+	Failures int
+	// OpenTimeout stores the time the circuit stays open before allowing trial requests.
+	OpenTimeout time.Duration
+	// HalfOpenRequests stores the concurrent trial requests allowed while the circuit
+	// is half-open, who must succeed to close the circuit again.
+	HalfOpenRequests int
+}
+
+// CircuitBreaker enables the per upstream circuit breaker, ejecting the upstream
+// servers who fail consecutively until the circuit is closed again.
+// If every healthy upstream is ejected, requests fail fast with ErrCircuitOpen.
+func CircuitBreaker(breaker Breaker) OptSetter {
+	return func(b *Balancer) error {
+		if breaker.Failures < 0 || breaker.OpenTimeout < 0 || breaker.HalfOpenRequests < 0 {
+			return errors.New("balancer: circuit breaker options cannot be negative")
+		}
+		if breaker.Failures == 0 {
+			breaker.Failures = DefaultBreakerFailures
+		}
+		if breaker.OpenTimeout == 0 {
+			breaker.OpenTimeout = DefaultBreakerOpenTimeout
+		}
+		if breaker.HalfOpenRequests == 0 {
+			breaker.HalfOpenRequests = DefaultBreakerHalfOpenRequests
+		}
+		b.breaker = &breaker
+		return nil
+	}
+}
+
+// circuit stores the upstream circuit breaker state.
+type circuit struct {
+	sync.Mutex
+	state CircuitState
+	// failures stores the consecutive failures while closed.
+	failures int
+	// successes and trials store the successful and in-flight trial requests while half-open.
+	successes, trials int
+	openedAt          time.Time
+	lastError         error
+}
+
+// Circuit returns the upstream circuit breaker state.
+// Upstreams are always closed if the circuit breaker is not enabled.
+func (u *Upstream) Circuit() CircuitState {
+	if u.circuit == nil {
+		return CircuitClosed
+	}
+	u.circuit.Lock()
+	defer u.circuit.Unlock()
+	return u.circuit.current(u.breaker)
+}
+
+// CircuitError returns the failure who opened the upstream circuit, if any.
+func (u *Upstream) CircuitError() error {
+	if u.circuit == nil {
+		return nil
+	}
+	u.circuit.Lock()
+	defer u.circuit.Unlock()
+	if u.circuit.state == CircuitClosed {
+		return nil
+	}
+	return u.circuit.lastError
+}
+
+// available returns true if the upstream circuit allows new requests.
+func (u *Upstream) available() bool {
+	if u.circuit == nil {
+		return true
+	}
+	u.circuit.Lock()
+	defer u.circuit.Unlock()
+	switch u.circuit.current(u.breaker) {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		return u.circuit.trials < u.breaker.HalfOpenRequests
+	}
+	return true
+}
+
+// acquire reserves a request to the upstream, returning false if the circuit
+// does not allow it and true as trial if the circuit is half-open.
+func (u *Upstream) acquire() (ok, trial bool) {
+	if u.circuit == nil {
+		return true, false
+	}
+	u.circuit.Lock()
+	defer u.circuit.Unlock()
+	switch u.circuit.current(u.breaker) {
+	case CircuitOpen:
+		return false, false
+	case CircuitHalfOpen:
+		if u.circuit.trials >= u.breaker.HalfOpenRequests {
+			return false, false
+		}
+		u.circuit.trials++
+		return true, true
+	}
+	return true, false
+}
+
+// release releases the upstream request reserved by acquire without
+// updating the circuit, used if the request has no outcome.
+func (u *Upstream) release(trial bool) {
+	if !trial {
+		return
+	}
+	u.circuit.Lock()
+	defer u.circuit.Unlock()
+	u.circuit.trials--
+}
+
+// report updates the upstream circuit based on the given request failure, if any,
+// returning true if the circuit state has changed.
+func (u *Upstream) report(trial bool, err error) bool {
+	c := u.circuit
+	c.Lock()
+	defer c.Unlock()
+
+	if trial {
+		c.trials--
+		if c.state != CircuitHalfOpen {
+			return false
+		}
+		if err != nil {
+			c.open(err)
+			return true
+		}
+		c.successes++
+		if c.successes >= u.breaker.HalfOpenRequests {
+			c.state = CircuitClosed
+			c.failures = 0
+			return true
+		}
+		return false
+	}
+
+	if c.state != CircuitClosed {
+		return false
+	}
+	if err == nil {
+		c.failures = 0
+		return false
+	}
+	c.failures++
+	if c.failures >= u.breaker.Failures {
+		c.open(err)
+		return true
+	}
+	return false
+}
+
+// current returns the circuit state, moving open circuits
+// to half-open once the open timeout expires.
+func (c *circuit) current(breaker *Breaker) CircuitState {
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= breaker.OpenTimeout {
+		c.state = CircuitHalfOpen
+		c.successes = 0
+	}
+	return c.state
+}
+
+// open opens the circuit due to the given failure.
+func (c *circuit) open(err error) {
+	c.state = CircuitOpen
+	c.openedAt = time.Now()
+	c.lastError = err
+	c.failures = 0
+}
+
+// circuitError returns ErrCircuitOpen if a healthy upstream
+// is not available due to its circuit, otherwise ErrNoUpstream.
+func (b *Balancer) circuitError() error {
+	for _, u := range b.Upstreams() {
+		if u.Healthy() && !u.available() {
+			return ErrCircuitOpen
+		}
+	}
+	return ErrNoUpstream
+}
+
+// outcomeKey is the request context key used to store the forwarding outcome.
+type outcomeKey struct{}
+
+// outcome stores the failure of a forwarded request, if any.
+// Requests canceled by the client, or by the winner of a hedged request,
+// have no outcome, since they do not tell anything about the upstream.
+type outcome struct {
+	err      error
+	canceled bool
+}
+
+// withOutcome returns a shallow copy of the given request who collects the forwarding outcome.
+func withOutcome(req *http.Request) (*http.Request, *outcome) {
+	o := &outcome{}
+	return req.WithContext(context.WithValue(req.Context(), outcomeKey{}, o)), o
+}
+
+// outcomeObserver records the upstream round trip failures in the request outcome.
+type outcomeObserver struct {
+	forward.BaseObserver
+}
+
+// OnDone implements the forward.Observer interface.
+func (outcomeObserver) OnDone(e *forward.DoneEvent) {
+	o, ok := e.Request.Context().Value(outcomeKey{}).(*outcome)
+	if !ok {
+		return
+	}
+	switch {
+	case errors.Is(e.Err, context.Canceled) || errors.Is(e.Request.Context().Err(), context.Canceled):
+		o.canceled = true
+	case e.Err != nil:
+		o.err = e.Err
+	case e.StatusCode >= 500:
+		o.err = fmt.Errorf("upstream response status: %d", e.StatusCode)
+	}
+}
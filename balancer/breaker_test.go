@@ -0,0 +1,191 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+func TestCircuitBreakerEjectsUpstream(t *testing.T) {
+	var failing int32 = 1
+	a := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("a"))
+	})
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	breaker := Breaker{Failures: 2, OpenTimeout: 50 * time.Millisecond}
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), CircuitBreaker(breaker))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	proxy := httptest.NewServer(lb)
+	defer proxy.Close()
+
+	codes := []int{}
+	for i := 0; i < 4; i++ {
+		res, _, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		codes = append(codes, res.StatusCode)
+	}
+	st.Expect(t, codes, []int{500, 200, 500, 200})
+
+	upstream := lb.Upstreams()[0]
+	st.Expect(t, upstream.Circuit(), CircuitOpen)
+	st.Expect(t, upstream.CircuitError().Error(), "upstream response status: 500")
+	for i := 0; i < 3; i++ {
+		_, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, string(body), "b")
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(breaker.OpenTimeout)
+	st.Expect(t, upstream.Circuit(), CircuitHalfOpen)
+
+	bodies := ""
+	for i := 0; i < 4; i++ {
+		_, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		bodies += string(body)
+	}
+	st.Expect(t, upstream.Circuit(), CircuitClosed)
+	st.Expect(t, upstream.CircuitError(), nil)
+	st.Expect(t, strings.Count(bodies, "a"), 2)
+}
+
+func TestCircuitBreakerFailFast(t *testing.T) {
+	srv := newUpstreamServer("a")
+	srv.Close()
+
+	breaker := Breaker{Failures: 1, OpenTimeout: 50 * time.Millisecond}
+	lb, err := New([]Upstream{{URL: srv.URL}}, CircuitBreaker(breaker))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusBadGateway)
+	st.Expect(t, lb.Upstreams()[0].Circuit(), CircuitOpen)
+
+	var handled error
+	lb.errHandler = utils.ErrorHandlerFunc(func(w http.ResponseWriter, req *http.Request, err error) {
+		handled = err
+		utils.DefaultHandler.ServeHTTP(w, req, err)
+	})
+	w = httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusServiceUnavailable)
+	st.Expect(t, handled, ErrCircuitOpen)
+	st.Expect(t, errors.Is(handled, utils.ErrUnavailable), true)
+
+	// The failed trial request opens the circuit again
+	time.Sleep(breaker.OpenTimeout)
+	w = httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusBadGateway)
+	st.Expect(t, lb.Upstreams()[0].Circuit(), CircuitOpen)
+}
+
+func TestCircuitHalfOpenTrials(t *testing.T) {
+	u := &Upstream{circuit: &circuit{}, breaker: &Breaker{Failures: 1, OpenTimeout: time.Millisecond, HalfOpenRequests: 2}}
+	st.Expect(t, u.report(false, errors.New("failure")), true)
+	st.Expect(t, u.available(), false)
+
+	time.Sleep(u.breaker.OpenTimeout)
+	ok, trial := u.acquire()
+	st.Expect(t, ok && trial, true)
+	ok, trial = u.acquire()
+	st.Expect(t, ok && trial, true)
+	ok, _ = u.acquire()
+	st.Expect(t, ok, false)
+	st.Expect(t, u.available(), false)
+
+	st.Expect(t, u.report(true, nil), false)
+	st.Expect(t, u.Circuit(), CircuitHalfOpen)
+	st.Expect(t, u.report(true, nil), true)
+	st.Expect(t, u.Circuit(), CircuitClosed)
+	st.Expect(t, u.available(), true)
+}
+
+func TestCircuitBreakerCanceledTrial(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	})
+	defer srv.Close()
+
+	breaker := Breaker{Failures: 1, OpenTimeout: time.Millisecond}
+	lb, err := New([]Upstream{{URL: srv.URL}}, CircuitBreaker(breaker))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	upstream := lb.Upstreams()[0]
+	upstream.report(false, errors.New("failure"))
+	time.Sleep(breaker.OpenTimeout)
+
+	// The trial canceled by the client neither closes nor opens the circuit
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	st.Expect(t, upstream.Circuit(), CircuitHalfOpen)
+	st.Expect(t, upstream.available(), true)
+}
+
+func TestCircuitBreakerTrialRace(t *testing.T) {
+	a, b := newUpstreamServer("a"), newUpstreamServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	breaker := Breaker{Failures: 1, OpenTimeout: time.Millisecond}
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, CircuitBreaker(breaker))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	// A concurrent request takes the only half-open trial of the picked upstream
+	upstream := lb.Upstreams()[0]
+	upstream.report(false, errors.New("failure"))
+	time.Sleep(breaker.OpenTimeout)
+	ok, trial := upstream.acquire()
+	st.Expect(t, ok && trial, true)
+
+	w := httptest.NewRecorder()
+	lb.serve(w, httptest.NewRequest("GET", "/", nil), upstream)
+	st.Expect(t, w.Code, http.StatusOK)
+	st.Expect(t, w.Body.String(), "b")
+}
+
+func TestCircuitBreakerWebsocket(t *testing.T) {
+	breaker := Breaker{Failures: 1, OpenTimeout: time.Minute}
+	lb, err := New([]Upstream{{URL: "http://localhost:63450"}}, CircuitBreaker(breaker))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	req := httptest.NewRequest("GET", "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, req)
+	st.Expect(t, w.Code, http.StatusBadGateway)
+
+	upstream := lb.Upstreams()[0]
+	st.Expect(t, upstream.Circuit(), CircuitOpen)
+	st.Reject(t, upstream.CircuitError(), nil)
+}
+
+func TestCircuitBreakerInvalid(t *testing.T) {
+	_, err := New([]Upstream{{URL: "http://localhost"}}, CircuitBreaker(Breaker{Failures: -1}))
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,229 @@
+package balancer
+
+import (
+	"errors"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+// ConsistentHash defines the consistent hashing algorithm name, keyed on the client IP.
+const ConsistentHash = "consistent-hash"
+
+// DefaultVirtualNodes stores the default number of ring points per upstream weight unit.
+var DefaultVirtualNodes = 160
+
+// DefaultAffinityCookie stores the default affinity cookie name.
+const DefaultAffinityCookie = "vinxi_affinity"
+
+// HashKey returns the request key used to pick the upstream by consistent hashing.
+type HashKey func(req *http.Request) string
+
+// HeaderKey returns a hash key based on the given request header.
+func HeaderKey(name string) HashKey {
+	return func(req *http.Request) string {
+		return req.Header.Get(name)
+	}
+}
+
+// CookieKey returns a hash key based on the given request cookie.
+func CookieKey(name string) HashKey {
+	return func(req *http.Request) string {
+		if cookie, err := req.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+}
+
+// QueryKey returns a hash key based on the given request query param.
+func QueryKey(name string) HashKey {
+	return func(req *http.Request) string {
+		return req.URL.Query().Get(name)
+	}
+}
+
+// trustedProxiesKey is the request context key used to store
+// the trusted proxies of the balancer forwarders.
+type trustedProxiesKey struct{}
+
+// ClientIPKey is a hash key based on the client IP address.
+// The forwarding headers sent by the proxies trusted by the balancer
+// forwarders, via forward.TrustedProxies, are used to find the real client IP.
+func ClientIPKey(req *http.Request) string {
+	trusted, _ := req.Context().Value(trustedProxiesKey{}).([]*net.IPNet)
+	return forward.ClientIP(req, trusted)
+}
+
+// ParseHashKey parses a hash key definition, such as "header:X-User-Id",
+// "cookie:session", "query:user" or "ip".
+func ParseHashKey(key string) (HashKey, error) {
+	if key == "ip" || key == "" {
+		return ClientIPKey, nil
+	}
+	parts := strings.SplitN(key, ":", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+		return nil, errors.New("balancer: invalid hash key: " + key)
+	}
+	name := strings.TrimSpace(parts[1])
+	switch parts[0] {
+	case "header":
+		return HeaderKey(name), nil
+	case "cookie":
+		return CookieKey(name), nil
+	case "query":
+		return QueryKey(name), nil
+	}
+	return nil, errors.New("balancer: invalid hash key: " + key)
+}
+
+// consistentHash picks the upstream owning the request key in a hash ring
+// with virtual nodes, so only the keys of the added or removed upstreams are remapped.
+// The ring stores every balanced upstream and the unavailable ones are skipped
+// while picking, so it is only rebuilt when the balanced upstreams change.
+type consistentHash struct {
+	sync.RWMutex
+	key   HashKey
+	nodes int
+	ring  []ringPoint
+}
+
+// ringPoint represents an upstream virtual node in the hash ring.
+type ringPoint struct {
+	hash     uint64
+	upstream *Upstream
+}
+
+// NewConsistentHash creates a new weighted consistent hashing picker for the given key.
+// Requests without key fall back to the client IP address.
+// The picker cannot be shared across balancers, since it stores their upstreams.
+func NewConsistentHash(key HashKey) Picker {
+	return &consistentHash{key: key, nodes: DefaultVirtualNodes}
+}
+
+// Pick walks the ring clockwise from the request key hash,
+// returning the first upstream who is in the given upstreams.
+func (c *consistentHash) Pick(req *http.Request, upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+	key := c.key(req)
+	if key == "" {
+		key = ClientIPKey(req)
+	}
+	hash := hashString(key)
+
+	c.RLock()
+	defer c.RUnlock()
+	start := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= hash })
+	for i := 0; i < len(c.ring); i++ {
+		point := c.ring[(start+i)%len(c.ring)]
+		for _, u := range upstreams {
+			if u == point.upstream {
+				return u
+			}
+		}
+	}
+	return nil
+}
+
+// Update rebuilds the hash ring with the given upstreams.
+func (c *consistentHash) Update(upstreams []*Upstream) {
+	ring := []ringPoint{}
+	for _, u := range upstreams {
+		for i := 0; i < c.nodes*u.Weight; i++ {
+			ring = append(ring, ringPoint{hash: hashString(u.URL + "#" + strconv.Itoa(i)), upstream: u})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	c.Lock()
+	defer c.Unlock()
+	c.ring = ring
+}
+
+// hashString returns the 64 bits hash of the given string,
+// mixing the FNV-1a hash bits for a better distribution.
+func hashString(s string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(s))
+	h := hash.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Affinity defines the cookie issued to the clients to stick them to the picked upstream.
+type Affinity struct {
+	// Name stores the cookie name. Defaults to DefaultAffinityCookie.
+	Name string
+	// Path stores the cookie path. Defaults to "/".
+	Path string
+	// MaxAge stores the cookie lifetime. Session cookies are used if zero.
+	MaxAge time.Duration
+	// Secure restricts the cookie to HTTPS requests.
+	Secure bool
+}
+
+// StickyCookie enables the affinity cookie, forwarding the clients who send it
+// to the same upstream server while available, regardless of the balancing algorithm.
+func StickyCookie(affinity Affinity) OptSetter {
+	return func(b *Balancer) error {
+		if affinity.MaxAge < 0 {
+			return errors.New("balancer: affinity cookie max age cannot be negative")
+		}
+		if affinity.Name == "" {
+			affinity.Name = DefaultAffinityCookie
+		}
+		if affinity.Path == "" {
+			affinity.Path = "/"
+		}
+		b.affinity = &affinity
+		return nil
+	}
+}
+
+// sticky returns the available upstream referenced by the request affinity cookie, if any.
+func (a *Affinity) sticky(req *http.Request, upstreams []*Upstream) *Upstream {
+	cookie, err := req.Cookie(a.Name)
+	if err != nil {
+		return nil
+	}
+	for _, u := range upstreams {
+		if u.affinityKey() == cookie.Value {
+			return u
+		}
+	}
+	return nil
+}
+
+// issue sets the affinity cookie referencing the given upstream, unless the client already sent it.
+func (a *Affinity) issue(w http.ResponseWriter, req *http.Request, u *Upstream) {
+	key := u.affinityKey()
+	if cookie, err := req.Cookie(a.Name); err == nil && cookie.Value == key {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.Name,
+		Value:    key,
+		Path:     a.Path,
+		MaxAge:   int(a.MaxAge / time.Second),
+		Secure:   a.Secure,
+		HttpOnly: true,
+	})
+}
+
+// affinityKey returns the opaque upstream identifier used as affinity cookie value.
+func (u *Upstream) affinityKey() string {
+	return strconv.FormatUint(hashString(u.URL), 36)
+}
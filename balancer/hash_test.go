@@ -0,0 +1,203 @@
+package balancer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+func keyRequest(key string) *http.Request {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-User-Id", key)
+	return req
+}
+
+func TestConsistentHash(t *testing.T) {
+	p := NewConsistentHash(HeaderKey("X-User-Id"))
+	upstreams := newUpstreams(1, 1, 1, 1)
+	p.(PickerUpdater).Update(upstreams)
+
+	picked := map[string]*Upstream{}
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		picked[key] = p.Pick(keyRequest(key), upstreams)
+		st.Expect(t, p.Pick(keyRequest(key), upstreams), picked[key])
+	}
+
+	// Only the keys of the unavailable upstream are remapped
+	removed := upstreams[1]
+	remaining := []*Upstream{upstreams[0], upstreams[2], upstreams[3]}
+	for key, u := range picked {
+		if u != removed {
+			st.Expect(t, p.Pick(keyRequest(key), remaining), u)
+		}
+	}
+
+	// The same keys are remapped once the upstream is removed
+	p.(PickerUpdater).Update(remaining)
+	for key, u := range picked {
+		if u != removed {
+			st.Expect(t, p.Pick(keyRequest(key), remaining), u)
+		}
+	}
+
+	// Only the keys moved to the added upstream are remapped
+	added := append(newUpstreams(1, 1, 1, 1, 1)[4:], upstreams...)
+	p.(PickerUpdater).Update(added)
+	moved := 0
+	for key, u := range picked {
+		if next := p.Pick(keyRequest(key), added); next != u {
+			st.Expect(t, next, added[0])
+			moved++
+		}
+	}
+	st.Expect(t, moved > 100 && moved < 300, true)
+	st.Expect(t, p.Pick(nil, nil), (*Upstream)(nil))
+}
+
+func TestConsistentHashWeights(t *testing.T) {
+	p := NewConsistentHash(QueryKey("user"))
+	upstreams := newUpstreams(3, 1)
+	p.(PickerUpdater).Update(upstreams)
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[p.Pick(httptest.NewRequest("GET", "/?user="+strconv.Itoa(i), nil), upstreams).URL]++
+	}
+	st.Expect(t, counts["a"] > 650 && counts["a"] < 850, true)
+}
+
+func TestConsistentHashClientIPFallback(t *testing.T) {
+	p := NewConsistentHash(CookieKey("session"))
+	upstreams := newUpstreams(1, 1, 1)
+	p.(PickerUpdater).Update(upstreams)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	picked := p.Pick(req, upstreams)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:5678"
+	st.Expect(t, p.Pick(req, upstreams), picked)
+}
+
+func TestClientIPKeyTrustedProxies(t *testing.T) {
+	servers := map[string]string{}
+	upstreams := []Upstream{}
+	for _, name := range []string{"a", "b", "c"} {
+		srv := newUpstreamServer(name)
+		defer srv.Close()
+		servers[srv.URL] = name
+		upstreams = append(upstreams, Upstream{URL: srv.URL})
+	}
+	lb, err := New(upstreams, Algorithm(IPHash), Forward(forward.TrustedProxies("192.0.2.0/24")))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	// Clients behind a trusted proxy are hashed by their own address
+	for i := 0; i < 10; i++ {
+		client := "10.0.0." + strconv.Itoa(i)
+		direct := httptest.NewRequest("GET", "/", nil)
+		direct.RemoteAddr = client + ":1234"
+		expected := NewIPHash().Pick(direct, lb.Upstreams())
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set(forward.XForwardedFor, client)
+		w := httptest.NewRecorder()
+		lb.ServeHTTP(w, req)
+		st.Expect(t, w.Body.String(), servers[expected.URL])
+	}
+
+	// Forwarding headers sent by untrusted clients are ignored
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(forward.XForwardedFor, "6.6.6.6")
+	st.Expect(t, ClientIPKey(req), "10.0.0.1")
+}
+
+func TestParseHashKey(t *testing.T) {
+	req := httptest.NewRequest("GET", "/?user=foo", nil)
+	req.Header.Set("X-User-Id", "bar")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "baz"})
+
+	cases := map[string]string{
+		"":                 "192.0.2.1",
+		"ip":               "192.0.2.1",
+		"header:X-User-Id": "bar",
+		"cookie:session":   "baz",
+		"query:user":       "foo",
+	}
+	for key, value := range cases {
+		hashKey, err := ParseHashKey(key)
+		st.Expect(t, err, nil)
+		st.Expect(t, hashKey(req), value)
+	}
+
+	for _, key := range []string{"foo", "header:", "path:/foo"} {
+		_, err := ParseHashKey(key)
+		st.Reject(t, err, nil)
+	}
+}
+
+func TestStickyCookie(t *testing.T) {
+	a, b := newUpstreamServer("a"), newUpstreamServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), StickyCookie(Affinity{}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Body.String(), "a")
+	cookies := w.Result().Cookies()
+	st.Expect(t, len(cookies), 1)
+	st.Expect(t, cookies[0].Name, DefaultAffinityCookie)
+	st.Expect(t, cookies[0].HttpOnly, true)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+		lb.ServeHTTP(w, req)
+		st.Expect(t, w.Body.String(), "a")
+		st.Expect(t, w.Header().Get("Set-Cookie"), "")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultAffinityCookie, Value: "foo"})
+	w = httptest.NewRecorder()
+	lb.ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), "b")
+	st.Reject(t, w.Header().Get("Set-Cookie"), "")
+}
+
+func TestStickyCookieUnavailable(t *testing.T) {
+	a := newUpstreamServer("a")
+	a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, StickyCookie(Affinity{Name: "sticky"}), CircuitBreaker(Breaker{Failures: 1}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	proxy := testutils.NewHandler(lb.ServeHTTP)
+	defer proxy.Close()
+
+	cookie := &http.Cookie{Name: "sticky", Value: lb.Upstreams()[0].affinityKey()}
+	res, _, err := testutils.Get(proxy.URL, testutils.Header("Cookie", cookie.String()))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+
+	res, body, err := testutils.Get(proxy.URL, testutils.Header("Cookie", cookie.String()))
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "b")
+	st.Expect(t, res.Cookies()[0].Value, lb.Upstreams()[1].affinityKey())
+}
@@ -0,0 +1,241 @@
+package balancer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+var (
+	// DefaultHealthInterval stores the default time between upstream health checks.
+	DefaultHealthInterval = 10 * time.Second
+
+	// DefaultHealthTimeout stores the default maximum time to wait for a health check.
+	DefaultHealthTimeout = 2 * time.Second
+
+	// DefaultHealthRise stores the default number of consecutive successful
+	// checks required to consider an unhealthy upstream healthy again.
+	DefaultHealthRise = 2
+
+	// DefaultHealthFall stores the default number of consecutive failed
+	// checks required to consider a healthy upstream unhealthy.
+	DefaultHealthFall = 3
+)
+
+// HealthCheck defines the active upstream health checks.
+// Upstreams are probed via HTTP if a path is defined, otherwise
+// a TCP connection is established with the upstream server.
+// Zero values are replaced by the defaults.
+type HealthCheck struct {
+	// Path stores the HTTP path to probe, such as "/health".
+	Path string
+	// Status stores the expected HTTP response status code. Defaults to 200.
+	Status int
+	// Interval stores the time between checks.
+	Interval time.Duration
+	// Timeout stores the maximum time to wait for every check.
+	Timeout time.Duration
+	// Rise stores the consecutive successful checks to become healthy.
+	Rise int
+	// Fall stores the consecutive failed checks to become unhealthy.
+	Fall int
+	// Transport optionally stores the round tripper used by the HTTP checks
+	// of TCP targets, such as to present client certificates.
+	// Defaults to the upstream forwarder round tripper, always used
+	// to probe Unix domain socket and h2c targets.
+	Transport http.RoundTripper
+}
+
+// CheckHealth enables the active health checks of the upstream servers.
+// Unhealthy upstreams do not receive traffic until they are healthy again.
+// The health checks run until the balancer is closed.
+func CheckHealth(check HealthCheck) OptSetter {
+	return func(b *Balancer) error {
+		if check.Interval < 0 || check.Timeout < 0 || check.Rise < 0 || check.Fall < 0 {
+			return fmt.Errorf("balancer: health check options cannot be negative")
+		}
+		if check.Status == 0 {
+			check.Status = http.StatusOK
+		}
+		if check.Interval == 0 {
+			check.Interval = DefaultHealthInterval
+		}
+		if check.Timeout == 0 {
+			check.Timeout = DefaultHealthTimeout
+		}
+		if check.Rise == 0 {
+			check.Rise = DefaultHealthRise
+		}
+		if check.Fall == 0 {
+			check.Fall = DefaultHealthFall
+		}
+		b.health = &check
+		return nil
+	}
+}
+
+// healthState stores the upstream health check state.
+type healthState struct {
+	// unhealthy is accessed atomically, so upstreams are healthy by default.
+	unhealthy int32
+	// successes and failures store the consecutive check results.
+	successes, failures int
+	// lastError stores the last health check error, if any.
+	lastError atomic.Value
+}
+
+// Healthy returns true if the upstream passes the health checks, if enabled.
+func (u *Upstream) Healthy() bool {
+	return atomic.LoadInt32(&u.health.unhealthy) == 0
+}
+
+// HealthError returns the last health check error, if any.
+func (u *Upstream) HealthError() error {
+	err, _ := u.health.lastError.Load().(healthError)
+	return err.error
+}
+
+// record updates the upstream health state based on the given check result,
+// returning true if the upstream health has changed.
+func (u *Upstream) record(check *HealthCheck, err error) bool {
+	u.health.lastError.Store(healthError{err})
+	healthy := u.Healthy()
+
+	if err == nil {
+		u.health.successes++
+		u.health.failures = 0
+		if !healthy && u.health.successes >= check.Rise {
+			atomic.StoreInt32(&u.health.unhealthy, 0)
+			return true
+		}
+		return false
+	}
+
+	u.health.failures++
+	u.health.successes = 0
+	if healthy && u.health.failures >= check.Fall {
+		atomic.StoreInt32(&u.health.unhealthy, 1)
+		return true
+	}
+	return false
+}
+
+// healthError wraps health check errors, since atomic.Value cannot store nil values.
+type healthError struct {
+	error
+}
+
+// checkHealth probes the upstream health periodically until the given channel is closed.
+func (b *Balancer) checkHealth(stop chan struct{}) {
+	ticker := time.NewTicker(b.health.Interval)
+	defer ticker.Stop()
+
+	for {
+		b.probeAll()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeAll probes every upstream concurrently, waiting until all checks complete.
+func (b *Balancer) probeAll() {
+	var wg sync.WaitGroup
+	for _, upstream := range b.Upstreams() {
+		wg.Add(1)
+		go func(u *Upstream) {
+			defer wg.Done()
+			err := b.health.probe(u)
+			if u.record(b.health, err) {
+				if u.Healthy() {
+					b.log.Infof("Upstream %v is healthy", u.URL)
+				} else {
+					b.log.Errorf("Upstream %v is unhealthy: %v", u.URL, err)
+				}
+			}
+		}(upstream)
+	}
+	wg.Wait()
+}
+
+// probe checks the health of the given upstream.
+func (c *HealthCheck) probe(u *Upstream) error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	network, addr, base, err := probeAddr(u.URL)
+	if err != nil {
+		return err
+	}
+	if c.Path == "" {
+		conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	transport := c.Transport
+	if transport == nil || network == "unix" || strings.HasPrefix(base, forward.H2CScheme+":") {
+		transport = u.transport
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+c.Path, nil)
+	if err != nil {
+		return err
+	}
+	res, err := transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode != c.Status {
+		return fmt.Errorf("unexpected health check status: %d", res.StatusCode)
+	}
+	return nil
+}
+
+// probeAddr returns the network address and the base HTTP URL of the given upstream target.
+// The base URL of h2c targets keeps the h2c scheme, used by the forwarder round tripper.
+func probeAddr(target string) (network, addr, base string, err error) {
+	if strings.HasPrefix(target, forward.UnixScheme+"://") {
+		socket, _, err := forward.ParseUnixTarget(target)
+		return "unix", socket, "http://localhost", err
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", "", err
+	}
+	scheme := u.Scheme
+	if scheme == "ws" {
+		scheme = "http"
+	}
+	if scheme == "wss" {
+		scheme = "https"
+	}
+
+	addr = u.Host
+	if u.Port() == "" {
+		port := "80"
+		if scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	return "tcp", addr, scheme + "://" + u.Host, nil
+}
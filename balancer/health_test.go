@@ -0,0 +1,221 @@
+package balancer
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+// waitFor waits until the given condition is true or fails after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not satisfied in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHealthCheckHTTP(t *testing.T) {
+	var healthy int32 = 1
+	a := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/health" && atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("a"))
+	})
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	check := HealthCheck{Path: "/health", Interval: 10 * time.Millisecond, Rise: 2, Fall: 1}
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), CheckHealth(check))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	proxy := httptest.NewServer(lb)
+	defer proxy.Close()
+
+	upstream := lb.Upstreams()[0]
+	st.Expect(t, upstream.Healthy(), true)
+
+	atomic.StoreInt32(&healthy, 0)
+	waitFor(t, func() bool { return !upstream.Healthy() })
+	st.Expect(t, upstream.HealthError().Error(), "unexpected health check status: 503")
+	st.Expect(t, len(lb.Available()), 1)
+
+	for i := 0; i < 3; i++ {
+		_, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, string(body), "b")
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	waitFor(t, func() bool { return upstream.Healthy() })
+	st.Expect(t, upstream.HealthError(), nil)
+	st.Expect(t, len(lb.Available()), 2)
+}
+
+func TestHealthCheckTCP(t *testing.T) {
+	srv := newUpstreamServer("a")
+	srv.Close()
+
+	lb, err := New([]Upstream{{URL: srv.URL}}, CheckHealth(HealthCheck{Interval: 10 * time.Millisecond, Fall: 2}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	waitFor(t, func() bool { return !lb.Upstreams()[0].Healthy() })
+	st.Reject(t, lb.Upstreams()[0].HealthError(), nil)
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusServiceUnavailable)
+}
+
+func TestHealthCheckUnix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	listener, err := net.Listen("unix", socket)
+	st.Expect(t, err, nil)
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	lb, err := New([]Upstream{{URL: "unix://" + socket}, {URL: "unix:///non/existent/app.sock"}})
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	check := &HealthCheck{Path: "/health", Status: http.StatusOK, Timeout: time.Second}
+	for i := 0; i < 3; i++ {
+		st.Expect(t, check.probe(lb.Upstreams()[0]), nil)
+	}
+	st.Reject(t, check.probe(lb.Upstreams()[1]), nil)
+
+	// Probes reuse the upstream connections
+	st.Expect(t, atomic.LoadInt32(&conns), int32(1))
+}
+
+func TestHealthCheckH2C(t *testing.T) {
+	// The upstream only accepts HTTP/2 requests
+	srv := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		}
+	}), &http2.Server{}))
+	defer srv.Close()
+
+	lb, err := New([]Upstream{{URL: strings.Replace(srv.URL, "http://", "h2c://", 1)}})
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	check := &HealthCheck{Path: "/health", Status: http.StatusOK, Timeout: time.Second}
+	st.Expect(t, check.probe(lb.Upstreams()[0]), nil)
+}
+
+// proxyProtoListener expects a PROXY protocol v1 header
+// on every accepted connection.
+type proxyProtoListener struct {
+	net.Listener
+	headers chan string
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	l.headers <- header
+	return &bufferedConn{conn, reader}, nil
+}
+
+// bufferedConn reads from the given buffered reader first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(buf []byte) (int, error) {
+	return c.reader.Read(buf)
+}
+
+func TestHealthCheckProxyProtocol(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	listener := &proxyProtoListener{Listener: srv.Listener, headers: make(chan string, 1)}
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	lb, err := New([]Upstream{{URL: srv.URL}}, Forward(forward.ProxyProtocol(forward.ProxyProtocolV1)))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	check := &HealthCheck{Path: "/health", Status: http.StatusOK, Timeout: time.Second}
+	st.Expect(t, check.probe(lb.Upstreams()[0]), nil)
+	st.Expect(t, <-listener.headers, "PROXY UNKNOWN\r\n")
+}
+
+func TestHealthCheckInvalid(t *testing.T) {
+	_, err := New([]Upstream{{URL: "http://localhost"}}, CheckHealth(HealthCheck{Interval: -1}))
+	st.Reject(t, err, nil)
+}
+
+func TestProbeAddr(t *testing.T) {
+	cases := []struct {
+		target, network, addr, base string
+	}{
+		{"http://10.0.0.1", "tcp", "10.0.0.1:80", "http://10.0.0.1"},
+		{"https://example.com/api", "tcp", "example.com:443", "https://example.com"},
+		{"h2c://10.0.0.1:9000", "tcp", "10.0.0.1:9000", "h2c://10.0.0.1:9000"},
+		{"wss://[::1]", "tcp", "[::1]:443", "https://[::1]"},
+		{"unix:///run/app.sock:/api", "unix", "/run/app.sock", "http://localhost"},
+	}
+
+	for _, test := range cases {
+		network, addr, base, err := probeAddr(test.target)
+		st.Expect(t, err, nil)
+		st.Expect(t, network, test.network)
+		st.Expect(t, addr, test.addr)
+		st.Expect(t, base, test.base)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	lb, err := New([]Upstream{{URL: "http://localhost"}})
+	st.Expect(t, err, nil)
+	st.Expect(t, Get(lb.ID()), lb)
+
+	found := false
+	for _, b := range All() {
+		found = found || b == lb
+	}
+	st.Expect(t, found, true)
+
+	lb.Close()
+	st.Expect(t, Get(lb.ID()), (*Balancer)(nil))
+}
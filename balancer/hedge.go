@@ -0,0 +1,308 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+var (
+	// DefaultHedgeBudget stores the default maximum percentage of requests who can be hedged.
+	DefaultHedgeBudget = 10.0
+
+	// DefaultHedgeBurst stores the default maximum number of
+	// hedged requests saved up while requests are not hedged.
+	DefaultHedgeBurst = 10
+)
+
+// Hedge defines the request hedging, who sends the request again to a different
+// upstream if the first attempt does not respond within the hedging delay.
+// The first attempt who responds wins and the other one is canceled.
+// Only idempotent requests without body are hedged.
+type Hedge struct {
+	// Delay stores the time to wait for the first attempt response before hedging.
+	Delay time.Duration
+	// Budget stores the maximum percentage of requests who can be hedged, from 0 to 100,
+	// so hedging never more than doubles the upstream load. Defaults to DefaultHedgeBudget.
+	// Every hedgeable request saves up Budget/100 hedged requests, up to Burst.
+	Budget float64
+	// Burst stores the maximum number of hedged requests saved up
+	// while requests are not hedged. Defaults to DefaultHedgeBurst.
+	Burst int
+	// Methods stores the HTTP methods who can be hedged. Defaults to GET and HEAD.
+	Methods []string
+}
+
+// HedgeStats stores the request hedging counters.
+type HedgeStats struct {
+	// Requests stores the requests who could be hedged.
+	Requests uint64 `json:"requests"`
+	// Hedged stores the requests who were sent to a second upstream.
+	Hedged uint64 `json:"hedged"`
+	// Won stores the hedged requests who were replied by the second upstream first.
+	Won uint64 `json:"won"`
+}
+
+// Hedging enables the request hedging of the idempotent requests,
+// reducing the tail latency at the cost of extra upstream load.
+func Hedging(hedge Hedge) OptSetter {
+	return func(b *Balancer) error {
+		if hedge.Delay <= 0 {
+			return errors.New("balancer: hedging delay must be positive")
+		}
+		if hedge.Budget < 0 || hedge.Budget > 100 {
+			return errors.New("balancer: hedging budget must be between 0 and 100")
+		}
+		if hedge.Burst < 0 {
+			return errors.New("balancer: hedging burst cannot be negative")
+		}
+		if hedge.Budget == 0 {
+			hedge.Budget = DefaultHedgeBudget
+		}
+		if hedge.Burst == 0 {
+			hedge.Burst = DefaultHedgeBurst
+		}
+		if len(hedge.Methods) == 0 {
+			hedge.Methods = []string{"GET", "HEAD"}
+		}
+		b.hedge = &hedge
+		return nil
+	}
+}
+
+// HedgeStats returns the request hedging counters.
+func (b *Balancer) HedgeStats() HedgeStats {
+	return HedgeStats{
+		Requests: atomic.LoadUint64(&b.hedges.Requests),
+		Hedged:   atomic.LoadUint64(&b.hedges.Hedged),
+		Won:      atomic.LoadUint64(&b.hedges.Won),
+	}
+}
+
+// hedgeable returns true if the given request can be hedged.
+// The request body is checked by its length, since middleware, such as
+// the vinxi context, can wrap the body of the requests without body.
+func (b *Balancer) hedgeable(req *http.Request) bool {
+	if b.hedge == nil || utils.IsWebsocketRequest(req) {
+		return false
+	}
+	if req.ContentLength != 0 {
+		return false
+	}
+	for _, method := range b.hedge.Methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// serveHedged forwards the request to the given upstream, sending it again
+// to a different upstream if there is no response within the hedging delay.
+func (b *Balancer) serveHedged(w http.ResponseWriter, req *http.Request, primary *Upstream) {
+	atomic.AddUint64(&b.hedges.Requests, 1)
+	b.earnHedge()
+	race := &hedgeRace{w: w, won: make(chan struct{})}
+
+	attempt := race.attempt(req, false)
+	go attempt.run(func(w http.ResponseWriter, req *http.Request) {
+		b.serve(w, req, primary)
+	})
+
+	timer := time.NewTimer(b.hedge.Delay)
+	defer timer.Stop()
+	select {
+	case <-race.won:
+	case <-timer.C:
+		b.hedgeTo(race, req, primary)
+		<-race.won
+	}
+
+	<-race.winner.done
+	if race.winner.hedged {
+		atomic.AddUint64(&b.hedges.Won, 1)
+	}
+}
+
+// hedgeTo sends the hedged request attempt to an upstream different
+// than the primary one, if available and allowed by the budget.
+func (b *Balancer) hedgeTo(race *hedgeRace, req *http.Request, primary *Upstream) {
+	upstream := b.picker.Pick(req, without(b.Available(), []*Upstream{primary}))
+	if upstream == nil || !b.spendHedge() {
+		return
+	}
+
+	attempt := race.attempt(req, true)
+	if attempt == nil {
+		b.refundHedge()
+		return
+	}
+	ok, trial := upstream.acquire()
+	if !ok {
+		attempt.cancel()
+		b.refundHedge()
+		return
+	}
+	go attempt.run(func(w http.ResponseWriter, req *http.Request) {
+		b.forwardTo(w, req, upstream, trial)
+	})
+}
+
+// hedgeBudget stores the hedging token bucket in percentage points,
+// so every hedged request costs 100.
+type hedgeBudget struct {
+	sync.Mutex
+	tokens float64
+}
+
+// earnHedge saves up the budget percentage of a hedged request, up to the burst.
+func (b *Balancer) earnHedge() {
+	b.budget.Lock()
+	defer b.budget.Unlock()
+	b.budget.tokens = math.Min(b.budget.tokens+b.hedge.Budget, float64(b.hedge.Burst*100))
+}
+
+// spendHedge consumes a hedged request from the budget,
+// returning false if the budget is exhausted.
+func (b *Balancer) spendHedge() bool {
+	b.budget.Lock()
+	defer b.budget.Unlock()
+	if b.budget.tokens < 100 {
+		return false
+	}
+	b.budget.tokens -= 100
+	atomic.AddUint64(&b.hedges.Hedged, 1)
+	return true
+}
+
+// refundHedge returns a hedged request not sent to the budget.
+func (b *Balancer) refundHedge() {
+	b.budget.Lock()
+	defer b.budget.Unlock()
+	b.budget.tokens += 100
+	atomic.AddUint64(&b.hedges.Hedged, ^uint64(0))
+}
+
+// hedgeRace races the request attempts, streaming the response
+// of the first attempt who replies and canceling the other ones.
+type hedgeRace struct {
+	sync.Mutex
+	w        http.ResponseWriter
+	attempts []*hedgeAttempt
+	winner   *hedgeAttempt
+	won      chan struct{}
+}
+
+// attempt creates a new request attempt, or returns nil if the race is already won.
+func (r *hedgeRace) attempt(req *http.Request, hedged bool) *hedgeAttempt {
+	r.Lock()
+	defer r.Unlock()
+	if r.winner != nil {
+		return nil
+	}
+
+	// Every attempt gets its own empty body instead of sharing the client one
+	ctx, cancel := context.WithCancel(req.Context())
+	attemptReq := req.Clone(ctx)
+	attemptReq.Body = http.NoBody
+	a := &hedgeAttempt{
+		race:   r,
+		req:    attemptReq,
+		header: make(http.Header),
+		cancel: cancel,
+		done:   make(chan struct{}),
+		hedged: hedged,
+	}
+	r.attempts = append(r.attempts, a)
+	return a
+}
+
+// hedgeAttempt implements the http.ResponseWriter of a request attempt,
+// who writes to the client response only if the attempt wins the race.
+type hedgeAttempt struct {
+	race   *hedgeRace
+	req    *http.Request
+	header http.Header
+	cancel context.CancelFunc
+	done   chan struct{}
+	hedged bool
+	won    bool
+	lost   bool
+	wrote  bool
+}
+
+// run serves the attempt request with the given handler function.
+func (a *hedgeAttempt) run(serve func(w http.ResponseWriter, req *http.Request)) {
+	defer close(a.done)
+	defer a.cancel()
+	serve(a, a.req)
+	if !a.wrote {
+		a.WriteHeader(http.StatusOK)
+	}
+}
+
+// claim tries to win the race, canceling the other attempts on success.
+func (a *hedgeAttempt) claim() bool {
+	if a.won || a.lost {
+		return a.won
+	}
+
+	r := a.race
+	r.Lock()
+	defer r.Unlock()
+	if r.winner != nil {
+		a.lost = true
+		return false
+	}
+	a.won = true
+	r.winner = a
+	for _, attempt := range r.attempts {
+		if attempt != a {
+			attempt.cancel()
+		}
+	}
+	close(r.won)
+	return true
+}
+
+func (a *hedgeAttempt) Header() http.Header {
+	if a.wrote {
+		return a.race.w.Header()
+	}
+	return a.header
+}
+
+func (a *hedgeAttempt) WriteHeader(code int) {
+	if a.wrote || !a.claim() {
+		return
+	}
+	utils.CopyHeaders(a.race.w.Header(), a.header)
+	a.wrote = true
+	a.race.w.WriteHeader(code)
+}
+
+func (a *hedgeAttempt) Write(b []byte) (int, error) {
+	if !a.wrote {
+		a.WriteHeader(http.StatusOK)
+	}
+	if a.lost {
+		return len(b), nil
+	}
+	return a.race.w.Write(b)
+}
+
+// Flush implements the http.Flusher interface for the winner attempt.
+func (a *hedgeAttempt) Flush() {
+	if !a.wrote || a.lost {
+		return
+	}
+	if flusher, ok := a.race.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
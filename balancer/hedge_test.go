@@ -0,0 +1,219 @@
+package balancer
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/context"
+)
+
+// newSlowServer creates an upstream server who replies with the given body after
+// the given delay, counting the requests canceled before replying.
+func newSlowServer(body string, delay time.Duration, canceled *int32) *httptest.Server {
+	return testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Write([]byte(body))
+		case <-req.Context().Done():
+			atomic.AddInt32(canceled, 1)
+		}
+	})
+}
+
+func TestHedging(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", time.Second, &canceled)
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), Hedging(Hedge{Delay: 20 * time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	proxy := httptest.NewServer(lb)
+	defer proxy.Close()
+
+	start := time.Now()
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, 200)
+	st.Expect(t, string(body), "b")
+	st.Expect(t, time.Since(start) < time.Second, true)
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 1, Hedged: 1, Won: 1})
+	waitFor(t, func() bool { return atomic.LoadInt32(&canceled) == 1 })
+
+	// The hedged attempt also advances the round robin
+	_, body, err = testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "b")
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 2, Hedged: 2, Won: 2})
+}
+
+func TestHedgingPrimaryWins(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", 50*time.Millisecond, &canceled)
+	defer a.Close()
+	b := newSlowServer("b", time.Second, &canceled)
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), Hedging(Hedge{Delay: 10 * time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Body.String(), "a")
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 1, Hedged: 1})
+	waitFor(t, func() bool { return atomic.LoadInt32(&canceled) == 1 })
+}
+
+func TestHedgingBudget(t *testing.T) {
+	var hits, canceled int32
+	slow := func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		select {
+		case <-time.After(20 * time.Millisecond):
+			w.Write([]byte("ok"))
+		case <-req.Context().Done():
+			atomic.AddInt32(&canceled, 1)
+		}
+	}
+	a := testutils.NewHandler(slow)
+	defer a.Close()
+	b := testutils.NewHandler(slow)
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Hedging(Hedge{Delay: time.Millisecond, Budget: 50}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		st.Expect(t, w.Code, 200)
+	}
+	stats := lb.HedgeStats()
+	st.Expect(t, stats.Requests, uint64(10))
+	st.Expect(t, stats.Hedged, uint64(5))
+	st.Expect(t, atomic.LoadInt32(&hits) <= 15, true)
+}
+
+func TestHedgingBurst(t *testing.T) {
+	lb, err := New([]Upstream{{URL: "http://localhost"}}, Hedging(Hedge{Delay: time.Millisecond, Budget: 10, Burst: 2}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	// The saved up hedged requests are capped by the burst
+	for i := 0; i < 100; i++ {
+		lb.earnHedge()
+	}
+	st.Expect(t, lb.spendHedge(), true)
+	st.Expect(t, lb.spendHedge(), true)
+	st.Expect(t, lb.spendHedge(), false)
+
+	for i := 0; i < 9; i++ {
+		lb.earnHedge()
+	}
+	st.Expect(t, lb.spendHedge(), false)
+	lb.earnHedge()
+	st.Expect(t, lb.spendHedge(), true)
+}
+
+func TestHedgingCanceledTrial(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", time.Second, &canceled)
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	breaker := Breaker{Failures: 1, OpenTimeout: time.Millisecond}
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), CircuitBreaker(breaker), Hedging(Hedge{Delay: 20 * time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	upstream := lb.Upstreams()[0]
+	upstream.report(false, errors.New("failure"))
+	time.Sleep(breaker.OpenTimeout)
+
+	// The losing trial neither closes nor opens the circuit
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Body.String(), "b")
+	waitFor(t, upstream.available)
+	st.Expect(t, upstream.Circuit(), CircuitHalfOpen)
+}
+
+func TestHedgingContextBody(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", time.Second, &canceled)
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), Hedging(Hedge{Delay: 20 * time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	// The vinxi context wraps the request body
+	req := httptest.NewRequest("GET", "/", nil)
+	context.Set(req, "foo", "bar")
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), "b")
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 1, Hedged: 1, Won: 1})
+}
+
+func TestHedgingSkipsRequests(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", 100*time.Millisecond, &canceled)
+	defer a.Close()
+	b := newUpstreamServer("b")
+	defer b.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}, {URL: b.URL}}, Algorithm(RoundRobin), Hedging(Hedge{Delay: 20 * time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	st.Expect(t, w.Body.String(), "a")
+
+	// The next request is forwarded to the fast upstream
+	lb.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	w = httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", strings.NewReader("body")))
+	st.Expect(t, w.Body.String(), "a")
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 1})
+}
+
+func TestHedgingSingleUpstream(t *testing.T) {
+	var canceled int32
+	a := newSlowServer("a", 20*time.Millisecond, &canceled)
+	defer a.Close()
+
+	lb, err := New([]Upstream{{URL: a.URL}}, Hedging(Hedge{Delay: time.Millisecond, Budget: 100}))
+	st.Expect(t, err, nil)
+	defer lb.Close()
+
+	w := httptest.NewRecorder()
+	lb.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Body.String(), "a")
+	st.Expect(t, lb.HedgeStats(), HedgeStats{Requests: 1})
+}
+
+func TestHedgingInvalid(t *testing.T) {
+	_, err := New([]Upstream{{URL: "http://localhost"}}, Hedging(Hedge{}))
+	st.Reject(t, err, nil)
+	_, err = New([]Upstream{{URL: "http://localhost"}}, Hedging(Hedge{Delay: time.Millisecond, Budget: 101}))
+	st.Reject(t, err, nil)
+	_, err = New([]Upstream{{URL: "http://localhost"}}, Hedging(Hedge{Delay: time.Millisecond, Burst: -1}))
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,45 @@
+package balancer
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry stores the active balancers by ID, used to expose their state.
+var registry = struct {
+	sync.RWMutex
+	balancers map[string]*Balancer
+}{balancers: make(map[string]*Balancer)}
+
+// register registers the given balancer.
+func register(b *Balancer) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.balancers[b.id] = b
+}
+
+// unregister removes the given balancer from the registry.
+func unregister(b *Balancer) {
+	registry.Lock()
+	defer registry.Unlock()
+	delete(registry.balancers, b.id)
+}
+
+// All returns the active balancers sorted by ID.
+func All() []*Balancer {
+	registry.RLock()
+	defer registry.RUnlock()
+	list := []*Balancer{}
+	for _, b := range registry.balancers {
+		list = append(list, b)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// Get returns the active balancer with the given ID, if exists.
+func Get(id string) *Balancer {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.balancers[id]
+}
@@ -0,0 +1,300 @@
+// Package canary implements weighted traffic splitting across named variants,
+// such as the stable and canary versions of a backend, for gradual rollouts.
+package canary
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// DefaultStickyCookie stores the default sticky variant cookie name.
+const DefaultStickyCookie = "vinxi_variant"
+
+// Variant represents a named traffic split target who receives
+// a percentage of the incoming traffic.
+type Variant struct {
+	// Name stores the variant name, such as "stable" or "canary".
+	Name string `json:"name"`
+	// URL stores the variant server URL, using any target syntax supported
+	// by forward.Target. Ignored if Handler is defined.
+	URL string `json:"url,omitempty"`
+	// Weight stores the percentage of traffic forwarded to the variant.
+	// The weights of all the variants must add up to 100.
+	Weight int `json:"weight"`
+	// Handler optionally stores the HTTP handler who serves the variant traffic.
+	Handler http.Handler `json:"-"`
+
+	requests uint64
+}
+
+// Requests returns the number of requests served by the variant.
+func (v *Variant) Requests() uint64 {
+	return atomic.LoadUint64(&v.requests)
+}
+
+// OptSetter represents the splitter setter function.
+type OptSetter func(s *Splitter) error
+
+// OverrideHeader defines the request header who forces the variant by name,
+// regardless of the variant weights.
+func OverrideHeader(name string) OptSetter {
+	return func(s *Splitter) error {
+		s.header = name
+		return nil
+	}
+}
+
+// OverrideCookie defines the request cookie who forces the variant by name,
+// regardless of the variant weights.
+func OverrideCookie(name string) OptSetter {
+	return func(s *Splitter) error {
+		s.cookie = name
+		return nil
+	}
+}
+
+// Sticky enables the sticky variant assignment, issuing a cookie with the given
+// name, or DefaultStickyCookie if empty, who keeps the client on the assigned
+// variant while its weight is greater than zero.
+func Sticky(name string) OptSetter {
+	return func(s *Splitter) error {
+		if name == "" {
+			name = DefaultStickyCookie
+		}
+		s.sticky = name
+		return nil
+	}
+}
+
+// Name defines the splitter name, used as its identifier in the admin API
+// instead of a random one. A splitter replaces the registered splitter
+// with the same name, if any.
+func Name(name string) OptSetter {
+	return func(s *Splitter) error {
+		if name == "" || strings.Contains(name, "/") {
+			return fmt.Errorf("canary: invalid splitter name: %q", name)
+		}
+		s.id = name
+		return nil
+	}
+}
+
+// Forward defines the forwarder options used with the variants defined by URL.
+func Forward(opts ...forward.OptSetter) OptSetter {
+	return func(s *Splitter) error {
+		s.forward = append(s.forward, opts...)
+		return nil
+	}
+}
+
+// Logger specifies the logger to use.
+func Logger(l utils.Logger) OptSetter {
+	return func(s *Splitter) error {
+		s.log = l
+		return nil
+	}
+}
+
+// Splitter splits the incoming traffic across the variants based on their weights.
+// The weights can be adjusted at runtime via SetWeights.
+type Splitter struct {
+	sync.RWMutex
+	id       string
+	variants []*Variant
+	header   string
+	cookie   string
+	sticky   string
+	forward  []forward.OptSetter
+	log      utils.Logger
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// New creates a new traffic splitter for the given variants.
+func New(variants []Variant, setters ...OptSetter) (*Splitter, error) {
+	s := &Splitter{id: utils.NewID(), rand: rand.New(rand.NewSource(rand.Int63()))}
+	for _, setter := range setters {
+		if err := setter(s); err != nil {
+			return nil, err
+		}
+	}
+	if s.log == nil {
+		s.log = utils.NullLogger
+	}
+
+	weights := make(map[string]int)
+	for _, variant := range variants {
+		if variant.Name == "" {
+			return nil, errors.New("canary: variant name cannot be empty")
+		}
+		if _, exists := weights[variant.Name]; exists {
+			return nil, errors.New("canary: duplicated variant: " + variant.Name)
+		}
+		weights[variant.Name] = variant.Weight
+
+		v := &Variant{Name: variant.Name, URL: variant.URL, Weight: variant.Weight, Handler: variant.Handler}
+		if v.Handler == nil {
+			opts := append([]forward.OptSetter{forward.Target(v.URL), forward.Logger(s.log)}, s.forward...)
+			fwd, err := forward.New(opts...)
+			if err != nil {
+				return nil, err
+			}
+			v.Handler = fwd
+		}
+		s.variants = append(s.variants, v)
+	}
+	if err := validateWeights(weights); err != nil {
+		return nil, err
+	}
+
+	register(s)
+	return s, nil
+}
+
+// Must returns the given splitter, panicking if err is not nil.
+// Useful to define splitters as final handlers, who are closed once replaced.
+func Must(s *Splitter, err error) *Splitter {
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// To returns an http.HandlerFunc who splits the incoming traffic
+// across the given variants.
+// The splitter is never unregistered, use New to control its lifetime.
+func To(variants []Variant, setters ...OptSetter) func(w http.ResponseWriter, r *http.Request) {
+	s, err := New(variants, setters...)
+	if err != nil {
+		panic(err)
+	}
+	return s.ServeHTTP
+}
+
+// ID returns the splitter unique identifier.
+func (s *Splitter) ID() string {
+	return s.id
+}
+
+// Close unregisters the splitter.
+func (s *Splitter) Close() error {
+	unregister(s)
+	return nil
+}
+
+// Variants returns a snapshot of the split variants.
+func (s *Splitter) Variants() []Variant {
+	s.RLock()
+	defer s.RUnlock()
+	variants := []Variant{}
+	for _, v := range s.variants {
+		variants = append(variants, Variant{Name: v.Name, URL: v.URL, Weight: v.Weight, Handler: v.Handler, requests: v.Requests()})
+	}
+	return variants
+}
+
+// SetWeights atomically updates the variant weights by name.
+// Every variant weight must be defined and add up to 100.
+func (s *Splitter) SetWeights(weights map[string]int) error {
+	s.Lock()
+	defer s.Unlock()
+	for name := range weights {
+		if s.find(name) == nil {
+			return errors.New("canary: unknown variant: " + name)
+		}
+	}
+	if len(weights) != len(s.variants) {
+		return errors.New("canary: the weight of every variant must be defined")
+	}
+	if err := validateWeights(weights); err != nil {
+		return err
+	}
+	for _, v := range s.variants {
+		v.Weight = weights[v.Name]
+	}
+	s.log.Infof("Traffic split %v weights updated: %v", s.id, weights)
+	return nil
+}
+
+// ServeHTTP forwards the request to the forced, sticky or weighted picked variant.
+func (s *Splitter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	v, assigned := s.pick(req)
+	if assigned && s.sticky != "" {
+		http.SetCookie(w, &http.Cookie{Name: s.sticky, Value: v.Name, Path: "/", HttpOnly: true})
+	}
+
+	atomic.AddUint64(&v.requests, 1)
+	v.Handler.ServeHTTP(w, req)
+}
+
+// pick picks the variant who serves the given request,
+// returning true if the variant was assigned based on the weights.
+func (s *Splitter) pick(req *http.Request) (*Variant, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if s.header != "" {
+		if v := s.find(req.Header.Get(s.header)); v != nil {
+			return v, false
+		}
+	}
+	if s.cookie != "" {
+		if cookie, err := req.Cookie(s.cookie); err == nil {
+			if v := s.find(cookie.Value); v != nil {
+				return v, false
+			}
+		}
+	}
+	if s.sticky != "" {
+		if cookie, err := req.Cookie(s.sticky); err == nil {
+			if v := s.find(cookie.Value); v != nil && v.Weight > 0 {
+				return v, false
+			}
+		}
+	}
+
+	s.randMu.Lock()
+	n := s.rand.Intn(100)
+	s.randMu.Unlock()
+	for _, v := range s.variants {
+		if n < v.Weight {
+			return v, true
+		}
+		n -= v.Weight
+	}
+	return s.variants[len(s.variants)-1], true
+}
+
+// find returns the variant with the given name, if exists.
+func (s *Splitter) find(name string) *Variant {
+	for _, v := range s.variants {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// validateWeights checks if the given variant weights are valid percentages adding up to 100.
+func validateWeights(weights map[string]int) error {
+	total := 0
+	for name, weight := range weights {
+		if weight < 0 || weight > 100 {
+			return fmt.Errorf("canary: variant weight must be between 0 and 100: %s", name)
+		}
+		total += weight
+	}
+	if total != 100 {
+		return fmt.Errorf("canary: variant weights must add up to 100, got %d", total)
+	}
+	return nil
+}
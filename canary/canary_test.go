@@ -0,0 +1,167 @@
+package canary
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+// named returns a handler who replies with the given name.
+func named(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func newSplitter(t *testing.T, stable, canary int, setters ...OptSetter) *Splitter {
+	s, err := New([]Variant{
+		{Name: "stable", Weight: stable, Handler: named("stable")},
+		{Name: "canary", Weight: canary, Handler: named("canary")},
+	}, setters...)
+	st.Expect(t, err, nil)
+	return s
+}
+
+func serve(s *Splitter, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestSplitter(t *testing.T) {
+	s := newSplitter(t, 80, 20)
+	defer s.Close()
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		counts[serve(s, httptest.NewRequest("GET", "/", nil)).Body.String()]++
+	}
+	st.Expect(t, counts["stable"] > 700 && counts["stable"] < 900, true)
+	st.Expect(t, counts["stable"]+counts["canary"], 1000)
+
+	variants := s.Variants()
+	st.Expect(t, variants[0].Requests()+variants[1].Requests(), uint64(1000))
+
+	st.Expect(t, s.SetWeights(map[string]int{"stable": 0, "canary": 100}), nil)
+	for i := 0; i < 10; i++ {
+		st.Expect(t, serve(s, httptest.NewRequest("GET", "/", nil)).Body.String(), "canary")
+	}
+	st.Expect(t, s.Variants()[1].Weight, 100)
+}
+
+func TestSplitterSetWeightsInvalid(t *testing.T) {
+	s := newSplitter(t, 100, 0)
+	defer s.Close()
+
+	st.Reject(t, s.SetWeights(map[string]int{"stable": 50, "canary": 40}), nil)
+	st.Reject(t, s.SetWeights(map[string]int{"stable": 100}), nil)
+	st.Reject(t, s.SetWeights(map[string]int{"stable": 50, "foo": 50}), nil)
+	st.Reject(t, s.SetWeights(map[string]int{"stable": 110, "canary": -10}), nil)
+	st.Expect(t, s.Variants()[0].Weight, 100)
+}
+
+func TestSplitterOverride(t *testing.T) {
+	s := newSplitter(t, 100, 0, OverrideHeader("X-Variant"), OverrideCookie("variant"), Sticky(""))
+	defer s.Close()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Variant", "canary")
+	w := serve(s, req)
+	st.Expect(t, w.Body.String(), "canary")
+	st.Expect(t, w.Header().Get("Set-Cookie"), "")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "variant", Value: "canary"})
+	st.Expect(t, serve(s, req).Body.String(), "canary")
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Variant", "foo")
+	st.Expect(t, serve(s, req).Body.String(), "stable")
+}
+
+func TestSplitterSticky(t *testing.T) {
+	s := newSplitter(t, 50, 50, Sticky("sticky"))
+	defer s.Close()
+
+	w := serve(s, httptest.NewRequest("GET", "/", nil))
+	cookies := w.Result().Cookies()
+	st.Expect(t, len(cookies), 1)
+	st.Expect(t, cookies[0].Value, w.Body.String())
+
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(cookies[0])
+		w := serve(s, req)
+		st.Expect(t, w.Body.String(), cookies[0].Value)
+		st.Expect(t, w.Header().Get("Set-Cookie"), "")
+	}
+
+	// Clients are assigned again if their variant is rolled back
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: "sticky", Value: "canary"})
+	st.Expect(t, s.SetWeights(map[string]int{"stable": 100, "canary": 0}), nil)
+	w = serve(s, req)
+	st.Expect(t, w.Body.String(), "stable")
+	st.Expect(t, w.Result().Cookies()[0].Value, "stable")
+}
+
+func TestSplitterURL(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("upstream"))
+	})
+	defer srv.Close()
+
+	s, err := New([]Variant{{Name: "stable", URL: srv.URL, Weight: 100}})
+	st.Expect(t, err, nil)
+	defer s.Close()
+	st.Expect(t, serve(s, httptest.NewRequest("GET", "/", nil)).Body.String(), "upstream")
+}
+
+func TestSplitterInvalid(t *testing.T) {
+	cases := [][]Variant{
+		{},
+		{{Name: "stable", Weight: 90, Handler: named("stable")}},
+		{{Name: "", Weight: 100, Handler: named("stable")}},
+		{{Name: "stable", Weight: 50, Handler: named("stable")}, {Name: "stable", Weight: 50, Handler: named("stable")}},
+		{{Name: "stable", Weight: 100, URL: "localhost"}},
+	}
+	for _, variants := range cases {
+		_, err := New(variants)
+		st.Reject(t, err, nil)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	s := newSplitter(t, 100, 0)
+	st.Expect(t, Get(s.ID()), s)
+
+	found := false
+	for _, splitter := range All() {
+		found = found || splitter == s
+	}
+	st.Expect(t, found, true)
+
+	s.Close()
+	st.Expect(t, Get(s.ID()), (*Splitter)(nil))
+}
+
+func TestSplitterName(t *testing.T) {
+	s := newSplitter(t, 100, 0, Name("checkout"))
+	st.Expect(t, s.ID(), "checkout")
+	st.Expect(t, Get("checkout"), s)
+
+	// Splitters with the same name replace the registered one
+	replaced := s
+	s = newSplitter(t, 90, 10, Name("checkout"))
+	st.Expect(t, Get("checkout"), s)
+	replaced.Close()
+	st.Expect(t, Get("checkout"), s)
+	s.Close()
+	st.Expect(t, Get("checkout"), (*Splitter)(nil))
+
+	_, err := New([]Variant{{Name: "stable", Weight: 100, Handler: named("stable")}}, Name("foo/bar"))
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,47 @@
+package canary
+
+import (
+	"sort"
+	"sync"
+)
+
+// registry stores the active splitters by ID, used to expose their state.
+var registry = struct {
+	sync.RWMutex
+	splitters map[string]*Splitter
+}{splitters: make(map[string]*Splitter)}
+
+// register registers the given splitter, replacing the splitter with the same ID.
+func register(s *Splitter) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.splitters[s.id] = s
+}
+
+// unregister removes the given splitter from the registry, unless it was replaced.
+func unregister(s *Splitter) {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.splitters[s.id] == s {
+		delete(registry.splitters, s.id)
+	}
+}
+
+// All returns the active splitters sorted by ID.
+func All() []*Splitter {
+	registry.RLock()
+	defer registry.RUnlock()
+	list := []*Splitter{}
+	for _, s := range registry.splitters {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].id < list[j].id })
+	return list
+}
+
+// Get returns the active splitter with the given ID, if exists.
+func Get(id string) *Splitter {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.splitters[id]
+}
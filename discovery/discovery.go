@@ -0,0 +1,253 @@
+// Package discovery implements the upstream service discovery, updating
+// the balanced upstream servers of routes and plugins without restarting vinxi.
+package discovery
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// DefaultInterval stores the default time between service discovery refreshes.
+var DefaultInterval = 5 * time.Second
+
+// ErrServiceNotFound is used when the requested service is not discovered.
+var ErrServiceNotFound = errors.New("discovery: service not found")
+
+// Services stores the discovered upstream servers by service name.
+type Services map[string][]balancer.Upstream
+
+// Provider represents the service discovery provider interface,
+// such as File or SRV, who returns the currently discovered services.
+type Provider interface {
+	Services() (Services, error)
+}
+
+// ProviderFunc represents the function interface for providers.
+type ProviderFunc func() (Services, error)
+
+// Services calls f().
+func (f ProviderFunc) Services() (Services, error) {
+	return f()
+}
+
+// Target represents the interface implemented by the discovered
+// services consumers, such as balancer.Balancer.
+type Target interface {
+	Update(upstreams []balancer.Upstream) error
+}
+
+// OptSetter represents the discovery setter function.
+type OptSetter func(d *Discovery) error
+
+// Interval defines the time between service discovery refreshes.
+func Interval(interval time.Duration) OptSetter {
+	return func(d *Discovery) error {
+		if interval <= 0 {
+			return errors.New("discovery: refresh interval must be positive")
+		}
+		d.interval = interval
+		return nil
+	}
+}
+
+// Logger specifies the logger to use.
+func Logger(l utils.Logger) OptSetter {
+	return func(d *Discovery) error {
+		d.log = l
+		return nil
+	}
+}
+
+// Discovery periodically refreshes the services discovered by a provider,
+// updating the targets bound to the changed services.
+// If the provider fails, the last discovered services are kept.
+type Discovery struct {
+	sync.RWMutex
+	refresh  sync.Mutex
+	provider Provider
+	interval time.Duration
+	services Services
+	targets  map[string][]Target
+	stop     chan struct{}
+	log      utils.Logger
+}
+
+// New creates a new service discovery for the given provider,
+// who is refreshed until the discovery is closed.
+func New(provider Provider, setters ...OptSetter) (*Discovery, error) {
+	d := &Discovery{
+		provider: provider,
+		interval: DefaultInterval,
+		targets:  make(map[string][]Target),
+		stop:     make(chan struct{}),
+	}
+	for _, s := range setters {
+		if err := s(d); err != nil {
+			return nil, err
+		}
+	}
+	if d.log == nil {
+		d.log = utils.NullLogger
+	}
+
+	services, err := provider.Services()
+	if err != nil {
+		return nil, err
+	}
+	d.services = services
+
+	go d.watch(d.stop)
+	return d, nil
+}
+
+// Services returns the discovered services.
+func (d *Discovery) Services() Services {
+	d.RLock()
+	defer d.RUnlock()
+	services := make(Services, len(d.services))
+	for name, upstreams := range d.services {
+		services[name] = append([]balancer.Upstream{}, upstreams...)
+	}
+	return services
+}
+
+// Upstreams returns the discovered upstream servers of the given service.
+func (d *Discovery) Upstreams(service string) ([]balancer.Upstream, error) {
+	d.RLock()
+	defer d.RUnlock()
+	upstreams, ok := d.services[service]
+	if !ok {
+		return nil, ErrServiceNotFound
+	}
+	return append([]balancer.Upstream{}, upstreams...), nil
+}
+
+// Bind binds the given target to the given service, updating it
+// with the discovered upstream servers every time they change.
+func (d *Discovery) Bind(service string, target Target) error {
+	d.Lock()
+	defer d.Unlock()
+	if err := target.Update(d.services[service]); err != nil {
+		return err
+	}
+	d.targets[service] = append(d.targets[service], target)
+	return nil
+}
+
+// Unbind unbinds the given target from the given service.
+// Returns false if the target is not bound to the service,
+// or if the target cannot be compared, such as functions.
+func (d *Discovery) Unbind(service string, target Target) bool {
+	if !reflect.TypeOf(target).Comparable() {
+		return false
+	}
+	d.Lock()
+	defer d.Unlock()
+	for i, t := range d.targets[service] {
+		if t == target {
+			d.targets[service] = append(d.targets[service][:i], d.targets[service][i+1:]...)
+			if len(d.targets[service]) == 0 {
+				delete(d.targets, service)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Balancer creates a new balancer bound to the given discovered service.
+// The balancer is unbound once it's closed.
+func (d *Discovery) Balancer(service string, setters ...balancer.OptSetter) (*balancer.Balancer, error) {
+	upstreams, err := d.Upstreams(service)
+	if err != nil {
+		return nil, err
+	}
+	b, err := balancer.New(upstreams, setters...)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Bind(service, b); err != nil {
+		b.Close()
+		return nil, err
+	}
+	b.OnClose(func() { d.Unbind(service, b) })
+	return b, nil
+}
+
+// To returns an http.HandlerFunc who balances the incoming traffic
+// across the upstream servers of the given discovered service.
+func (d *Discovery) To(service string, setters ...balancer.OptSetter) func(w http.ResponseWriter, r *http.Request) {
+	b, err := d.Balancer(service, setters...)
+	if err != nil {
+		panic(err)
+	}
+	return b.ServeHTTP
+}
+
+// Refresh discovers the services, updating the targets bound to the changed services.
+func (d *Discovery) Refresh() error {
+	d.refresh.Lock()
+	defer d.refresh.Unlock()
+
+	services, err := d.provider.Services()
+	if err != nil {
+		return err
+	}
+
+	d.Lock()
+	changed := []string{}
+	for name := range d.targets {
+		if !reflect.DeepEqual(d.services[name], services[name]) {
+			changed = append(changed, name)
+		}
+	}
+	d.services = services
+	d.Unlock()
+
+	for _, name := range changed {
+		d.log.Infof("Service %v changed, upstreams: %v", name, len(services[name]))
+		d.RLock()
+		targets := append([]Target{}, d.targets[name]...)
+		d.RUnlock()
+		for _, target := range targets {
+			if err := target.Update(services[name]); err != nil {
+				d.log.Errorf("Cannot update service %v: %v", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Close stops refreshing the discovered services.
+func (d *Discovery) Close() error {
+	d.Lock()
+	defer d.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+	return nil
+}
+
+// watch refreshes the discovered services periodically until the given channel is closed.
+func (d *Discovery) watch(stop chan struct{}) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := d.Refresh(); err != nil {
+				d.log.Errorf("Cannot discover services: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package discovery
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+)
+
+func newServer(name string) *httptest.Server {
+	return testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestDiscoveryFile(t *testing.T) {
+	a, b := newServer("a"), newServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	dir, err := ioutil.TempDir("", "discovery")
+	st.Expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+	writeFile(t, path, `{"api": ["`+a.URL+`"]}`)
+
+	d, err := New(File(path), Interval(10*time.Millisecond))
+	st.Expect(t, err, nil)
+	defer d.Close()
+
+	lb, err := d.Balancer("api")
+	st.Expect(t, err, nil)
+	defer lb.Close()
+	proxy := httptest.NewServer(lb)
+	defer proxy.Close()
+
+	_, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "a")
+
+	writeFile(t, path, `{"api": ["`+b.URL+`"]}`)
+	deadline := time.Now().Add(time.Second)
+	for lb.Upstreams()[0].URL != b.URL && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_, body, err = testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "b")
+
+	writeFile(t, path, `{"web": ["`+b.URL+`"]}`)
+	st.Expect(t, d.Refresh(), nil)
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusServiceUnavailable)
+
+	_, err = d.Balancer("api")
+	st.Expect(t, err, ErrServiceNotFound)
+}
+
+func TestDiscoveryProviderError(t *testing.T) {
+	var fail bool
+	provider := ProviderFunc(func() (Services, error) {
+		if fail {
+			return nil, errors.New("unavailable")
+		}
+		return Services{"api": {{URL: "http://10.0.0.1"}}}, nil
+	})
+
+	d, err := New(provider)
+	st.Expect(t, err, nil)
+	defer d.Close()
+
+	fail = true
+	st.Reject(t, d.Refresh(), nil)
+	upstreams, err := d.Upstreams("api")
+	st.Expect(t, err, nil)
+	st.Expect(t, upstreams, []balancer.Upstream{{URL: "http://10.0.0.1"}})
+
+	_, err = New(provider)
+	st.Reject(t, err, nil)
+	_, err = New(provider, Interval(0))
+	st.Reject(t, err, nil)
+}
+
+func TestDiscoveryBind(t *testing.T) {
+	services := Services{"api": {{URL: "http://10.0.0.1"}}}
+	d, err := New(ProviderFunc(func() (Services, error) { return services, nil }))
+	st.Expect(t, err, nil)
+	defer d.Close()
+
+	updates := [][]balancer.Upstream{}
+	target := targetFunc(func(upstreams []balancer.Upstream) error {
+		updates = append(updates, upstreams)
+		return nil
+	})
+	st.Expect(t, d.Bind("api", target), nil)
+
+	st.Expect(t, d.Refresh(), nil)
+	st.Expect(t, len(updates), 1)
+
+	services = Services{"api": {{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2"}}}
+	st.Expect(t, d.Refresh(), nil)
+	st.Expect(t, len(updates), 2)
+	st.Expect(t, updates[1], services["api"])
+}
+
+func TestDiscoveryUnbind(t *testing.T) {
+	services := Services{"api": {{URL: "http://10.0.0.1"}}}
+	d, err := New(ProviderFunc(func() (Services, error) { return services, nil }))
+	st.Expect(t, err, nil)
+	defer d.Close()
+
+	lb, err := d.Balancer("api")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(d.targets["api"]), 1)
+
+	// Closed balancers are no longer updated
+	lb.Close()
+	st.Expect(t, len(d.targets["api"]), 0)
+	st.Expect(t, d.Unbind("api", lb), false)
+
+	services = Services{"api": {{URL: "http://10.0.0.2"}}}
+	st.Expect(t, d.Refresh(), nil)
+	st.Expect(t, lb.Upstreams()[0].URL, "http://10.0.0.1")
+
+	target := targetFunc(func(upstreams []balancer.Upstream) error { return nil })
+	st.Expect(t, d.Bind("api", target), nil)
+	st.Expect(t, d.Unbind("api", target), false)
+}
+
+// targetFunc implements the Target interface for testing.
+type targetFunc func(upstreams []balancer.Upstream) error
+
+func (f targetFunc) Update(upstreams []balancer.Upstream) error {
+	return f(upstreams)
+}
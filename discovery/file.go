@@ -0,0 +1,113 @@
+package discovery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/yaml.v2"
+)
+
+// fileProvider discovers the services defined in a local file.
+type fileProvider struct {
+	sync.Mutex
+	path     string
+	modTime  time.Time
+	size     int64
+	services Services
+}
+
+// File creates a provider who reads the services from the given JSON or YAML file,
+// such as {"api": ["http://10.0.0.1:8080", {"url": "http://10.0.0.2:8080", "weight": 2}]}.
+// YAML is used for files with the .yaml or .yml extension.
+// The file is only parsed again when modified.
+func File(path string) Provider {
+	return &fileProvider{path: path}
+}
+
+func (f *fileProvider) Services() (Services, error) {
+	f.Lock()
+	defer f.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if f.services != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.services, nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	services, err := ParseServices(data, filepath.Ext(f.path))
+	if err != nil {
+		return nil, fmt.Errorf("discovery: invalid services file %s: %s", f.path, err)
+	}
+	f.services, f.modTime, f.size = services, info.ModTime(), info.Size()
+	return services, nil
+}
+
+// ParseServices parses the given services definition, using YAML if the
+// given file extension is .yaml or .yml, otherwise JSON.
+func ParseServices(data []byte, ext string) (Services, error) {
+	definition := map[string][]endpoint{}
+	var err error
+	if ext == ".yaml" || ext == ".yml" {
+		err = yaml.Unmarshal(data, &definition)
+	} else {
+		err = json.Unmarshal(data, &definition)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	services := Services{}
+	for name, endpoints := range definition {
+		upstreams := []balancer.Upstream{}
+		for _, e := range endpoints {
+			if e.URL == "" {
+				return nil, errors.New("missing upstream URL in service: " + name)
+			}
+			if e.Weight < 0 {
+				return nil, errors.New("negative upstream weight in service: " + name)
+			}
+			upstreams = append(upstreams, balancer.Upstream(e))
+		}
+		services[name] = upstreams
+	}
+	return services, nil
+}
+
+// endpoint represents a service upstream definition,
+// either as URL string or as object with URL and weight.
+type endpoint balancer.Upstream
+
+func (e *endpoint) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.URL); err == nil {
+		return nil
+	}
+	return json.Unmarshal(data, (*balancer.Upstream)(e))
+}
+
+func (e *endpoint) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&e.URL); err == nil {
+		return nil
+	}
+	value := struct {
+		URL    string
+		Weight int
+	}{}
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	e.URL, e.Weight = value.URL, value.Weight
+	return nil
+}
@@ -0,0 +1,74 @@
+package discovery
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+)
+
+// writes counts the written services files, used to change the file modification time.
+var writes int
+
+// writeFile writes the given services file, changing its modification time.
+func writeFile(t *testing.T, path, data string) {
+	st.Expect(t, ioutil.WriteFile(path, []byte(data), 0644), nil)
+	writes++
+	modTime := time.Now().Add(time.Duration(writes) * time.Second)
+	st.Expect(t, os.Chtimes(path, modTime, modTime), nil)
+}
+
+func TestParseServicesJSON(t *testing.T) {
+	services, err := ParseServices([]byte(`{"api": ["http://10.0.0.1", {"url": "http://10.0.0.2", "weight": 2}], "web": []}`), ".json")
+	st.Expect(t, err, nil)
+	st.Expect(t, services, Services{
+		"api": {{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2", Weight: 2}},
+		"web": {},
+	})
+
+	_, err = ParseServices([]byte(`{"api": [{"weight": 2}]}`), ".json")
+	st.Reject(t, err, nil)
+	_, err = ParseServices([]byte(`{"api": [{"url": "http://10.0.0.1", "weight": -1}]}`), ".json")
+	st.Reject(t, err, nil)
+	_, err = ParseServices([]byte(`["http://10.0.0.1"]`), ".json")
+	st.Reject(t, err, nil)
+}
+
+func TestParseServicesYAML(t *testing.T) {
+	data := "api:\n  - http://10.0.0.1\n  - url: http://10.0.0.2\n    weight: 2\n"
+	services, err := ParseServices([]byte(data), ".yaml")
+	st.Expect(t, err, nil)
+	st.Expect(t, services, Services{"api": {{URL: "http://10.0.0.1"}, {URL: "http://10.0.0.2", Weight: 2}}})
+
+	_, err = ParseServices([]byte("api: foo"), ".yml")
+	st.Reject(t, err, nil)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	st.Expect(t, err, nil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "services.json")
+
+	_, err = File(path).Services()
+	st.Reject(t, err, nil)
+
+	writeFile(t, path, `{"api": ["http://10.0.0.1"]}`)
+	provider := File(path)
+	services, err := provider.Services()
+	st.Expect(t, err, nil)
+	st.Expect(t, services["api"], []balancer.Upstream{{URL: "http://10.0.0.1"}})
+
+	writeFile(t, path, `{"api": ["http://10.0.0.1", "http://10.0.0.2"]}`)
+	services, err = provider.Services()
+	st.Expect(t, err, nil)
+	st.Expect(t, len(services["api"]), 2)
+
+	writeFile(t, path, `{"api": [`)
+	_, err = provider.Services()
+	st.Reject(t, err, nil)
+}
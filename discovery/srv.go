@@ -0,0 +1,91 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+)
+
+// DefaultSRVTimeout stores the default maximum time to resolve the DNS SRV records.
+var DefaultSRVTimeout = 5 * time.Second
+
+// srvProvider discovers the services via DNS SRV records.
+type srvProvider struct {
+	names    map[string]string
+	resolver *net.Resolver
+}
+
+// SRV creates a provider who resolves the DNS SRV records of the given services,
+// such as {"api": "_http._tcp.api.service.consul"}, using the given DNS server address,
+// such as "10.0.0.2:53", or the system resolver if empty.
+// Only the records with the lowest priority are used, weighted by the record weight.
+// The upstream URLs use HTTPS if the record service label is _https, otherwise HTTP.
+func SRV(server string, names map[string]string) Provider {
+	resolver := net.DefaultResolver
+	if server != "" {
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server)
+			},
+		}
+	}
+	return &srvProvider{names: names, resolver: resolver}
+}
+
+func (s *srvProvider) Services() (Services, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultSRVTimeout)
+	defer cancel()
+
+	services := Services{}
+	for service, name := range s.names {
+		_, records, err := s.resolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		scheme := "http"
+		if strings.HasPrefix(name, "_https.") {
+			scheme = "https"
+		}
+		services[service] = srvUpstreams(scheme, records)
+	}
+	return services, nil
+}
+
+// srvUpstreams returns the upstream servers of the given SRV records with the lowest priority,
+// sorted by URL, since the resolver shuffles the records with the same priority.
+func srvUpstreams(scheme string, records []*net.SRV) []balancer.Upstream {
+	upstreams := []balancer.Upstream{}
+	priority := lowestPriority(records)
+	for _, record := range records {
+		if record.Priority != priority {
+			continue
+		}
+		host := strings.TrimSuffix(record.Target, ".")
+		upstream := balancer.Upstream{
+			URL:    scheme + "://" + net.JoinHostPort(host, strconv.Itoa(int(record.Port))),
+			Weight: int(record.Weight),
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Slice(upstreams, func(i, j int) bool {
+		return upstreams[i].URL < upstreams[j].URL
+	})
+	return upstreams
+}
+
+// lowestPriority returns the lowest priority of the given SRV records.
+func lowestPriority(records []*net.SRV) uint16 {
+	var priority uint16
+	for i, record := range records {
+		if i == 0 || record.Priority < priority {
+			priority = record.Priority
+		}
+	}
+	return priority
+}
@@ -0,0 +1,89 @@
+package discovery
+
+import (
+	"net"
+	"testing"
+
+	"github.com/nbio/st"
+	"golang.org/x/net/dns/dnsmessage"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+)
+
+// newDNSServer creates a test DNS server who replies with the given SRV records.
+func newDNSServer(t *testing.T, records []dnsmessage.SRVResource) net.PacketConn {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	st.Expect(t, err, nil)
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			res := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.Header.ID, Response: true, Authoritative: true},
+				Questions: req.Questions,
+			}
+			for _, q := range req.Questions {
+				if q.Type != dnsmessage.TypeSRV {
+					continue
+				}
+				for i := range records {
+					res.Answers = append(res.Answers, dnsmessage.Resource{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeSRV, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &records[i],
+					})
+				}
+			}
+			packet, err := res.Pack()
+			if err == nil {
+				conn.WriteTo(packet, addr)
+			}
+		}
+	}()
+	return conn
+}
+
+func TestSRV(t *testing.T) {
+	server := newDNSServer(t, []dnsmessage.SRVResource{
+		{Priority: 10, Weight: 3, Port: 8080, Target: dnsmessage.MustNewName("a.example.com.")},
+		{Priority: 20, Weight: 1, Port: 8080, Target: dnsmessage.MustNewName("b.example.com.")},
+	})
+	defer server.Close()
+
+	provider := SRV(server.LocalAddr().String(), map[string]string{"api": "_https._tcp.api.example.com"})
+	services, err := provider.Services()
+	st.Expect(t, err, nil)
+	st.Expect(t, services, Services{"api": {{URL: "https://a.example.com:8080", Weight: 3}}})
+}
+
+func TestSRVUpstreams(t *testing.T) {
+	records := []*net.SRV{
+		{Target: "a.example.com.", Port: 80, Priority: 1, Weight: 0},
+		{Target: "b.example.com.", Port: 81, Priority: 1, Weight: 5},
+		{Target: "c.example.com.", Port: 82, Priority: 2, Weight: 5},
+	}
+	st.Expect(t, srvUpstreams("http", records), []balancer.Upstream{
+		{URL: "http://a.example.com:80"},
+		{URL: "http://b.example.com:81", Weight: 5},
+	})
+}
+
+func TestSRVUpstreamsShuffled(t *testing.T) {
+	a := &net.SRV{Target: "a.example.com.", Port: 80, Priority: 1, Weight: 1}
+	b := &net.SRV{Target: "b.example.com.", Port: 80, Priority: 1, Weight: 2}
+	c := &net.SRV{Target: "c.example.com.", Port: 80, Priority: 1, Weight: 3}
+	d := &net.SRV{Target: "d.example.com.", Port: 80, Priority: 2, Weight: 3}
+
+	upstreams := srvUpstreams("http", []*net.SRV{a, b, c, d})
+	st.Expect(t, len(upstreams), 3)
+	for _, records := range [][]*net.SRV{{c, a, b, d}, {b, c, a, d}, {d, c, b, a}} {
+		st.Expect(t, srvUpstreams("http", records), upstreams)
+	}
+}
@@ -0,0 +1,100 @@
+package forward
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventStreamMIME stores the Server-Sent Events content type.
+const EventStreamMIME = "text/event-stream"
+
+// isStreamingResponse reports whether the given upstream response must be
+// flushed to the client as soon as data arrives, such as Server-Sent Events
+// or responses with unknown length (chunked and long-polling responses).
+func isStreamingResponse(res *http.Response) bool {
+	if res.ContentLength == -1 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	return mediaType == EventStreamMIME
+}
+
+// flushWriter wraps a response writer flushing the written
+// data to the client periodically or after every write.
+type flushWriter struct {
+	dst     io.Writer
+	flusher http.Flusher
+	// latency is non-zero, negative means flush after every write.
+	latency time.Duration
+
+	// mu protects the timer, the pending flag and the flusher calls.
+	mu      sync.Mutex
+	timer   *time.Timer
+	pending bool
+}
+
+// newFlushWriter creates a new writer who flushes the data written to
+// the given http.ResponseWriter based on the given flush interval.
+// Returns nil if the writer cannot be flushed or no flush is required.
+func newFlushWriter(w http.ResponseWriter, latency time.Duration) *flushWriter {
+	flusher, ok := w.(http.Flusher)
+	if !ok || latency == 0 {
+		return nil
+	}
+	return &flushWriter{dst: w, flusher: flusher, latency: latency}
+}
+
+// Write writes the given data and schedules the flush.
+func (w *flushWriter) Write(buf []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	n, err := w.dst.Write(buf)
+	if w.latency < 0 {
+		w.flusher.Flush()
+		return n, err
+	}
+	if w.pending {
+		return n, err
+	}
+	if w.timer == nil {
+		w.timer = time.AfterFunc(w.latency, w.delayedFlush)
+	} else {
+		w.timer.Reset(w.latency)
+	}
+	w.pending = true
+	return n, err
+}
+
+// Flush flushes the response headers or any pending data immediately.
+func (w *flushWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flusher.Flush()
+	w.pending = false
+}
+
+// delayedFlush is called by the timer to flush the pending data.
+func (w *flushWriter) delayedFlush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.pending {
+		return
+	}
+	w.flusher.Flush()
+	w.pending = false
+}
+
+// stop stops the flush timer, if any.
+// Pending data is expected to be flushed by the HTTP server.
+func (w *flushWriter) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = false
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
@@ -0,0 +1,127 @@
+package forward
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+func TestForwardEventStream(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Header().Set("Content-Length", "64")
+		w.Write([]byte("data: hello\n\n"))
+		w.(http.Flusher).Flush()
+		<-done
+	})
+	defer srv.Close()
+
+	f, err := New()
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+	defer close(done)
+
+	res, err := http.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	defer res.Body.Close()
+	st.Expect(t, res.StatusCode, http.StatusOK)
+
+	line, err := readLine(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, line, "data: hello\n")
+}
+
+func TestForwardChunkedStream(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-done
+	})
+	defer srv.Close()
+
+	f, err := New()
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+	defer close(done)
+
+	res, err := http.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	defer res.Body.Close()
+
+	line, err := readLine(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, line, "first\n")
+}
+
+func TestForwardFlushInterval(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Length", "12")
+		w.Write([]byte("hello\n"))
+		w.(http.Flusher).Flush()
+		<-done
+		w.Write([]byte("world\n"))
+	})
+	defer srv.Close()
+
+	f, err := New(FlushInterval(10 * time.Millisecond))
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	defer res.Body.Close()
+	st.Expect(t, res.ContentLength, int64(12))
+
+	line, err := readLine(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, line, "hello\n")
+
+	close(done)
+	body, err := ioutil.ReadAll(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "world\n")
+}
+
+// readLine reads a single line from the given reader,
+// failing if no data is received in a reasonable time.
+func readLine(r io.Reader) (string, error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := bufio.NewReader(r).ReadString('\n')
+		ch <- result{line, err}
+	}()
+	select {
+	case res := <-ch:
+		return res.line, res.err
+	case <-time.After(time.Second):
+		return "", io.ErrNoProgress
+	}
+}
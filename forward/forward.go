@@ -4,8 +4,14 @@
 package forward
 
 import (
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"gopkg.in/vinxi/vinxi.v0/utils"
 )
@@ -15,6 +21,22 @@ type ReqRewriter interface {
 	Rewrite(r *http.Request)
 }
 
+// RespModifier can alter the upstream response status, headers and body
+// before it is written to the client.
+// If the body is replaced, the Content-Length header and field
+// must be updated accordingly.
+type RespModifier interface {
+	Modify(res *http.Response) error
+}
+
+// RespModifierFunc represents the function interface for response modifiers.
+type RespModifierFunc func(res *http.Response) error
+
+// Modify calls f(res).
+func (f RespModifierFunc) Modify(res *http.Response) error {
+	return f(res)
+}
+
 // OptSetter represents the forwarder setter function.
 type OptSetter func(f *Forwarder) error
 
@@ -27,6 +49,45 @@ func PassHostHeader(b bool) OptSetter {
 	}
 }
 
+// Target defines the server URL to forward the incoming traffic.
+// The URL base path is joined with the incoming request path and
+// the URL query params, if any, are merged with the request query params.
+// Servers listening on Unix domain sockets are supported via the UnixScheme.
+func Target(uri string) OptSetter {
+	return func(f *Forwarder) error {
+		if strings.HasPrefix(uri, UnixScheme+"://") {
+			target, socket, err := unixTarget(uri)
+			if err != nil {
+				return err
+			}
+			f.target = target
+			f.httpForwarder.unixSocket = socket
+			f.websocketForwarder.unixSocket = socket
+			return nil
+		}
+
+		target, err := url.Parse(uri)
+		if err != nil {
+			return err
+		}
+		if target.Host == "" {
+			return errors.New("forward: target URL must be absolute: " + uri)
+		}
+		f.target = target
+		return nil
+	}
+}
+
+// StripPrefix defines a path prefix, such as the matched route prefix,
+// to be removed from the incoming request path before forwarding it.
+// The prefix is only removed if it matches complete path segments.
+func StripPrefix(prefix string) OptSetter {
+	return func(f *Forwarder) error {
+		f.stripPrefix = prefix
+		return nil
+	}
+}
+
 // RoundTripper sets a new http.RoundTripper
 // Forwarder will use http.DefaultTransport as a default round tripper
 func RoundTripper(r http.RoundTripper) OptSetter {
@@ -36,6 +97,18 @@ func RoundTripper(r http.RoundTripper) OptSetter {
 	}
 }
 
+// FlushInterval specifies the interval to flush the response body to the client
+// while copying it from the upstream server.
+// A zero value disables periodic flushing, while a negative value flushes
+// immediately after each write.
+// Server-Sent Events and responses without Content-Length are always flushed immediately.
+func FlushInterval(interval time.Duration) OptSetter {
+	return func(f *Forwarder) error {
+		f.httpForwarder.flushInterval = interval
+		return nil
+	}
+}
+
 // Rewriter defines a request rewriter for the HTTP forwarder
 func Rewriter(r ReqRewriter) OptSetter {
 	return func(f *Forwarder) error {
@@ -44,6 +117,16 @@ func Rewriter(r ReqRewriter) OptSetter {
 	}
 }
 
+// ResponseModifier defines an upstream response modifier for the HTTP forwarder.
+// If the modifier returns an error, the response is discarded and the error
+// is passed to the error handler.
+func ResponseModifier(m RespModifier) OptSetter {
+	return func(f *Forwarder) error {
+		f.httpForwarder.modifier = m
+		return nil
+	}
+}
+
 // WebsocketRewriter defines a request rewriter for the websocket forwarder
 func WebsocketRewriter(r ReqRewriter) OptSetter {
 	return func(f *Forwarder) error {
@@ -52,6 +135,51 @@ func WebsocketRewriter(r ReqRewriter) OptSetter {
 	}
 }
 
+// WebsocketTimeout defines the websocket forwarder timeouts.
+// Zero values are replaced by the default timeouts.
+func WebsocketTimeout(timeouts WebsocketTimeouts) OptSetter {
+	return func(f *Forwarder) error {
+		if timeouts.Dial < 0 || timeouts.Handshake < 0 || timeouts.Idle < 0 || timeouts.Close < 0 {
+			return errors.New("forward: websocket timeouts cannot be negative")
+		}
+		f.websocketForwarder.timeouts = timeouts
+		return nil
+	}
+}
+
+// WebsocketTLSConfig defines the TLS config used to dial secure websocket upstream servers.
+// It takes precedence over the upstream TLS options, such as ClientCertificate.
+func WebsocketTLSConfig(config *tls.Config) OptSetter {
+	return func(f *Forwarder) error {
+		f.websocketForwarder.TLSClientConfig = config
+		return nil
+	}
+}
+
+// WebsocketInterception enables the frame-aware websocket mode, calling the given
+// interceptor for every message exchanged in both directions.
+// In frame-aware mode websocket extensions, such as compression, are not negotiated.
+func WebsocketInterception(i WebsocketInterceptor) OptSetter {
+	return func(f *Forwarder) error {
+		f.websocketForwarder.interceptor = i
+		return nil
+	}
+}
+
+// WebsocketMaxMessageSize defines the maximum websocket message size in bytes.
+// Connections exceeding it are closed with a message too big status.
+// Setting it enables the frame-aware websocket mode.
+// Defaults to DefaultWebsocketMaxMessageSize in frame-aware mode.
+func WebsocketMaxMessageSize(size int64) OptSetter {
+	return func(f *Forwarder) error {
+		if size < 0 {
+			return errors.New("forward: websocket max message size cannot be negative")
+		}
+		f.websocketForwarder.maxMessageSize = size
+		return nil
+	}
+}
+
 // ErrorHandler is a functional argument that sets error handler of the server
 func ErrorHandler(h utils.ErrorHandler) OptSetter {
 	return func(f *Forwarder) error {
@@ -75,6 +203,13 @@ type Forwarder struct {
 	*httpForwarder
 	*websocketForwarder
 	*handlerContext
+	target          *url.URL
+	stripPrefix     string
+	forwardProxy    bool
+	forwardedHeader bool
+	trustedProxies  []*net.IPNet
+	tlsConfig       *tls.Config
+	via             *string
 }
 
 // handlerContext defines a handler context for error reporting and logging
@@ -95,15 +230,74 @@ func New(setters ...OptSetter) (*Forwarder, error) {
 			return nil, err
 		}
 	}
+	if f.forwardProxy && f.target != nil {
+		return nil, errors.New("forward: target cannot be defined in forward proxy mode")
+	}
 	if f.httpForwarder.roundTripper == nil {
 		f.httpForwarder.roundTripper = utils.DefaultTransport
 	}
-	if f.httpForwarder.rewriter == nil {
+	if f.tlsConfig != nil {
+		rt, err := transportWithTLSConfig(f.httpForwarder.roundTripper, f.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		f.httpForwarder.roundTripper = rt
+		if f.websocketForwarder.TLSClientConfig == nil {
+			f.websocketForwarder.TLSClientConfig = f.tlsConfig
+		}
+	}
+	if socket := f.httpForwarder.unixSocket; socket != "" {
+		rt, err := transportWithUnixSocket(f.httpForwarder.roundTripper, socket)
+		if err != nil {
+			return nil, err
+		}
+		f.httpForwarder.roundTripper = rt
+	}
+	rt, err := transportWithTimeouts(f.httpForwarder.roundTripper, f.httpForwarder.timeouts)
+	if err != nil {
+		return nil, err
+	}
+	if f.httpForwarder.proxyProtocol != 0 {
+		if f.target != nil && f.target.Scheme == H2CScheme {
+			return nil, errors.New("forward: PROXY protocol is not supported with h2c targets")
+		}
+		if rt, err = transportWithProxyProtocol(rt, f.httpForwarder.proxyProtocol); err != nil {
+			return nil, err
+		}
+	}
+	if f.httpForwarder.h2cTransport == nil {
+		f.httpForwarder.h2cTransport = h2cTransportWithTimeouts(f.httpForwarder.timeouts)
+	}
+	f.httpForwarder.roundTripper = &protocolTransport{http: rt, h2c: f.httpForwarder.h2cTransport}
+	if f.httpForwarder.rewriter == nil || f.websocketForwarder.rewriter == nil {
 		h, err := os.Hostname()
 		if err != nil {
 			h = "localhost"
 		}
-		f.httpForwarder.rewriter = &HeaderRewriter{TrustForwardHeader: true, Hostname: h}
+		rewriter := &HeaderRewriter{
+			TrustForwardHeader: len(f.trustedProxies) == 0,
+			TrustedProxies:     f.trustedProxies,
+			Forwarded:          f.forwardedHeader,
+			Hostname:           h,
+		}
+		if f.httpForwarder.rewriter == nil {
+			f.httpForwarder.rewriter = rewriter
+		}
+		if f.websocketForwarder.rewriter == nil {
+			f.websocketForwarder.rewriter = rewriter
+		}
+	}
+	if f.websocketForwarder.timeouts.Dial == 0 {
+		f.websocketForwarder.timeouts.Dial = DefaultWebsocketDialTimeout
+	}
+	if f.websocketForwarder.timeouts.Handshake == 0 {
+		f.websocketForwarder.timeouts.Handshake = DefaultWebsocketHandshakeTimeout
+	}
+	if f.websocketForwarder.timeouts.Close == 0 {
+		f.websocketForwarder.timeouts.Close = DefaultWebsocketCloseTimeout
+	}
+	if f.websocketForwarder.interceptor != nil && f.websocketForwarder.maxMessageSize == 0 {
+		f.websocketForwarder.maxMessageSize = DefaultWebsocketMaxMessageSize
 	}
 	if f.log == nil {
 		f.log = utils.NullLogger
@@ -114,9 +308,57 @@ func New(setters ...OptSetter) (*Forwarder, error) {
 	return f, nil
 }
 
+// RoundTripper returns the round tripper used to reach the upstream servers,
+// who dials the Unix domain socket of unix targets and speaks HTTP/2
+// with the requests whose URL scheme is H2CScheme.
+func (f *Forwarder) RoundTripper() http.RoundTripper {
+	return f.httpForwarder.roundTripper
+}
+
+// TrustedProxies returns the networks of the proxies whose forwarding headers are trusted.
+func (f *Forwarder) TrustedProxies() []*net.IPNet {
+	return f.trustedProxies
+}
+
 // ServeHTTP decides which forwarder to use based on the specified
 // request and delegates to the proper implementation
 func (f *Forwarder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	utils.EnsureRequestID(req)
+	via := f.viaPseudonym(req)
+	if via != "" {
+		if isLoop(req, via) {
+			f.log.Errorf("Proxy loop detected: %v %v, request ID: %v", req.Method, req.URL, utils.RequestID(req))
+			f.errHandler.ServeHTTP(w, req, utils.ErrLoopDetected)
+			return
+		}
+		appendVia(req, via)
+	}
+	// The resolved pseudonym is also used in the upstream response Via header
+	if pseudonym, ok := RequestViaPseudonym(req); !ok || pseudonym != via {
+		req = WithViaPseudonym(req, via)
+	}
+	if f.forwardProxy {
+		if req.Method == http.MethodConnect {
+			f.serveConnect(w, req, f.handlerContext)
+			return
+		}
+		if !req.URL.IsAbs() {
+			f.log.Infof("Rejecting non proxy request: %v", req.RequestURI)
+			utils.RenderError(w, req, http.StatusBadRequest, ErrNotProxyRequest)
+			return
+		}
+	}
+	if f.stripPrefix != "" {
+		stripPathPrefix(req.URL, f.stripPrefix)
+	}
+	if f.target != nil {
+		rewriteTarget(req, f.target)
+		// Do not pass client Host header unless optsetter PassHostHeader is set.
+		if !f.passHost {
+			req.Host = f.target.Host
+		}
+	}
+
 	if utils.IsWebsocketRequest(req) {
 		f.websocketForwarder.serveHTTP(w, req, f.handlerContext)
 	} else {
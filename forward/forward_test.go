@@ -291,7 +291,9 @@ func (s *FwdSuite) TestChunkedResponseConversion(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(string(body), Equals, "testtest1test2")
 	c.Assert(re.StatusCode, Equals, http.StatusOK)
-	c.Assert(re.Header.Get("Content-Length"), Equals, fmt.Sprintf("%d", len("testtest1test2")))
+	// Responses with unknown length are streamed to the client
+	c.Assert(re.Header.Get("Content-Length"), Equals, "")
+	c.Assert(re.TransferEncoding, DeepEquals, []string{"chunked"})
 }
 
 func (s *FwdSuite) TestDetectsWebsocketRequest(c *C) {
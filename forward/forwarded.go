@@ -0,0 +1,182 @@
+package forward
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// forwardedElement stores the parameters of a RFC 7239 Forwarded header element.
+type forwardedElement map[string]string
+
+// TrustedProxies defines the networks of the proxies whose forwarding headers
+// are trusted by the default header rewriter, as CIDR notation or IP addresses.
+// Forwarding headers sent by any other client are replaced or dropped.
+func TrustedProxies(networks ...string) OptSetter {
+	return func(f *Forwarder) error {
+		trusted, err := ParseNetworks(networks...)
+		if err != nil {
+			return err
+		}
+		f.trustedProxies = trusted
+		return nil
+	}
+}
+
+// ForwardedHeader enables parsing and setting the RFC 7239 Forwarded header
+// in the default header rewriter, along with the X-Forwarded-* headers.
+func ForwardedHeader() OptSetter {
+	return func(f *Forwarder) error {
+		f.forwardedHeader = true
+		return nil
+	}
+}
+
+// ClientIP returns the real client IP of the given request, which is the closest
+// address in the forwarding chain who is not one of the given trusted proxies.
+// Forwarding headers are only read if the peer is a trusted proxy,
+// so the peer IP is returned if no trusted proxies are given.
+func ClientIP(req *http.Request, trustedProxies []*net.IPNet) string {
+	peerIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	rw := &HeaderRewriter{TrustedProxies: trustedProxies}
+	chain := []string{}
+	if rw.isTrustedProxy(peerIP) {
+		chain = rw.forwardedFor(req, parseForwarded(req.Header[Forwarded]))
+	}
+	return rw.clientIP(append(chain, peerIP))
+}
+
+// ParseNetworks parses the given list of CIDR networks or IP addresses.
+func ParseNetworks(networks ...string) ([]*net.IPNet, error) {
+	list := []*net.IPNet{}
+	for _, value := range networks {
+		value = strings.TrimSpace(value)
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, &net.ParseError{Type: "IP address", Text: value}
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, network)
+	}
+	return list, nil
+}
+
+// parseForwarded parses the elements of the given Forwarded header values.
+// Parameter names are case insensitive and quoted values are unquoted.
+func parseForwarded(values []string) []forwardedElement {
+	elements := []forwardedElement{}
+	for _, value := range values {
+		for _, raw := range splitQuoted(value, ',') {
+			element := forwardedElement{}
+			for _, pair := range splitQuoted(raw, ';') {
+				parts := strings.SplitN(pair, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				key := strings.ToLower(strings.TrimSpace(parts[0]))
+				element[key] = unquote(strings.TrimSpace(parts[1]))
+			}
+			if len(element) > 0 {
+				elements = append(elements, element)
+			}
+		}
+	}
+	return elements
+}
+
+// formatForwarded formats the Forwarded header element for the given request data.
+func formatForwarded(clientIP, host, proto string) string {
+	params := []string{}
+	if clientIP != "" {
+		node := clientIP
+		if strings.Contains(node, ":") {
+			node = "[" + node + "]"
+		}
+		params = append(params, "for="+quote(node))
+	}
+	if host != "" {
+		params = append(params, "host="+quote(host))
+	}
+	return strings.Join(append(params, "proto="+proto), ";")
+}
+
+// forwardedNodeIP returns the IP address of the given Forwarded node identifier,
+// removing the optional port and IPv6 brackets.
+func forwardedNodeIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+	}
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+	return node
+}
+
+// splitQuoted splits the given string by the given separator, ignoring separators in quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	parts := []string{}
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quoted:
+			i++
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// quote returns the given value as quoted string if it is not a valid token.
+func quote(value string) string {
+	for i := 0; i < len(value); i++ {
+		if !isTokenChar(value[i]) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+		}
+	}
+	return value
+}
+
+// unquote returns the unquoted value of the given quoted string.
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	value = value[1 : len(value)-1]
+	unquoted := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+1 < len(value) {
+			i++
+		}
+		unquoted = append(unquoted, value[i])
+	}
+	return string(unquoted)
+}
+
+// isTokenChar checks if the given byte is a valid RFC 7230 token character.
+func isTokenChar(c byte) bool {
+	if c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' {
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
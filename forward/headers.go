@@ -9,6 +9,12 @@ const (
 	XForwardedHost = "X-Forwarded-Host"
 	// XForwardedServer stores the forward server header key.
 	XForwardedServer = "X-Forwarded-Server"
+	// XRealIP stores the real client IP header key.
+	XRealIP = "X-Real-Ip"
+	// Forwarded stores the RFC 7239 forwarded header key.
+	Forwarded = "Forwarded"
+	// Via stores the via header key.
+	Via = "Via"
 	// Connection stores the connection header key.
 	Connection = "Connection"
 	// KeepAlive stores the keep alive header key.
@@ -17,6 +23,8 @@ const (
 	ProxyAuthenticate = "Proxy-Authenticate"
 	// ProxyAuthorization stores the proxy authorization header key.
 	ProxyAuthorization = "Proxy-Authorization"
+	// ProxyConnection stores the non-standard proxy connection header key.
+	ProxyConnection = "Proxy-Connection"
 	// Te stores the proxy TE header key.
 	Te = "Te" // canonicalized version of "TE"
 	// Trailers stores the trailers header key.
@@ -27,6 +35,8 @@ const (
 	Upgrade = "Upgrade"
 	// ContentLength stores the content length header key.
 	ContentLength = "Content-Length"
+	// SecWebsocketExtensions stores the websocket extensions header key.
+	SecWebsocketExtensions = "Sec-Websocket-Extensions"
 )
 
 // HopHeaders stores the hop-by-hop headers.
@@ -37,6 +47,7 @@ var HopHeaders = []string{
 	KeepAlive,
 	ProxyAuthenticate,
 	ProxyAuthorization,
+	ProxyConnection,
 	Te, // canonicalized version of "TE"
 	Trailers,
 	TransferEncoding,
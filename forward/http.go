@@ -4,7 +4,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"time"
 
 	"gopkg.in/vinxi/vinxi.v0/utils"
@@ -13,20 +12,39 @@ import (
 // httpForwarder is a handler that can reverse proxy
 // HTTP traffic
 type httpForwarder struct {
-	roundTripper http.RoundTripper
-	rewriter     ReqRewriter
-	passHost     bool
+	roundTripper  http.RoundTripper
+	h2cTransport  http.RoundTripper
+	rewriter      ReqRewriter
+	modifier      RespModifier
+	retry         *RetryPolicy
+	timeouts      Timeouts
+	passHost      bool
+	flushInterval time.Duration
+	proxyProtocol int
+	unixSocket    string
+	observers     []Observer
 }
 
 // serveHTTP forwards HTTP traffic using the configured transport
 func (f *httpForwarder) serveHTTP(w http.ResponseWriter, req *http.Request, ctx *handlerContext) {
+	// Abort the upstream request if the client disconnects or times out
+	reqCtx, cancel := f.requestContext(req)
+	defer cancel()
+	if f.proxyProtocol != 0 {
+		reqCtx = withProxyHeader(reqCtx, req, f.proxyProtocol)
+	}
+
+	obs, outReq := newObservation(f.observers, f.copyRequest(req, req.URL).WithContext(reqCtx))
+
 	start := time.Now().UTC()
-	response, err := f.roundTripper.RoundTrip(f.copyRequest(req, req.URL))
+	response, err := f.roundTrip(outReq, ctx)
 	if err != nil {
-		ctx.log.Errorf("Error forwarding to %v, err: %v", req.URL, err)
+		ctx.log.Errorf("Error forwarding to %v, err: %v, request ID: %v", req.URL, err, utils.RequestID(req))
+		obs.done(0, err)
 		ctx.errHandler.ServeHTTP(w, req, err)
 		return
 	}
+	obs.response(response)
 
 	if req.TLS != nil {
 		ctx.log.Infof("Round trip: %v, code: %v, duration: %v tls:version: %x, tls:resume:%t, tls:csuite:%x, tls:server:%v",
@@ -40,20 +58,91 @@ func (f *httpForwarder) serveHTTP(w http.ResponseWriter, req *http.Request, ctx
 			req.URL, response.StatusCode, time.Now().UTC().Sub(start))
 	}
 
+	defer response.Body.Close()
+
+	if f.modifier != nil {
+		if err := f.modifier.Modify(response); err != nil {
+			ctx.log.Errorf("Error modifying upstream response: %v, request ID: %v", err, utils.RequestID(req))
+			obs.done(0, err)
+			ctx.errHandler.ServeHTTP(w, req, err)
+			return
+		}
+		// The modifier could replace the body, so make sure we close it too
+		defer response.Body.Close()
+	}
+
+	if via, _ := RequestViaPseudonym(req); via != "" {
+		appendResponseVia(response, via)
+	}
 	utils.CopyHeaders(w.Header(), response.Header)
+	announced := announceTrailers(w.Header(), response.Trailer)
 	w.WriteHeader(response.StatusCode)
-	written, err := io.Copy(w, response.Body)
-	defer response.Body.Close()
 
+	written, err := f.copyResponse(w, response)
 	if err != nil {
-		ctx.log.Errorf("Error copying upstream response Body: %v", err)
+		ctx.log.Errorf("Error copying upstream response Body: %v, request ID: %v", err, utils.RequestID(req))
+		obs.done(written, err)
 		ctx.errHandler.ServeHTTP(w, req, err)
 		return
 	}
 
-	if written != 0 {
-		w.Header().Set(ContentLength, strconv.FormatInt(written, 10))
+	// Trailers are only available once the body has been consumed
+	copyTrailers(w.Header(), response.Trailer, announced)
+	obs.done(written, nil)
+}
+
+// announceTrailers declares the upstream response trailers known
+// before reading the body, returning the number of declared trailers.
+func announceTrailers(h http.Header, trailer http.Header) int {
+	h.Del("Trailer")
+	for key := range trailer {
+		h.Add("Trailer", key)
+	}
+	return len(trailer)
+}
+
+// copyTrailers copies the upstream response trailers to the client response headers.
+// Trailers not declared before writing the response headers,
+// such as gRPC status trailers, are sent using the http.TrailerPrefix.
+func copyTrailers(h http.Header, trailer http.Header, announced int) {
+	if len(trailer) == announced {
+		utils.CopyHeaders(h, trailer)
+		return
+	}
+	for key, values := range trailer {
+		h[http.TrailerPrefix+key] = append([]string{}, values...)
+	}
+}
+
+// roundTrip performs the upstream round trip of the given request,
+// retrying it if a retry policy has been configured.
+func (f *httpForwarder) roundTrip(req *http.Request, ctx *handlerContext) (*http.Response, error) {
+	if f.retry == nil {
+		return f.roundTripper.RoundTrip(req)
+	}
+	return f.retryRoundTrip(req, ctx)
+}
+
+// copyResponse copies the upstream response body to the client,
+// flushing the written data based on the configured flush interval.
+// Streaming responses, such as Server-Sent Events, are flushed immediately.
+func (f *httpForwarder) copyResponse(w http.ResponseWriter, res *http.Response) (int64, error) {
+	latency := f.flushInterval
+	if isStreamingResponse(res) {
+		latency = -1
+	}
+
+	fw := newFlushWriter(w, latency)
+	if fw == nil {
+		return io.Copy(w, res.Body)
 	}
+	defer fw.stop()
+
+	// Send the response headers to the client before the body is available
+	if latency < 0 {
+		fw.Flush()
+	}
+	return io.Copy(fw, res.Body)
 }
 
 // copyRequest makes a copy of the specified request to be sent using the configured
@@ -64,21 +153,25 @@ func (f *httpForwarder) copyRequest(req *http.Request, u *url.URL) *http.Request
 
 	outReq.URL = utils.CopyURL(req.URL)
 	outReq.URL.Host = u.Host
-	outReq.URL.Opaque = req.RequestURI
 	outReq.URL.Scheme = u.Scheme
 	if outReq.URL.Scheme == "" {
 		outReq.URL.Scheme = "http"
 	}
-	// raw query is already included in RequestURI, so ignore it to avoid dupes
-	outReq.URL.RawQuery = ""
+	// The escaped path and query are sent as is, so ignore the opaque data
+	outReq.URL.Opaque = ""
+	// Use the raw request URI if the request URL only defines the target server
+	if outReq.URL.Path == "" && outReq.URL.RawQuery == "" {
+		if uri, err := url.ParseRequestURI(req.RequestURI); err == nil {
+			outReq.URL.Path = uri.Path
+			outReq.URL.RawPath = uri.RawPath
+			outReq.URL.RawQuery = uri.RawQuery
+		}
+	}
 	// Do not pass client Host header unless optsetter PassHostHeader is set.
 	if !f.passHost {
 		outReq.Host = u.Host
 	}
-	outReq.Proto = "HTTP/1.1"
-	outReq.ProtoMajor = 1
-	outReq.ProtoMinor = 1
-
+	// The upstream protocol version is negotiated by the transport
 	// Overwrite close flag so we can keep persistent connection for the backend servers
 	outReq.Close = false
 
@@ -0,0 +1,53 @@
+package forward
+
+import (
+	"net/http"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// H2CScheme defines the target URL scheme used to forward requests to HTTP/2
+// upstream servers over cleartext TCP connections, using prior knowledge.
+// HTTP/2 over TLS is negotiated via ALPN with regular https targets.
+const H2CScheme = "h2c"
+
+// H2CRoundTripper sets the http.RoundTripper used to forward requests to h2c targets.
+// Forwarder will use utils.DefaultH2CTransport as a default h2c round tripper,
+// multiplexing the requests to the same host over a single connection.
+func H2CRoundTripper(r http.RoundTripper) OptSetter {
+	return func(f *Forwarder) error {
+		f.httpForwarder.h2cTransport = r
+		return nil
+	}
+}
+
+// h2cTransportWithTimeouts returns a new h2c transport with the given connect timeout.
+// Response header timeouts are not supported by HTTP/2 transports.
+func h2cTransportWithTimeouts(timeouts Timeouts) http.RoundTripper {
+	if timeouts.Connect == 0 {
+		return utils.DefaultH2CTransport
+	}
+	transport := utils.NewH2CTransport()
+	transport.DialTLSContext = utils.H2CDialer(timeouts.Connect)
+	return transport
+}
+
+// protocolTransport delegates the round trip to the proper
+// transport based on the request URL scheme.
+type protocolTransport struct {
+	http http.RoundTripper
+	h2c  http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *protocolTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != H2CScheme {
+		return t.http.RoundTrip(req)
+	}
+
+	outReq := new(http.Request)
+	*outReq = *req
+	outReq.URL = utils.CopyURL(req.URL)
+	outReq.URL.Scheme = "http"
+	return t.h2c.RoundTrip(outReq)
+}
@@ -0,0 +1,161 @@
+package forward
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+func TestForwardH2C(t *testing.T) {
+	addrs := []string{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		addrs = append(addrs, req.RemoteAddr)
+		w.Write([]byte(req.Proto))
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer srv.Close()
+
+	target := strings.Replace(srv.URL, "http://", "h2c://", 1)
+	f, err := New(Target(target))
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(f)
+	defer proxy.Close()
+
+	for i := 0; i < 2; i++ {
+		res, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, res.StatusCode, http.StatusOK)
+		st.Expect(t, string(body), "HTTP/2.0")
+	}
+
+	// Requests are multiplexed over the same connection
+	st.Expect(t, len(addrs), 2)
+	st.Expect(t, addrs[0], addrs[1])
+}
+
+func TestForwardHTTP2TLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	transport := utils.NewDefaultPooledTransport()
+	transport.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	f, err := New(Target(srv.URL), RoundTripper(transport))
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(f)
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "HTTP/2.0")
+}
+
+func TestH2CTransportTimeouts(t *testing.T) {
+	st.Expect(t, h2cTransportWithTimeouts(Timeouts{}), http.RoundTripper(utils.DefaultH2CTransport))
+	st.Reject(t, h2cTransportWithTimeouts(Timeouts{Connect: 1}), http.RoundTripper(utils.DefaultH2CTransport))
+}
+
+func TestForwardTrailers(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Trailer", "X-Declared")
+		w.Write([]byte("hello"))
+		w.Header().Set("X-Declared", "foo")
+		w.Header().Set(http.TrailerPrefix+"X-Undeclared", "bar")
+	})
+	defer srv.Close()
+
+	f, err := New(Target(srv.URL))
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(f)
+	defer proxy.Close()
+
+	res, err := http.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, res.Trailer.Get("X-Declared"), "foo")
+	st.Expect(t, res.Trailer.Get("X-Undeclared"), "bar")
+}
+
+func TestForwardGRPCStreaming(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		st.Expect(t, req.Header.Get(Te), "trailers")
+		w.Header().Set("Content-Type", "application/grpc")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+
+		// Echo every message while the client is still streaming
+		buf := make([]byte, 5)
+		for {
+			if _, err := io.ReadFull(req.Body, buf); err != nil {
+				break
+			}
+			w.Write(buf)
+			w.(http.Flusher).Flush()
+		}
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer srv.Close()
+
+	f, err := New(Target(strings.Replace(srv.URL, "http://", "h2c://", 1)))
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(h2c.NewHandler(f, &http2.Server{}))
+	defer proxy.Close()
+
+	reader, writer := io.Pipe()
+	req, _ := http.NewRequest("POST", proxy.URL+"/helloworld.Greeter/SayHello", reader)
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set(Te, "trailers")
+
+	client := utils.NewH2CTransport()
+	defer client.CloseIdleConnections()
+	go writer.Write([]byte("ping1"))
+	res, err := client.RoundTrip(req)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.ProtoMajor, 2)
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(res.Body, buf)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(buf), "ping1")
+
+	// The response is streamed before the request body is closed
+	go writer.Write([]byte("ping2"))
+	_, err = io.ReadFull(res.Body, buf)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(buf), "ping2")
+
+	writer.Close()
+	rest, err := ioutil.ReadAll(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, len(rest), 0)
+	st.Expect(t, res.Trailer.Get("Grpc-Status"), "0")
+}
+
+func TestForwardGRPCError(t *testing.T) {
+	f, err := New(Target("h2c://localhost:63450"))
+	st.Expect(t, err, nil)
+	proxy := httptest.NewServer(f)
+	defer proxy.Close()
+
+	res, _, err := testutils.Post(proxy.URL, testutils.Header("Content-Type", "application/grpc"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, res.Header.Get("Grpc-Status"), "14")
+	st.Expect(t, res.Header.Get("Grpc-Message"), "Bad Gateway")
+}
@@ -1 +1,153 @@
 package forward
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+func TestResponseModifierHeaders(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Internal-Token", "secret")
+		w.Header().Set("Location", "http://internal:8080/foo")
+		w.WriteHeader(http.StatusFound)
+	})
+	defer srv.Close()
+
+	modifier := RespModifierFunc(func(res *http.Response) error {
+		res.Header.Del("X-Internal-Token")
+		location := strings.Replace(res.Header.Get("Location"), "http://internal:8080", "http://foo.com", 1)
+		res.Header.Set("Location", location)
+		res.StatusCode = http.StatusMovedPermanently
+		return nil
+	})
+
+	f, err := New(ResponseModifier(modifier))
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	res, err := http.DefaultTransport.RoundTrip(mustRequest(t, proxy.URL))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusMovedPermanently)
+	st.Expect(t, res.Header.Get("X-Internal-Token"), "")
+	st.Expect(t, res.Header.Get("Location"), "http://foo.com/foo")
+}
+
+func TestResponseModifierBody(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello world"))
+	})
+	defer srv.Close()
+
+	modifier := RespModifierFunc(func(res *http.Response) error {
+		body, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		body = []byte(strings.ToUpper(string(body)) + "!")
+		res.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+		res.ContentLength = int64(len(body))
+		res.Header.Set(ContentLength, strconv.Itoa(len(body)))
+		return nil
+	})
+
+	f, err := New(ResponseModifier(modifier))
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "HELLO WORLD!")
+	st.Expect(t, res.ContentLength, int64(12))
+}
+
+func TestResponseModifierError(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	defer srv.Close()
+
+	var handledErr error
+	errHandler := utils.ErrorHandlerFunc(func(w http.ResponseWriter, req *http.Request, err error) {
+		handledErr = err
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	modifier := RespModifierFunc(func(res *http.Response) error {
+		return errors.New("invalid response")
+	})
+
+	f, err := New(ResponseModifier(modifier), ErrorHandler(errHandler))
+	st.Expect(t, err, nil)
+
+	proxy := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(srv.URL)
+		f.ServeHTTP(w, req)
+	})
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+	st.Expect(t, string(body), "")
+	st.Expect(t, handledErr.Error(), "invalid response")
+}
+
+func mustRequest(t *testing.T, uri string) *http.Request {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestRequestID(t *testing.T) {
+	var id string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		id = req.Header.Get(utils.XRequestID)
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL))
+	defer proxy.Close()
+
+	_, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Reject(t, id, "")
+
+	_, _, err = testutils.Get(proxy.URL, testutils.Header(utils.XRequestID, "abc"))
+	st.Expect(t, err, nil)
+	st.Expect(t, id, "abc")
+
+	// Forwarding errors are logged with the request ID returned to the client
+	srv.Close()
+	logs := &bytes.Buffer{}
+	proxy = testutils.NewHandler(To(srv.URL, Logger(utils.NewFileLogger(logs, utils.ERROR))))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+	st.Reject(t, res.Header.Get(utils.XRequestID), "")
+	st.Expect(t, strings.Contains(logs.String(), "request ID: "+res.Header.Get(utils.XRequestID)), true)
+}
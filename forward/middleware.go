@@ -3,27 +3,102 @@ package forward
 import (
 	"net/http"
 	"net/url"
+	"strings"
 )
 
 // To returns an http.HandlerFunc that forwards the incoming request to
 // the given URI server.
-func To(uri string) func(w http.ResponseWriter, r *http.Request) {
-	parsedURL, err := url.Parse(uri)
+// The URI base path is joined with the incoming request path and
+// the URI query params, if any, are merged with the request query params.
+func To(uri string, setters ...OptSetter) func(w http.ResponseWriter, r *http.Request) {
+	fwd, err := New(append([]OptSetter{Target(uri)}, setters...)...)
 	if err != nil {
 		panic(err)
 	}
+	return fwd.ServeHTTP
+}
 
-	fwd, err := New(PassHostHeader(true))
+// Proxy creates a forward proxy handler who forwards the traffic to the server
+// defined in the absolute-form request URI and tunnels CONNECT requests.
+func Proxy(setters ...OptSetter) func(w http.ResponseWriter, r *http.Request) {
+	fwd, err := New(append([]OptSetter{ForwardProxy()}, setters...)...)
 	if err != nil {
 		panic(err)
 	}
+	return fwd.ServeHTTP
+}
+
+// rewriteTarget rewrites the request URL to be forwarded to the given target URL,
+// joining the target base path with the request path and merging both queries.
+func rewriteTarget(req *http.Request, target *url.URL) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path, req.URL.RawPath = joinURLPath(target, req.URL)
+	if target.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+	}
+}
+
+// joinURLPath joins the base path of the given URL with the request URL path,
+// preserving the raw encoded path, if present.
+func joinURLPath(base, u *url.URL) (path, rawpath string) {
+	if base.RawPath == "" && u.RawPath == "" {
+		return singleJoiningSlash(base.Path, u.Path), ""
+	}
+
+	basePath := base.EscapedPath()
+	reqPath := u.EscapedPath()
+
+	baseSlash := strings.HasSuffix(basePath, "/")
+	reqSlash := strings.HasPrefix(reqPath, "/")
+
+	switch {
+	case baseSlash && reqSlash:
+		return base.Path + u.Path[1:], basePath + reqPath[1:]
+	case !baseSlash && !reqSlash:
+		return base.Path + "/" + u.Path, basePath + "/" + reqPath
+	}
+	return base.Path + u.Path, basePath + reqPath
+}
+
+// singleJoiningSlash joins two paths using a single slash.
+func singleJoiningSlash(a, b string) string {
+	if a == "" {
+		return b
+	}
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		r.URL.Scheme = parsedURL.Scheme
-		r.URL.Host = parsedURL.Host
-		r.Host = parsedURL.Host
+// stripPathPrefix removes the given prefix from the URL path, preserving
+// the raw encoded path, only if the prefix matches a full path segment.
+func stripPathPrefix(u *url.URL, prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" || !hasPathPrefix(u.Path, prefix) {
+		return
+	}
 
-		// Forward the HTTP request
-		fwd.ServeHTTP(w, r)
+	u.Path = "/" + strings.TrimPrefix(u.Path[len(prefix):], "/")
+	if u.RawPath == "" {
+		return
+	}
+	if hasPathPrefix(u.RawPath, prefix) {
+		u.RawPath = "/" + strings.TrimPrefix(u.RawPath[len(prefix):], "/")
+	} else {
+		u.RawPath = ""
 	}
 }
+
+// hasPathPrefix checks if the given path starts with the given path segments.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
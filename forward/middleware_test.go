@@ -1 +1,113 @@
 package forward
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+func TestToJoinPaths(t *testing.T) {
+	var outURI, outHost string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		outURI = req.RequestURI
+		outHost = req.Host
+		w.Write([]byte("hello"))
+	})
+	defer srv.Close()
+
+	cases := []struct {
+		target   string
+		prefix   string
+		path     string
+		expected string
+	}{
+		{"", "", "/", "/"},
+		{"", "", "/foo?bar=baz", "/foo?bar=baz"},
+		{"/", "", "/foo", "/foo"},
+		{"/api/v2", "", "/", "/api/v2/"},
+		{"/api/v2", "", "/users", "/api/v2/users"},
+		{"/api/v2/", "", "/users/", "/api/v2/users/"},
+		{"/api/v2", "", "/users?id=1&sort=desc", "/api/v2/users?id=1&sort=desc"},
+		{"/api/v2?key=secret", "", "/users?id=1", "/api/v2/users?key=secret&id=1"},
+		{"/api/v2?key=secret", "", "/users", "/api/v2/users?key=secret"},
+		{"/api", "", "/log/http%3A%2F%2Fwww.site.com%2Fsomething?a=b", "/api/log/http%3A%2F%2Fwww.site.com%2Fsomething?a=b"},
+		{"/api%2Fv2", "", "/users", "/api%2Fv2/users"},
+		{"/api", "", "/foo%20bar", "/api/foo%20bar"},
+		{"/api/v2", "/public", "/public/users?id=1", "/api/v2/users?id=1"},
+		{"/api/v2", "/public/", "/public", "/api/v2/"},
+		{"/api/v2", "/public", "/publicity", "/api/v2/publicity"},
+		{"", "/public", "/public/foo%2Fbar", "/foo%2Fbar"},
+		{"", "/public", "/private/foo", "/private/foo"},
+	}
+
+	for _, test := range cases {
+		setters := []OptSetter{}
+		if test.prefix != "" {
+			setters = append(setters, StripPrefix(test.prefix))
+		}
+
+		proxy := testutils.NewHandler(To(srv.URL+test.target, setters...))
+		request, err := http.NewRequest("GET", proxy.URL, nil)
+		st.Expect(t, err, nil)
+		request.URL.Opaque = test.path
+
+		res, err := http.DefaultClient.Do(request)
+		proxy.Close()
+		st.Expect(t, err, nil)
+		st.Expect(t, res.StatusCode, http.StatusOK)
+		st.Expect(t, outURI, test.expected)
+		st.Expect(t, outHost, testutils.ParseURI(srv.URL).Host)
+	}
+}
+
+func TestToPassHostHeader(t *testing.T) {
+	var outHost string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		outHost = req.Host
+		w.Write([]byte("hello"))
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL, PassHostHeader(true)))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL, testutils.Host("foo.com"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, outHost, "foo.com")
+}
+
+func TestToInvalidTarget(t *testing.T) {
+	defer func() {
+		st.Reject(t, recover(), nil)
+	}()
+	To("localhost:8080")
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	cases := []struct {
+		prefix  string
+		path    string
+		rawpath string
+		expPath string
+		expRaw  string
+	}{
+		{"/foo", "/foo/bar", "", "/bar", ""},
+		{"/foo/", "/foo/bar", "", "/bar", ""},
+		{"/foo", "/foo", "", "/", ""},
+		{"/foo", "/foobar", "", "/foobar", ""},
+		{"/foo", "/bar/foo", "", "/bar/foo", ""},
+		{"/foo", "/foo/a/b", "/foo/a%2Fb", "/a/b", "/a%2Fb"},
+		{"/a b", "/a b/c", "/a%20b/c", "/c", ""},
+	}
+
+	for _, test := range cases {
+		u := &url.URL{Path: test.path, RawPath: test.rawpath}
+		stripPathPrefix(u, test.prefix)
+		st.Expect(t, u.Path, test.expPath)
+		st.Expect(t, u.RawPath, test.expRaw)
+	}
+}
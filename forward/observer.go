@@ -0,0 +1,239 @@
+package forward
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Observer receives the typed events of every upstream HTTP round trip,
+// allowing to build metrics, tracing or access logging.
+// Observers are called synchronously, so they must not block.
+type Observer interface {
+	// OnStart is called before sending the request to the upstream server.
+	OnStart(e *StartEvent)
+	// OnResponse is called when the upstream response headers are received.
+	OnResponse(e *ResponseEvent)
+	// OnDone is called once the round trip completes, either successfully or with an error.
+	OnDone(e *DoneEvent)
+}
+
+// BaseObserver implements a no-op Observer, designed to be embedded
+// by observers only interested in a subset of the events.
+type BaseObserver struct{}
+
+// OnStart implements the Observer interface.
+func (BaseObserver) OnStart(e *StartEvent) {}
+
+// OnResponse implements the Observer interface.
+func (BaseObserver) OnResponse(e *ResponseEvent) {}
+
+// OnDone implements the Observer interface.
+func (BaseObserver) OnDone(e *DoneEvent) {}
+
+// Timings stores the upstream connection and response timings collected via httptrace.
+// Connection timings are zero if an idle connection was reused.
+type Timings struct {
+	// DNS stores the host name lookup duration.
+	DNS time.Duration
+	// Connect stores the TCP connection duration.
+	Connect time.Duration
+	// TLS stores the TLS handshake duration.
+	TLS time.Duration
+	// FirstByte stores the duration until the first response byte was received.
+	FirstByte time.Duration
+	// Reused is true if the request was sent using an idle connection.
+	Reused bool
+	// RemoteAddr stores the upstream server address.
+	RemoteAddr string
+	// TLSState stores the upstream TLS connection state, if any.
+	TLSState *tls.ConnectionState
+}
+
+// StartEvent is sent before the request is forwarded.
+type StartEvent struct {
+	// Request stores the outgoing request sent to the upstream server.
+	Request *http.Request
+	// Start stores the round trip start time.
+	Start time.Time
+}
+
+// ResponseEvent is sent when the upstream response headers are received.
+type ResponseEvent struct {
+	Request  *http.Request
+	Response *http.Response
+	Timings  Timings
+	// Duration stores the elapsed time until the response headers were received.
+	Duration time.Duration
+}
+
+// DoneEvent is sent when the round trip completes.
+type DoneEvent struct {
+	Request *http.Request
+	// StatusCode stores the upstream response status code, if any.
+	StatusCode int
+	Timings    Timings
+	// BytesSent stores the number of request body bytes read from the client.
+	BytesSent int64
+	// BytesReceived stores the number of response body bytes copied to the client.
+	BytesReceived int64
+	// Duration stores the whole round trip duration, including the response body copy.
+	Duration time.Duration
+	// Err stores the round trip error, if any.
+	Err error
+}
+
+// Observe registers one or multiple observers notified
+// about every upstream HTTP round trip.
+// Websocket round trips complete once the upgrade handshake is done.
+func Observe(observers ...Observer) OptSetter {
+	return func(f *Forwarder) error {
+		f.httpForwarder.observers = append(f.httpForwarder.observers, observers...)
+		f.websocketForwarder.observers = append(f.websocketForwarder.observers, observers...)
+		return nil
+	}
+}
+
+// observation tracks the events of a single round trip.
+type observation struct {
+	sync.Mutex
+	observers []Observer
+	req       *http.Request
+	start     time.Time
+	timings   Timings
+	body      *countingReader
+	status    int
+
+	dnsStart, connectStart, tlsStart time.Time
+}
+
+// newObservation starts observing the given outgoing request,
+// returning the request to send who collects the round trip timings.
+// The returned observation is nil if there are no observers.
+func newObservation(observers []Observer, req *http.Request) (*observation, *http.Request) {
+	if len(observers) == 0 {
+		return nil, req
+	}
+
+	o := &observation{observers: observers, start: time.Now()}
+
+	if req.Body != nil && req.Body != http.NoBody {
+		o.body = &countingReader{ReadCloser: req.Body}
+		req.Body = o.body
+	}
+	o.req = req.WithContext(httptrace.WithClientTrace(req.Context(), o.clientTrace()))
+
+	e := &StartEvent{Request: o.req, Start: o.start}
+	for _, observer := range o.observers {
+		observer.OnStart(e)
+	}
+	return o, o.req
+}
+
+// clientTrace returns the httptrace hooks used to collect the connection timings.
+func (o *observation) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			o.Lock()
+			o.dnsStart = time.Now()
+			o.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			o.Lock()
+			o.timings.DNS = time.Since(o.dnsStart)
+			o.Unlock()
+		},
+		ConnectStart: func(network, addr string) {
+			o.Lock()
+			o.connectStart = time.Now()
+			o.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			o.Lock()
+			o.timings.Connect = time.Since(o.connectStart)
+			o.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			o.Lock()
+			o.tlsStart = time.Now()
+			o.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			o.Lock()
+			o.timings.TLS = time.Since(o.tlsStart)
+			if err == nil {
+				o.timings.TLSState = &state
+			}
+			o.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			o.Lock()
+			o.timings.Reused = info.Reused
+			if info.Conn != nil {
+				o.timings.RemoteAddr = info.Conn.RemoteAddr().String()
+			}
+			o.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			o.Lock()
+			o.timings.FirstByte = time.Since(o.start)
+			o.Unlock()
+		},
+	}
+}
+
+// snapshot returns a copy of the collected timings.
+func (o *observation) snapshot() Timings {
+	o.Lock()
+	defer o.Unlock()
+	return o.timings
+}
+
+// response notifies the observers about the received upstream response.
+func (o *observation) response(res *http.Response) {
+	if o == nil {
+		return
+	}
+	o.status = res.StatusCode
+	e := &ResponseEvent{Request: o.req, Response: res, Timings: o.snapshot(), Duration: time.Since(o.start)}
+	for _, observer := range o.observers {
+		observer.OnResponse(e)
+	}
+}
+
+// done notifies the observers about the round trip completion.
+func (o *observation) done(received int64, err error) {
+	if o == nil {
+		return
+	}
+	e := &DoneEvent{
+		Request:       o.req,
+		StatusCode:    o.status,
+		Timings:       o.snapshot(),
+		BytesReceived: received,
+		Duration:      time.Since(o.start),
+		Err:           err,
+	}
+	if o.body != nil {
+		e.BytesSent = atomic.LoadInt64(&o.body.n)
+	}
+	for _, observer := range o.observers {
+		observer.OnDone(e)
+	}
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
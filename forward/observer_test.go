@@ -0,0 +1,153 @@
+package forward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+// recordObserver records the received round trip events.
+type recordObserver struct {
+	sync.Mutex
+	starts    []*StartEvent
+	responses []*ResponseEvent
+	dones     []*DoneEvent
+}
+
+func (o *recordObserver) OnStart(e *StartEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.starts = append(o.starts, e)
+}
+
+func (o *recordObserver) OnResponse(e *ResponseEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.responses = append(o.responses, e)
+}
+
+func (o *recordObserver) OnDone(e *DoneEvent) {
+	o.Lock()
+	defer o.Unlock()
+	o.dones = append(o.dones, e)
+}
+
+func TestObserver(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Upstream", "foo")
+		w.Write([]byte("hello world"))
+	})
+	defer srv.Close()
+
+	observer := &recordObserver{}
+	proxy := testutils.NewHandler(To(srv.URL, Observe(observer)))
+	defer proxy.Close()
+
+	res, _, err := testutils.Post(proxy.URL, testutils.Body("ping"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+
+	st.Expect(t, len(observer.starts), 1)
+	st.Expect(t, observer.starts[0].Request.Method, "POST")
+	st.Expect(t, observer.starts[0].Request.URL.Host, srv.Listener.Addr().String())
+
+	st.Expect(t, len(observer.responses), 1)
+	st.Expect(t, observer.responses[0].Response.Header.Get("X-Upstream"), "foo")
+
+	st.Expect(t, len(observer.dones), 1)
+	done := observer.dones[0]
+	st.Expect(t, done.Err, nil)
+	st.Expect(t, done.StatusCode, http.StatusOK)
+	st.Expect(t, done.BytesSent, int64(4))
+	st.Expect(t, done.BytesReceived, int64(11))
+	st.Expect(t, done.Timings.RemoteAddr, srv.Listener.Addr().String())
+	st.Expect(t, done.Timings.FirstByte > 0, true)
+	st.Expect(t, done.Duration >= done.Timings.FirstByte, true)
+}
+
+func TestObserverTLSTimings(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	observer := &recordObserver{}
+	proxy := testutils.NewHandler(To(srv.URL, RoundTripper(srv.Client().Transport), Observe(observer)))
+	defer proxy.Close()
+
+	for i := 0; i < 2; i++ {
+		res, _, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, res.StatusCode, http.StatusOK)
+	}
+
+	first := observer.dones[0].Timings
+	st.Expect(t, first.Reused, false)
+	st.Expect(t, first.Connect > 0, true)
+	st.Expect(t, first.TLS > 0, true)
+	st.Reject(t, first.TLSState, nil)
+
+	// The idle connection is reused by the second request
+	second := observer.dones[1].Timings
+	st.Expect(t, second.Reused, true)
+	st.Expect(t, second.TLS, time.Duration(0))
+}
+
+func TestObserverError(t *testing.T) {
+	observer := &recordObserver{}
+	proxy := testutils.NewHandler(To("http://localhost:63450", Observe(observer, BaseObserver{})))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+
+	st.Expect(t, len(observer.starts), 1)
+	st.Expect(t, len(observer.responses), 0)
+	st.Expect(t, len(observer.dones), 1)
+	st.Reject(t, observer.dones[0].Err, nil)
+	st.Expect(t, strings.Contains(observer.dones[0].Err.Error(), "connect"), true)
+	st.Expect(t, observer.dones[0].StatusCode, 0)
+}
+
+func TestObserverWebsocket(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("unavailable"))
+	})
+	defer srv.Close()
+
+	observer := &recordObserver{}
+	proxy := newWebsocketProxy(t, srv.URL, Observe(observer))
+	defer proxy.Close()
+
+	conn, _, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+	st.Expect(t, res.StatusCode, http.StatusServiceUnavailable)
+
+	st.Expect(t, len(observer.starts), 1)
+	st.Expect(t, len(observer.responses), 1)
+	st.Expect(t, len(observer.dones), 1)
+	st.Expect(t, observer.dones[0].StatusCode, http.StatusServiceUnavailable)
+	st.Expect(t, observer.dones[0].BytesReceived, int64(len("unavailable")))
+	st.Expect(t, observer.dones[0].Err, nil)
+}
+
+func TestObserverWebsocketError(t *testing.T) {
+	observer := &recordObserver{}
+	proxy := newWebsocketProxy(t, "http://localhost:63450", Observe(observer))
+	defer proxy.Close()
+
+	conn, _, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+
+	st.Expect(t, len(observer.dones), 1)
+	st.Reject(t, observer.dones[0].Err, nil)
+}
@@ -0,0 +1,89 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// DefaultConnectDialTimeout stores the default maximum time to dial CONNECT tunnel destinations.
+var DefaultConnectDialTimeout = 30 * time.Second
+
+// ErrNotProxyRequest is used when a forward proxy receives a request without an absolute URI.
+var ErrNotProxyRequest = errors.New("forward: request URI must be absolute in forward proxy mode")
+
+// ForwardProxy enables the forward proxy mode, where requests are forwarded
+// to the server defined in the absolute-form request URI and CONNECT
+// requests are tunneled to the requested destination.
+// The client Host header is always passed in forward proxy mode.
+func ForwardProxy() OptSetter {
+	return func(f *Forwarder) error {
+		f.forwardProxy = true
+		f.passHost = true
+		return nil
+	}
+}
+
+// serveConnect tunnels the client connection to the destination defined
+// in the CONNECT request authority.
+func (f *Forwarder) serveConnect(w http.ResponseWriter, req *http.Request, ctx *handlerContext) {
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "443")
+	}
+
+	targetConn, err := f.dialConnect(req.Context(), host)
+	if err != nil {
+		ctx.log.Errorf("Error dialing `%v`: %v, request ID: %v", host, err, utils.RequestID(req))
+		ctx.errHandler.ServeHTTP(w, req, err)
+		return
+	}
+	defer targetConn.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		err = errors.New("forward: response writer cannot be hijacked")
+		ctx.log.Errorf("Unable to hijack the connection: %v, request ID: %v", err, utils.RequestID(req))
+		ctx.errHandler.ServeHTTP(w, req, err)
+		return
+	}
+	clientConn, clientBuf, err := hijacker.Hijack()
+	if err != nil {
+		ctx.log.Errorf("Unable to hijack the connection: %v, request ID: %v", err, utils.RequestID(req))
+		ctx.errHandler.ServeHTTP(w, req, err)
+		return
+	}
+	defer clientConn.Close()
+
+	if _, err = io.WriteString(clientConn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		ctx.log.Errorf("Unable to write the CONNECT response to the client: %v, request ID: %v", err, utils.RequestID(req))
+		return
+	}
+
+	// Data already sent by the client, such as the TLS client hello, must be sent first
+	clientSrc := io.MultiReader(buffered(clientBuf.Reader), clientConn)
+
+	t := newTunnel(clientConn, targetConn, 0, DefaultWebsocketCloseTimeout)
+	if err = t.run(clientSrc, targetConn); err != nil {
+		ctx.log.Infof("CONNECT tunnel to %v closed: %v", host, err)
+	}
+}
+
+// dialConnect establishes the connection with the CONNECT destination
+// using the configured connect timeout.
+func (f *Forwarder) dialConnect(ctx context.Context, host string) (net.Conn, error) {
+	timeout := f.httpForwarder.timeouts.Connect
+	if timeout == 0 {
+		timeout = DefaultConnectDialTimeout
+	}
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return dialer.DialContext(ctx, "tcp", host)
+}
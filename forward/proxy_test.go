@@ -0,0 +1,133 @@
+package forward
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+// proxyClient returns an HTTP client who uses the given server as forward proxy.
+func proxyClient(proxy *httptest.Server, transport *http.Transport) *http.Client {
+	if transport == nil {
+		transport = &http.Transport{}
+	}
+	proxyURL, _ := url.Parse(proxy.URL)
+	transport.Proxy = http.ProxyURL(proxyURL)
+	return &http.Client{Transport: transport}
+}
+
+func TestForwardProxyAbsoluteURI(t *testing.T) {
+	var outReq *http.Request
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		outReq = req
+		w.Write([]byte("hello"))
+	})
+	defer srv.Close()
+
+	proxy := httptest.NewServer(http.HandlerFunc(Proxy()))
+	defer proxy.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL+"/foo?bar=baz", nil)
+	req.Header.Set(ProxyConnection, "keep-alive")
+	res, err := proxyClient(proxy, nil).Do(req)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, outReq.Host, srv.Listener.Addr().String())
+	st.Expect(t, outReq.RequestURI, "/foo?bar=baz")
+	st.Expect(t, outReq.Header.Get(ProxyConnection), "")
+}
+
+func TestForwardProxyOriginForm(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(Proxy()))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL + "/foo")
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadRequest)
+}
+
+func TestForwardProxyConnect(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+
+	proxy := httptest.NewServer(http.HandlerFunc(Proxy()))
+	defer proxy.Close()
+
+	transport := srv.Client().Transport.(*http.Transport).Clone()
+	res, err := proxyClient(proxy, transport).Get(srv.URL)
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "secure")
+}
+
+func TestForwardProxyConnectRaw(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	st.Expect(t, err, nil)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("echo " + line))
+	}()
+
+	proxy := httptest.NewServer(http.HandlerFunc(Proxy()))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	st.Expect(t, err, nil)
+	defer conn.Close()
+
+	// Data sent along with the CONNECT request must be tunneled too
+	addr := listener.Addr().String()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\nhello\n", addr, addr)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, &http.Request{Method: http.MethodConnect})
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+
+	line, err := reader.ReadString('\n')
+	st.Expect(t, err, nil)
+	st.Expect(t, line, "echo hello\n")
+}
+
+func TestForwardProxyConnectError(t *testing.T) {
+	proxy := httptest.NewServer(http.HandlerFunc(Proxy()))
+	defer proxy.Close()
+
+	conn, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	st.Expect(t, err, nil)
+	defer conn.Close()
+
+	fmt.Fprintf(conn, "CONNECT localhost:63450 HTTP/1.1\r\nHost: localhost:63450\r\n\r\n")
+	res, err := http.ReadResponse(bufio.NewReader(conn), &http.Request{Method: http.MethodConnect})
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+}
+
+func TestForwardProxyTarget(t *testing.T) {
+	_, err := New(ForwardProxy(), Target("http://localhost"))
+	st.Reject(t, err, nil)
+}
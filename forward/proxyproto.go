@@ -0,0 +1,176 @@
+package forward
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// PROXY protocol versions supported by the forwarder.
+// See: https://www.haproxy.org/download/2.0/doc/proxy-protocol.txt
+const (
+	ProxyProtocolV1 = 1
+	ProxyProtocolV2 = 2
+)
+
+// proxyProtocolSignature stores the PROXY protocol v2 header signature.
+var proxyProtocolSignature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// proxyHeaderKey is the context key used to pass the PROXY protocol header to the dialer.
+type proxyHeaderKey struct{}
+
+// ProxyProtocol enables sending a PROXY protocol header of the given version
+// with the original client address on every new upstream connection,
+// for both HTTP and websocket forwarding.
+// Since upstream connections are bound to the client address, HTTP connections
+// are not reused across requests and HTTP/2 is not negotiated with upstream servers.
+// PROXY protocol is not supported with h2c targets and requires an *http.Transport round tripper.
+func ProxyProtocol(version int) OptSetter {
+	return func(f *Forwarder) error {
+		if version != ProxyProtocolV1 && version != ProxyProtocolV2 {
+			return fmt.Errorf("forward: unsupported PROXY protocol version: %d", version)
+		}
+		f.httpForwarder.proxyProtocol = version
+		f.websocketForwarder.proxyProtocol = version
+		return nil
+	}
+}
+
+// withProxyHeader returns a copy of the given context
+// storing the PROXY protocol header for the given request.
+func withProxyHeader(ctx context.Context, req *http.Request, version int) context.Context {
+	return context.WithValue(ctx, proxyHeaderKey{}, proxyHeader(req, version))
+}
+
+// transportWithProxyProtocol returns a copy of the given transport who writes the
+// PROXY protocol header stored in the request context on every new connection.
+// Connections dialed without a client request, such as health checks,
+// send a header of the given version with unknown addresses.
+func transportWithProxyProtocol(rt http.RoundTripper, version int) (http.RoundTripper, error) {
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, errors.New("forward: PROXY protocol requires an *http.Transport")
+	}
+
+	transport = transport.Clone()
+	// Connections are bound to the client address, so they cannot be shared
+	transport.DisableKeepAlives = true
+	transport.ForceAttemptHTTP2 = false
+	transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+
+	dial := transport.DialContext
+	if dial == nil && transport.Dial != nil {
+		dial = contextDial(transport.Dial)
+	}
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	transport.Dial = nil
+	transport.DialContext = proxyProtocolDialer(dial, version)
+	return transport, nil
+}
+
+// proxyProtocolDialer wraps the given dial function writing
+// the PROXY protocol header stored in the context.
+func proxyProtocolDialer(dial dialFunc, version int) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeProxyHeader(ctx, conn, version); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// writeProxyHeader writes the PROXY protocol header stored in the context,
+// or a header of the given version with unknown addresses if there is none.
+func writeProxyHeader(ctx context.Context, conn net.Conn, version int) error {
+	header, ok := ctx.Value(proxyHeaderKey{}).([]byte)
+	if !ok {
+		header = proxyHeaderV1(nil, nil)
+		if version == ProxyProtocolV2 {
+			header = proxyHeaderV2(nil, nil)
+		}
+	}
+	_, err := conn.Write(header)
+	return err
+}
+
+// proxyHeader builds the PROXY protocol header of the given version for the given request.
+// The source address is the client address and the destination address is
+// the local address who accepted the client connection.
+func proxyHeader(req *http.Request, version int) []byte {
+	src, _ := net.ResolveTCPAddr("tcp", req.RemoteAddr)
+	dst, _ := req.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if version == ProxyProtocolV2 {
+		return proxyHeaderV2(src, dst)
+	}
+	return proxyHeaderV1(src, dst)
+}
+
+// proxyHeaderV1 builds the human readable PROXY protocol v1 header.
+func proxyHeaderV1(src, dst *net.TCPAddr) []byte {
+	if src == nil || dst == nil {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+	srcIP, dstIP, ipv4 := proxyAddrs(src, dst)
+	proto := "TCP6"
+	if ipv4 {
+		proto = "TCP4"
+	}
+	return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n", proto, formatIP(srcIP), formatIP(dstIP), src.Port, dst.Port))
+}
+
+// formatIP formats the given IP address, using the IPv6 notation
+// for IPv4-mapped addresses of the IPv6 family.
+func formatIP(ip net.IP) string {
+	if len(ip) == net.IPv6len && ip.To4() != nil {
+		return "::ffff:" + ip.To4().String()
+	}
+	return ip.String()
+}
+
+// proxyHeaderV2 builds the binary PROXY protocol v2 header.
+func proxyHeaderV2(src, dst *net.TCPAddr) []byte {
+	buf := bytes.NewBuffer(append([]byte{}, proxyProtocolSignature...))
+	if src == nil || dst == nil {
+		// LOCAL command with unspecified family and no addresses
+		buf.Write([]byte{0x20, 0x00, 0x00, 0x00})
+		return buf.Bytes()
+	}
+
+	srcIP, dstIP, ipv4 := proxyAddrs(src, dst)
+	family := byte(0x21) // TCP over IPv6
+	if ipv4 {
+		family = 0x11 // TCP over IPv4
+	}
+
+	// PROXY command, followed by the address family and length
+	buf.Write([]byte{0x21, family})
+	binary.Write(buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+	buf.Write(srcIP)
+	buf.Write(dstIP)
+	binary.Write(buf, binary.BigEndian, uint16(src.Port))
+	binary.Write(buf, binary.BigEndian, uint16(dst.Port))
+	return buf.Bytes()
+}
+
+// proxyAddrs returns both IP addresses using the same address family,
+// using IPv4 only if both addresses are IPv4.
+func proxyAddrs(src, dst *net.TCPAddr) (net.IP, net.IP, bool) {
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP != nil && dstIP != nil {
+		return srcIP, dstIP, true
+	}
+	return src.IP.To16(), dst.IP.To16(), false
+}
@@ -0,0 +1,207 @@
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/websocket"
+)
+
+// proxyProtoListener reads and records the PROXY protocol
+// header of every accepted connection.
+type proxyProtoListener struct {
+	net.Listener
+	sync.Mutex
+	headers [][]byte
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	header, err := readProxyHeader(reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	l.Lock()
+	l.headers = append(l.headers, header)
+	l.Unlock()
+	return &bufferedConn{conn, reader}, nil
+}
+
+func (l *proxyProtoListener) Headers() [][]byte {
+	l.Lock()
+	defer l.Unlock()
+	return l.headers
+}
+
+// readProxyHeader reads a PROXY protocol v1 or v2 header.
+func readProxyHeader(r *bufio.Reader) ([]byte, error) {
+	sig, err := r.Peek(len(proxyProtocolSignature))
+	if err != nil {
+		return nil, err
+	}
+	if string(sig) != string(proxyProtocolSignature) {
+		line, err := r.ReadString('\n')
+		return []byte(line), err
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	addrs := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, addrs); err != nil {
+		return nil, err
+	}
+	return append(header, addrs...), nil
+}
+
+// bufferedConn reads from the given buffered reader first.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(buf []byte) (int, error) {
+	return c.reader.Read(buf)
+}
+
+func newProxyProtoServer(handler http.Handler) (*httptest.Server, *proxyProtoListener) {
+	srv := httptest.NewUnstartedServer(handler)
+	listener := &proxyProtoListener{Listener: srv.Listener}
+	srv.Listener = listener
+	srv.Start()
+	return srv, listener
+}
+
+func TestProxyProtocolV1(t *testing.T) {
+	srv, listener := newProxyProtoServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, ProxyProtocol(ProxyProtocolV1))
+	defer proxy.Close()
+
+	for i := 0; i < 2; i++ {
+		res, body, err := testutils.Get(proxy.URL)
+		st.Expect(t, err, nil)
+		st.Expect(t, res.StatusCode, http.StatusOK)
+		st.Expect(t, string(body), "hello")
+	}
+
+	// Every request uses a new upstream connection
+	headers := listener.Headers()
+	st.Expect(t, len(headers), 2)
+
+	_, proxyPort, _ := net.SplitHostPort(proxy.Listener.Addr().String())
+	header := string(headers[0])
+	st.Expect(t, header[:len("PROXY TCP4 127.0.0.1 127.0.0.1 ")], "PROXY TCP4 127.0.0.1 127.0.0.1 ")
+	st.Expect(t, header[len(header)-len(proxyPort)-2:], proxyPort+"\r\n")
+}
+
+func TestProxyProtocolV2(t *testing.T) {
+	srv, listener := newProxyProtoServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, ProxyProtocol(ProxyProtocolV2))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+
+	header := listener.Headers()[0]
+	st.Expect(t, len(header), 28)
+	st.Expect(t, header[12], byte(0x21))
+	st.Expect(t, header[13], byte(0x11))
+	st.Expect(t, net.IP(header[16:20]).String(), "127.0.0.1")
+
+	proxyAddr := proxy.Listener.Addr().(*net.TCPAddr)
+	st.Expect(t, int(binary.BigEndian.Uint16(header[26:])), proxyAddr.Port)
+}
+
+func TestProxyProtocolLocal(t *testing.T) {
+	srv, listener := newProxyProtoServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer srv.Close()
+
+	// Connections dialed without a client request send unknown addresses
+	for _, version := range []int{ProxyProtocolV1, ProxyProtocolV2} {
+		f, err := New(ProxyProtocol(version))
+		st.Expect(t, err, nil)
+		req, err := http.NewRequest("GET", srv.URL, nil)
+		st.Expect(t, err, nil)
+		res, err := f.RoundTripper().RoundTrip(req)
+		st.Expect(t, err, nil)
+		res.Body.Close()
+	}
+
+	headers := listener.Headers()
+	st.Expect(t, len(headers), 2)
+	st.Expect(t, string(headers[0]), "PROXY UNKNOWN\r\n")
+	st.Expect(t, headers[1][12:], []byte{0x20, 0, 0, 0})
+}
+
+func TestProxyProtocolWebsocket(t *testing.T) {
+	srv, listener := newProxyProtoServer(websocket.Handler(func(conn *websocket.Conn) {
+		conn.Write([]byte("ok"))
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL, ProxyProtocol(ProxyProtocolV1))
+	defer proxy.Close()
+
+	resp, err := sendWebsocketRequest(proxy.Listener.Addr().String(), "/ws", "echo", nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, resp, "ok")
+	st.Expect(t, len(listener.Headers()), 1)
+	st.Expect(t, string(listener.Headers()[0][:11]), "PROXY TCP4 ")
+}
+
+func TestProxyHeader(t *testing.T) {
+	src := &net.TCPAddr{IP: net.ParseIP("192.168.0.1"), Port: 56324}
+	dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 443}
+	st.Expect(t, string(proxyHeaderV1(src, dst)), "PROXY TCP4 192.168.0.1 10.0.0.1 56324 443\r\n")
+	st.Expect(t, string(proxyHeaderV1(nil, dst)), "PROXY UNKNOWN\r\n")
+
+	dst6 := &net.TCPAddr{IP: net.ParseIP("::1"), Port: 443}
+	st.Expect(t, string(proxyHeaderV1(src, dst6)), "PROXY TCP6 ::ffff:192.168.0.1 ::1 56324 443\r\n")
+
+	header := proxyHeaderV2(src, dst)
+	st.Expect(t, header[:12], proxyProtocolSignature)
+	st.Expect(t, header[12:], []byte{0x21, 0x11, 0, 12, 192, 168, 0, 1, 10, 0, 0, 1, 0xDC, 0x04, 0x01, 0xBB})
+
+	header = proxyHeaderV2(src, dst6)
+	st.Expect(t, header[12:16], []byte{0x21, 0x21, 0, 36})
+	st.Expect(t, len(header), 52)
+
+	st.Expect(t, proxyHeaderV2(nil, nil)[12:], []byte{0x20, 0, 0, 0})
+}
+
+func TestProxyProtocolInvalid(t *testing.T) {
+	_, err := New(ProxyProtocol(3))
+	st.Reject(t, err, nil)
+
+	_, err = New(ProxyProtocol(ProxyProtocolV1), Target("h2c://localhost"))
+	st.Reject(t, err, nil)
+
+	_, err = New(ProxyProtocol(ProxyProtocolV1), RoundTripper(&countTransport{}))
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,196 @@
+package forward
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// DefaultRetryMethods stores the idempotent HTTP methods retried by default.
+var DefaultRetryMethods = []string{"GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE"}
+
+// DefaultRetryMaxBodySize stores the default maximum request body size
+// in bytes to buffer in order to replay the request body.
+var DefaultRetryMaxBodySize int64 = 1 << 20
+
+// RetryPolicy defines how failed upstream round trips are retried.
+type RetryPolicy struct {
+	// Attempts defines the maximum number of attempts, including the first one.
+	Attempts int
+	// Backoff defines the time to wait before the first retry.
+	// The wait time is doubled on every subsequent retry.
+	Backoff time.Duration
+	// MaxBackoff defines the maximum time to wait between retries.
+	// Zero means no limit.
+	MaxBackoff time.Duration
+	// Methods defines the retryable HTTP methods.
+	// Defaults to DefaultRetryMethods.
+	Methods []string
+	// StatusCodes defines the upstream response status codes to retry, if any.
+	StatusCodes []int
+	// Timeouts enables retrying requests who failed due to a network timeout.
+	Timeouts bool
+	// MaxBodySize defines the maximum request body size to buffer in order to
+	// replay the request. Requests with bigger bodies are not retried.
+	// Defaults to DefaultRetryMaxBodySize.
+	MaxBodySize int64
+}
+
+// Retry defines the retry policy used to retry failed round trips
+// of idempotent requests.
+func Retry(policy RetryPolicy) OptSetter {
+	return func(f *Forwarder) error {
+		if policy.Attempts < 1 {
+			return errors.New("forward: retry attempts must be greater than zero")
+		}
+		if policy.Methods == nil {
+			policy.Methods = DefaultRetryMethods
+		}
+		if policy.MaxBodySize == 0 {
+			policy.MaxBodySize = DefaultRetryMaxBodySize
+		}
+		f.httpForwarder.retry = &policy
+		return nil
+	}
+}
+
+// canRetry reports whether the given request method can be retried.
+func (p *RetryPolicy) canRetry(req *http.Request) bool {
+	for _, method := range p.Methods {
+		if req.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// shouldRetry reports whether the round trip result should be retried.
+func (p *RetryPolicy) shouldRetry(res *http.Response, err error) bool {
+	if err != nil {
+		return IsRetryableError(err, p.Timeouts)
+	}
+	for _, code := range p.StatusCodes {
+		if res.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the time to wait before the given retry attempt.
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.Backoff
+	for i := 1; i < retry; i++ {
+		if p.MaxBackoff > 0 && wait >= p.MaxBackoff {
+			break
+		}
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// IsRetryableError reports whether the given round trip error is caused by
+// a network failure who is safe to retry, such as refused or reset connections.
+// Timeout errors are only considered retryable if timeouts is true.
+func IsRetryableError(err error, timeouts bool) bool {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var netErr net.Error
+	if !errors.As(err, &netErr) {
+		return false
+	}
+	if netErr.Timeout() {
+		return timeouts
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// retryRoundTrip performs the round trip of the given request
+// retrying it based on the configured retry policy.
+func (f *httpForwarder) retryRoundTrip(req *http.Request, ctx *handlerContext) (*http.Response, error) {
+	policy := f.retry
+	if !policy.canRetry(req) {
+		return f.roundTripper.RoundTrip(req)
+	}
+
+	body, ok, err := bufferBody(req, policy.MaxBodySize)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return f.roundTripper.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if body != nil {
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+
+		res, err := f.roundTripper.RoundTrip(req)
+		if attempt >= policy.Attempts || req.Context().Err() != nil || !policy.shouldRetry(res, err) {
+			return res, err
+		}
+
+		if err != nil {
+			ctx.log.Warningf("Retrying request to %v (attempt %d of %d), err: %v, request ID: %v", req.URL, attempt+1, policy.Attempts, err, utils.RequestID(req))
+		} else {
+			ctx.log.Warningf("Retrying request to %v (attempt %d of %d), code: %v, request ID: %v", req.URL, attempt+1, policy.Attempts, res.StatusCode, utils.RequestID(req))
+			io.Copy(ioutil.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		// Stop retrying if the client went away or the deadline is exceeded
+		timer := time.NewTimer(policy.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// bufferBody reads the request body up to the given max size in order to replay it.
+// If the body is bigger than the max size, the request body is restored and
+// false is returned, meaning the request cannot be retried.
+func bufferBody(req *http.Request, max int64) ([]byte, bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > max {
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+
+	req.Body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, true, nil
+}
+
+// readCloser composes an io.Reader with a different io.Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
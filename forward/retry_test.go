@@ -0,0 +1,188 @@
+package forward
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+// countTransport counts the round trips delegated to the default transport.
+type countTransport struct {
+	calls int
+}
+
+func (t *countTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newRetryProxy(t *testing.T, target string, setters ...OptSetter) *httptest.Server {
+	f, err := New(setters...)
+	st.Expect(t, err, nil)
+	return testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		req.URL = testutils.ParseURI(target)
+		f.ServeHTTP(w, req)
+	})
+}
+
+func TestRetryStatusCodes(t *testing.T) {
+	calls := 0
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello"))
+	})
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, Retry(RetryPolicy{Attempts: 3, StatusCodes: []int{503}}))
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, calls, 3)
+}
+
+func TestRetryMaxAttempts(t *testing.T) {
+	calls := 0
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, Retry(RetryPolicy{Attempts: 2, StatusCodes: []int{503}}))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusServiceUnavailable)
+	st.Expect(t, calls, 2)
+}
+
+func TestRetryNonIdempotentMethod(t *testing.T) {
+	calls := 0
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, Retry(RetryPolicy{Attempts: 3, StatusCodes: []int{503}}))
+	defer proxy.Close()
+
+	res, _, err := testutils.Post(proxy.URL, testutils.Body("hello"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusServiceUnavailable)
+	st.Expect(t, calls, 1)
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	bodies := []string{}
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(body)
+	})
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL, Retry(RetryPolicy{Attempts: 2, StatusCodes: []int{502}}))
+	defer proxy.Close()
+
+	res, body, err := testutils.MakeRequest(proxy.URL, testutils.Method("PUT"), testutils.Body("hello"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, bodies, []string{"hello", "hello"})
+}
+
+func TestRetryBodyTooLarge(t *testing.T) {
+	calls := 0
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(req.Body)
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(body)
+	})
+	defer srv.Close()
+
+	policy := RetryPolicy{Attempts: 3, StatusCodes: []int{502}, MaxBodySize: 4}
+	proxy := newRetryProxy(t, srv.URL, Retry(policy))
+	defer proxy.Close()
+
+	res, body, err := testutils.MakeRequest(proxy.URL, testutils.Method("PUT"), testutils.Body("hello world"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+	st.Expect(t, string(body), "hello world")
+	st.Expect(t, calls, 1)
+}
+
+func TestRetryConnectionRefused(t *testing.T) {
+	transport := &countTransport{}
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	proxy := newRetryProxy(t, "http://localhost:63450", RoundTripper(transport), Retry(policy))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+	st.Expect(t, transport.calls, 3)
+}
+
+func TestRetryInvalidPolicy(t *testing.T) {
+	_, err := New(Retry(RetryPolicy{}))
+	st.Reject(t, err, nil)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	st.Expect(t, policy.backoff(1), 10*time.Millisecond)
+	st.Expect(t, policy.backoff(2), 20*time.Millisecond)
+	st.Expect(t, policy.backoff(3), 40*time.Millisecond)
+	st.Expect(t, policy.backoff(4), 50*time.Millisecond)
+	st.Expect(t, policy.backoff(100), 50*time.Millisecond)
+}
+
+// timeoutError implements a net.Error timeout error.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRetryableError(t *testing.T) {
+	cases := []struct {
+		err       error
+		timeouts  bool
+		retryable bool
+	}{
+		{io.EOF, false, true},
+		{&net.OpError{Op: "dial", Err: errors.New("no such host")}, false, true},
+		{&net.OpError{Op: "read", Err: syscall.ECONNRESET}, false, true},
+		{&net.OpError{Op: "read", Err: errors.New("foo")}, false, false},
+		{timeoutError{}, false, false},
+		{timeoutError{}, true, true},
+		{errors.New("foo"), true, false},
+	}
+
+	for _, test := range cases {
+		st.Expect(t, IsRetryableError(test.err, test.timeouts), test.retryable)
+	}
+}
@@ -10,31 +10,53 @@ import (
 
 // HeaderRewriter is responsible for removing hop-by-hop headers and setting forwarding headers.
 type HeaderRewriter struct {
+	// TrustForwardHeader trusts the forwarding headers sent by any client.
 	TrustForwardHeader bool
-	Hostname           string
+	// TrustedProxies stores the networks of the proxies whose forwarding headers are trusted.
+	// Used to derive the real client IP skipping the trusted proxies in the forwarding chain.
+	TrustedProxies []*net.IPNet
+	// Forwarded enables parsing and setting the RFC 7239 Forwarded header.
+	// The Forwarded header sent by untrusted clients is dropped regardless.
+	Forwarded bool
+	Hostname  string
 }
 
 // Rewrite rewrites the given request removing hop-by-hop headers and setting forwarding headers.
 func (rw *HeaderRewriter) Rewrite(req *http.Request) {
-	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
-		if rw.TrustForwardHeader {
-			if prior, ok := req.Header[XForwardedFor]; ok {
-				clientIP = strings.Join(prior, ", ") + ", " + clientIP
-			}
+	peerIP, _, err := net.SplitHostPort(req.RemoteAddr)
+	trusted := rw.TrustForwardHeader || (err == nil && rw.isTrustedProxy(peerIP))
+
+	var forwarded []forwardedElement
+	if rw.Forwarded && trusted {
+		forwarded = parseForwarded(req.Header[Forwarded])
+	}
+
+	if err == nil {
+		chain := []string{}
+		if trusted {
+			chain = rw.forwardedFor(req, forwarded)
 		}
-		req.Header.Set(XForwardedFor, clientIP)
+		chain = append(chain, peerIP)
+		req.Header.Set(XForwardedFor, strings.Join(chain, ", "))
+		req.Header.Set(XRealIP, rw.clientIP(chain))
 	}
 
-	if xfp := req.Header.Get(XForwardedProto); xfp != "" && rw.TrustForwardHeader {
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	if xfp := req.Header.Get(XForwardedProto); xfp != "" && trusted {
 		req.Header.Set(XForwardedProto, xfp)
-	} else if req.TLS != nil {
-		req.Header.Set(XForwardedProto, "https")
+	} else if len(forwarded) > 0 && forwarded[0]["proto"] != "" {
+		req.Header.Set(XForwardedProto, forwarded[0]["proto"])
 	} else {
-		req.Header.Set(XForwardedProto, "http")
+		req.Header.Set(XForwardedProto, proto)
 	}
 
-	if xfh := req.Header.Get(XForwardedHost); xfh != "" && rw.TrustForwardHeader {
+	if xfh := req.Header.Get(XForwardedHost); xfh != "" && trusted {
 		req.Header.Set(XForwardedHost, xfh)
+	} else if len(forwarded) > 0 && forwarded[0]["host"] != "" {
+		req.Header.Set(XForwardedHost, forwarded[0]["host"])
 	} else if req.Host != "" {
 		req.Header.Set(XForwardedHost, req.Host)
 	}
@@ -43,9 +65,74 @@ func (rw *HeaderRewriter) Rewrite(req *http.Request) {
 		req.Header.Set(XForwardedServer, rw.Hostname)
 	}
 
+	if rw.Forwarded {
+		element := formatForwarded(peerIP, req.Host, proto)
+		if prior := req.Header[Forwarded]; trusted && len(prior) > 0 {
+			element = strings.Join(prior, ", ") + ", " + element
+		}
+		req.Header.Set(Forwarded, element)
+	} else if !trusted {
+		// Forwarded headers sent by untrusted clients are never passed upstream
+		req.Header.Del(Forwarded)
+	}
+
 	// Remove hop-by-hop headers to the backend.
 	// Especially important is "Connection" because we want a persistent
 	// connection, regardless of what the client sent to us.
 	// fmt.Printf(">> %#v \n", req.Header)
+	trailers := utils.ConstainsHeader(req, Te, "trailers")
 	utils.RemoveHeaders(req.Header, HopHeaders...)
+
+	// Keep the trailers support announcement, required by gRPC servers
+	if trailers {
+		req.Header.Set(Te, "trailers")
+	}
+}
+
+// forwardedFor returns the client addresses forwarded by the prior proxies,
+// read from the X-Forwarded-For header or the Forwarded header, if enabled.
+func (rw *HeaderRewriter) forwardedFor(req *http.Request, forwarded []forwardedElement) []string {
+	chain := []string{}
+	if prior, ok := req.Header[XForwardedFor]; ok {
+		for _, value := range strings.Split(strings.Join(prior, ","), ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				chain = append(chain, value)
+			}
+		}
+		return chain
+	}
+	for _, element := range forwarded {
+		if node := element["for"]; node != "" {
+			chain = append(chain, forwardedNodeIP(node))
+		}
+	}
+	return chain
+}
+
+// clientIP returns the real client IP from the given forwarding chain,
+// which is the closest address who is not a trusted proxy.
+func (rw *HeaderRewriter) clientIP(chain []string) string {
+	if rw.TrustForwardHeader {
+		return chain[0]
+	}
+	for i := len(chain) - 1; i > 0; i-- {
+		if !rw.isTrustedProxy(chain[i]) {
+			return chain[i]
+		}
+	}
+	return chain[0]
+}
+
+// isTrustedProxy checks if the given IP address belongs to a trusted proxy network.
+func (rw *HeaderRewriter) isTrustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, network := range rw.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
@@ -1 +1,164 @@
 package forward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+func TestHeaderRewriterHopHeaders(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(Connection, "keep-alive")
+	req.Header.Set(Te, "trailers, deflate")
+
+	rw := &HeaderRewriter{Hostname: "vinxi"}
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(Connection), "")
+	st.Expect(t, req.Header.Get(Te), "trailers")
+	st.Expect(t, req.Header.Get(XForwardedFor), "10.0.0.1")
+	st.Expect(t, req.Header.Get(XForwardedServer), "vinxi")
+
+	req.Header.Set(Te, "deflate")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(Te), "")
+}
+
+func TestHeaderRewriterTrustedProxies(t *testing.T) {
+	trusted, err := ParseNetworks("10.0.0.0/8", "192.168.1.10")
+	st.Expect(t, err, nil)
+	rw := &HeaderRewriter{TrustedProxies: trusted}
+
+	// Headers sent by untrusted clients are replaced
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set(XForwardedFor, "6.6.6.6")
+	req.Header.Set(XForwardedProto, "https")
+	req.Header.Set(XForwardedHost, "evil.com")
+	req.Header.Set(XRealIP, "6.6.6.6")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(XForwardedFor), "1.2.3.4")
+	st.Expect(t, req.Header.Get(XForwardedProto), "http")
+	st.Expect(t, req.Header.Get(XForwardedHost), "localhost")
+	st.Expect(t, req.Header.Get(XRealIP), "1.2.3.4")
+
+	// The real client IP is the closest untrusted address in the chain
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set(XForwardedFor, "6.6.6.6, 1.2.3.4, 192.168.1.10")
+	req.Header.Set(XForwardedProto, "https")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(XForwardedFor), "6.6.6.6, 1.2.3.4, 192.168.1.10, 10.0.0.2")
+	st.Expect(t, req.Header.Get(XForwardedProto), "https")
+	st.Expect(t, req.Header.Get(XRealIP), "1.2.3.4")
+
+	// Only trusted proxies in the chain
+	req.Header.Set(XForwardedFor, "10.1.1.1")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(XRealIP), "10.1.1.1")
+
+	// Trusting every client uses the first address of the chain
+	rw = &HeaderRewriter{TrustForwardHeader: true}
+	req.Header.Set(XForwardedFor, "6.6.6.6, 1.2.3.4")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(XRealIP), "6.6.6.6")
+}
+
+func TestHeaderRewriterForwarded(t *testing.T) {
+	trusted, _ := ParseNetworks("10.0.0.0/8")
+	rw := &HeaderRewriter{TrustedProxies: trusted, Forwarded: true}
+
+	req, _ := http.NewRequest("GET", "http://example.com:8080", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set(Forwarded, "for=6.6.6.6")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(Forwarded), `for=1.2.3.4;host="example.com:8080";proto=http`)
+
+	// Forwarded headers from trusted proxies are parsed and extended
+	req, _ = http.NewRequest("GET", "http://localhost", nil)
+	req.RemoteAddr = "[::1]:1234"
+	rw.TrustedProxies, _ = ParseNetworks("::1")
+	req.Header.Set(Forwarded, `For="[2001:db8::1]:4711";proto=https;host=example.com, for=10.0.0.1`)
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(XForwardedFor), "2001:db8::1, 10.0.0.1, ::1")
+	st.Expect(t, req.Header.Get(XForwardedProto), "https")
+	st.Expect(t, req.Header.Get(XForwardedHost), "example.com")
+	st.Expect(t, req.Header.Get(XRealIP), "10.0.0.1")
+	st.Expect(t, req.Header.Get(Forwarded), `For="[2001:db8::1]:4711";proto=https;host=example.com, for=10.0.0.1, for="[::1]";host=localhost;proto=http`)
+}
+
+func TestHeaderRewriterForwardedDisabled(t *testing.T) {
+	trusted, _ := ParseNetworks("10.0.0.0/8")
+	rw := &HeaderRewriter{TrustedProxies: trusted}
+
+	// Forwarded headers from untrusted clients are dropped
+	req, _ := http.NewRequest("GET", "http://localhost", nil)
+	req.RemoteAddr = "1.2.3.4:1234"
+	req.Header.Set(Forwarded, "for=6.6.6.6;host=evil.com")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(Forwarded), "")
+	st.Expect(t, req.Header.Get(XForwardedHost), "localhost")
+
+	// Forwarded headers from trusted proxies are passed as is
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set(Forwarded, "for=1.2.3.4")
+	rw.Rewrite(req)
+	st.Expect(t, req.Header.Get(Forwarded), "for=1.2.3.4")
+}
+
+func TestParseForwarded(t *testing.T) {
+	elements := parseForwarded([]string{`for=192.0.2.60;proto=http;by=203.0.113.43`, `for="_gazonk", for="a,b;c=\"d\""`})
+	st.Expect(t, len(elements), 3)
+	st.Expect(t, elements[0]["by"], "203.0.113.43")
+	st.Expect(t, elements[1]["for"], "_gazonk")
+	st.Expect(t, elements[2]["for"], `a,b;c="d"`)
+
+	_, err := ParseNetworks("10.0.0.0/8", "::1", "foo")
+	st.Reject(t, err, nil)
+}
+
+func TestForwarderTrustedProxies(t *testing.T) {
+	var outHeaders http.Header
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		outHeaders = req.Header
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL, TrustedProxies("10.0.0.0/8"), ForwardedHeader()))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL, testutils.Header(XForwardedFor, "6.6.6.6"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, outHeaders.Get(XForwardedFor), "127.0.0.1")
+	st.Expect(t, outHeaders.Get(XRealIP), "127.0.0.1")
+	st.Expect(t, outHeaders.Get(Forwarded)[:len("for=127.0.0.1;")], "for=127.0.0.1;")
+
+	_, err = New(TrustedProxies("10.0.0.0/33"))
+	st.Reject(t, err, nil)
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseNetworks("10.0.0.0/8")
+	st.Expect(t, err, nil)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	req.Header.Set(XForwardedFor, "6.6.6.6, 1.2.3.4, 10.0.0.1")
+	st.Expect(t, ClientIP(req, trusted), "1.2.3.4")
+	st.Expect(t, ClientIP(req, nil), "10.0.0.2")
+
+	req.Header.Del(XForwardedFor)
+	req.Header.Set(Forwarded, `for="[2001:db8::1]:4711"`)
+	st.Expect(t, ClientIP(req, trusted), "2001:db8::1")
+
+	// Untrusted peers cannot spoof their address
+	req.RemoteAddr = "8.8.8.8:1234"
+	st.Expect(t, ClientIP(req, trusted), "8.8.8.8")
+
+	req.RemoteAddr = "@"
+	st.Expect(t, ClientIP(req, trusted), "@")
+}
@@ -0,0 +1,118 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Timeouts defines the upstream round trip timeouts.
+// Zero values means no timeout.
+type Timeouts struct {
+	// Connect defines the maximum time to establish a new upstream connection.
+	Connect time.Duration
+	// ResponseHeader defines the maximum time to wait for the upstream
+	// response headers once the request has been written.
+	ResponseHeader time.Duration
+	// Total defines the maximum time for the whole upstream round trip,
+	// including reading the response body.
+	Total time.Duration
+}
+
+// Timeout defines the upstream round trip timeouts.
+// Timeout errors are passed to the error handler, which replies
+// with 504 Gateway Timeout by default.
+// Connect and response header timeouts require an *http.Transport round tripper.
+func Timeout(timeouts Timeouts) OptSetter {
+	return func(f *Forwarder) error {
+		if timeouts.Connect < 0 || timeouts.ResponseHeader < 0 || timeouts.Total < 0 {
+			return errors.New("forward: timeouts cannot be negative")
+		}
+		f.httpForwarder.timeouts = timeouts
+		return nil
+	}
+}
+
+// requestContext returns the context for the upstream request derived from
+// the incoming request context, so the upstream request is aborted when the
+// client disconnects or the incoming request deadline, if any, is exceeded.
+func (f *httpForwarder) requestContext(req *http.Request) (context.Context, context.CancelFunc) {
+	if f.timeouts.Total > 0 {
+		return context.WithTimeout(req.Context(), f.timeouts.Total)
+	}
+	return context.WithCancel(req.Context())
+}
+
+// transportWithTimeouts returns a copy of the given transport
+// with the given connect and response header timeouts.
+func transportWithTimeouts(rt http.RoundTripper, timeouts Timeouts) (http.RoundTripper, error) {
+	if timeouts.Connect == 0 && timeouts.ResponseHeader == 0 {
+		return rt, nil
+	}
+
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, errors.New("forward: connect and response header timeouts require an *http.Transport")
+	}
+
+	transport = transport.Clone()
+	if timeouts.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = timeouts.ResponseHeader
+	}
+	if timeouts.Connect > 0 {
+		transport.DialContext = dialWithTimeout(transport, timeouts.Connect)
+		transport.Dial = nil
+	}
+	return transport, nil
+}
+
+// dialFunc represents the context aware dial function used by transports.
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialWithTimeout wraps the dial function of the given transport
+// aborting the dial if the connection cannot be established in time.
+func dialWithTimeout(transport *http.Transport, timeout time.Duration) dialFunc {
+	dial := transport.DialContext
+	if dial == nil && transport.Dial != nil {
+		dial = contextDial(transport.Dial)
+	}
+	if dial == nil {
+		dial = (&net.Dialer{KeepAlive: 30 * time.Second}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return dial(ctx, network, addr)
+	}
+}
+
+// contextDial adapts a legacy dial function to be aborted by the given context.
+func contextDial(dial func(network, addr string) (net.Conn, error)) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		type result struct {
+			conn net.Conn
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			conn, err := dial(network, addr)
+			done <- result{conn, err}
+		}()
+
+		select {
+		case res := <-done:
+			return res.conn, res.err
+		case <-ctx.Done():
+			// Close the connection if it is eventually established
+			go func() {
+				if res := <-done; res.conn != nil {
+					res.conn.Close()
+				}
+			}()
+			return nil, ctx.Err()
+		}
+	}
+}
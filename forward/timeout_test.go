@@ -0,0 +1,119 @@
+package forward
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+func TestTotalTimeout(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-done:
+		}
+	})
+	defer srv.Close()
+	defer close(done)
+
+	proxy := newRetryProxy(t, srv.URL, Timeout(Timeouts{Total: 20 * time.Millisecond}))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusGatewayTimeout)
+}
+
+func TestResponseHeaderTimeout(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+		case <-done:
+		}
+	})
+	defer srv.Close()
+	defer close(done)
+
+	proxy := newRetryProxy(t, srv.URL, Timeout(Timeouts{ResponseHeader: 20 * time.Millisecond}))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusGatewayTimeout)
+}
+
+func TestConnectTimeout(t *testing.T) {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+
+	timeouts := Timeouts{Connect: 20 * time.Millisecond}
+	proxy := newRetryProxy(t, "http://localhost:63450", RoundTripper(transport), Timeout(timeouts))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusGatewayTimeout)
+}
+
+func TestConnectTimeoutLegacyDial(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+
+	transport := &http.Transport{
+		Dial: func(network, addr string) (net.Conn, error) {
+			<-release
+			return nil, context.Canceled
+		},
+	}
+
+	timeouts := Timeouts{Connect: 20 * time.Millisecond}
+	proxy := newRetryProxy(t, "http://localhost:63450", RoundTripper(transport), Timeout(timeouts))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusGatewayTimeout)
+}
+
+func TestTimeoutsRequireTransport(t *testing.T) {
+	_, err := New(RoundTripper(&countTransport{}), Timeout(Timeouts{Connect: time.Second}))
+	st.Reject(t, err, nil)
+
+	_, err = New(RoundTripper(&countTransport{}), Timeout(Timeouts{Total: time.Second}))
+	st.Expect(t, err, nil)
+
+	_, err = New(Timeout(Timeouts{Total: -time.Second}))
+	st.Reject(t, err, nil)
+}
+
+func TestClientCancellation(t *testing.T) {
+	canceled := make(chan bool, 1)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case <-req.Context().Done():
+			canceled <- true
+		case <-time.After(time.Second):
+			canceled <- false
+		}
+	})
+	defer srv.Close()
+
+	proxy := newRetryProxy(t, srv.URL)
+	defer proxy.Close()
+
+	client := &http.Client{Timeout: 20 * time.Millisecond}
+	_, err := client.Get(proxy.URL)
+	st.Reject(t, err, nil)
+	st.Expect(t, <-canceled, true)
+}
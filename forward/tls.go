@@ -0,0 +1,108 @@
+package forward
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// tlsVersions stores the supported minimum TLS versions by name.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// ClientCertificate defines the client certificate and private key files
+// presented to upstream servers requiring mutual TLS authentication.
+func ClientCertificate(certFile, keyFile string) OptSetter {
+	return func(f *Forwarder) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("forward: cannot load client certificate: %v", err)
+		}
+		f.upstreamTLS().Certificates = []tls.Certificate{cert}
+		return nil
+	}
+}
+
+// RootCAs defines the PEM encoded CA certificates file used to verify
+// the upstream server certificates instead of the system CA pool.
+func RootCAs(caFile string) OptSetter {
+	return func(f *Forwarder) error {
+		pool, err := LoadCertPool(caFile)
+		if err != nil {
+			return err
+		}
+		f.upstreamTLS().RootCAs = pool
+		return nil
+	}
+}
+
+// ServerName overrides the server name sent via SNI and
+// used to verify the upstream server certificates.
+func ServerName(name string) OptSetter {
+	return func(f *Forwarder) error {
+		f.upstreamTLS().ServerName = name
+		return nil
+	}
+}
+
+// MinTLSVersion defines the minimum TLS version accepted with upstream servers,
+// such as tls.VersionTLS12.
+func MinTLSVersion(version uint16) OptSetter {
+	return func(f *Forwarder) error {
+		if version < tls.VersionTLS10 || version > tls.VersionTLS13 {
+			return fmt.Errorf("forward: unsupported TLS version: %x", version)
+		}
+		f.upstreamTLS().MinVersion = version
+		return nil
+	}
+}
+
+// ParseTLSVersion parses the given TLS version name, such as "1.2".
+func ParseTLSVersion(name string) (uint16, error) {
+	version, ok := tlsVersions[name]
+	if !ok {
+		return 0, errors.New("forward: unsupported TLS version: " + name)
+	}
+	return version, nil
+}
+
+// LoadCertPool loads a certificate pool from the given PEM encoded certificates file.
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("forward: cannot read CA file: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("forward: no valid certificates found in CA file: " + caFile)
+	}
+	return pool, nil
+}
+
+// upstreamTLS returns the TLS config used with upstream servers, creating it if required.
+func (f *Forwarder) upstreamTLS() *tls.Config {
+	if f.tlsConfig == nil {
+		f.tlsConfig = &tls.Config{}
+	}
+	return f.tlsConfig
+}
+
+// transportWithTLSConfig returns a copy of the given transport
+// using the given TLS config with upstream servers.
+func transportWithTLSConfig(rt http.RoundTripper, config *tls.Config) (http.RoundTripper, error) {
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, errors.New("forward: upstream TLS options require an *http.Transport")
+	}
+
+	transport = transport.Clone()
+	transport.TLSClientConfig = config.Clone()
+	return transport, nil
+}
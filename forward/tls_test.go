@@ -0,0 +1,161 @@
+package forward
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/websocket"
+)
+
+// writePEM writes the given PEM block to a new file in the given directory.
+func writePEM(t *testing.T, dir, name, kind string, data []byte) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0600)
+	st.Expect(t, err, nil)
+	return path
+}
+
+// newClientCertificate generates a self-signed client certificate,
+// returning the certificate and private key files.
+func newClientCertificate(t *testing.T, dir string) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	st.Expect(t, err, nil)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "vinxi"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	st.Expect(t, err, nil)
+	cert, err := x509.ParseCertificate(der)
+	st.Expect(t, err, nil)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	st.Expect(t, err, nil)
+	return cert, writePEM(t, dir, "client.crt", "CERTIFICATE", der), writePEM(t, dir, "client.key", "EC PRIVATE KEY", keyDer)
+}
+
+// newMutualTLSServer starts a TLS server requiring the given client certificate,
+// returning the server and its CA file.
+func newMutualTLSServer(t *testing.T, handler http.Handler, client *x509.Certificate, dir string) (*httptest.Server, string) {
+	pool := x509.NewCertPool()
+	pool.AddCert(client)
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	return srv, writePEM(t, dir, "ca.crt", "CERTIFICATE", srv.Certificate().Raw)
+}
+
+func TestUpstreamMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	client, certFile, keyFile := newClientCertificate(t, dir)
+
+	var serverName, clientName string
+	srv, caFile := newMutualTLSServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		serverName = req.TLS.ServerName
+		clientName = req.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte("hello"))
+	}), client, dir)
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL, ClientCertificate(certFile, keyFile), RootCAs(caFile), ServerName("example.com")))
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, serverName, "example.com")
+	st.Expect(t, clientName, "vinxi")
+
+	// Without the client certificate the TLS handshake fails
+	proxy = testutils.NewHandler(To(srv.URL, RootCAs(caFile)))
+	defer proxy.Close()
+
+	res, _, err = testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+}
+
+func TestUpstreamMutualTLSWebsocket(t *testing.T) {
+	dir := t.TempDir()
+	client, certFile, keyFile := newClientCertificate(t, dir)
+
+	srv, caFile := newMutualTLSServer(t, websocket.Handler(func(conn *websocket.Conn) {
+		conn.Write([]byte("ok"))
+		conn.Close()
+	}), client, dir)
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL, ClientCertificate(certFile, keyFile), RootCAs(caFile))
+	defer proxy.Close()
+
+	resp, err := sendWebsocketRequest(proxy.Listener.Addr().String(), "/ws", "echo", nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, resp, "ok")
+}
+
+func TestUpstreamMinTLSVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := writePEM(t, t.TempDir(), "ca.crt", "CERTIFICATE", srv.Certificate().Raw)
+
+	proxy := testutils.NewHandler(To(srv.URL, RootCAs(caFile), MinTLSVersion(tls.VersionTLS12)))
+	defer proxy.Close()
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+
+	proxy = testutils.NewHandler(To(srv.URL, RootCAs(caFile), MinTLSVersion(tls.VersionTLS13)))
+	defer proxy.Close()
+	res, _, err = testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+}
+
+func TestUpstreamTLSInvalid(t *testing.T) {
+	_, err := New(ClientCertificate("missing.crt", "missing.key"))
+	st.Reject(t, err, nil)
+
+	_, err = New(RootCAs("missing.crt"))
+	st.Reject(t, err, nil)
+
+	_, err = New(MinTLSVersion(0x0200))
+	st.Reject(t, err, nil)
+
+	_, err = New(ServerName("example.com"), RoundTripper(&countTransport{}))
+	st.Reject(t, err, nil)
+
+	version, err := ParseTLSVersion("1.3")
+	st.Expect(t, err, nil)
+	st.Expect(t, version, uint16(tls.VersionTLS13))
+
+	_, err = ParseTLSVersion("1.4")
+	st.Reject(t, err, nil)
+}
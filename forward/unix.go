@@ -0,0 +1,97 @@
+package forward
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// UnixScheme defines the target URL scheme used to forward
+// requests to servers listening on Unix domain sockets, such as:
+//
+//	unix:///run/app.sock
+//	unix:///run/app.sock:/api/v1
+//	unix:///run/app%3Av2.sock:/api/v1
+//
+// The optional path suffix after the socket path is used as target base path.
+// The socket path is percent-decoded, so colons and percent signs
+// in the socket path must be encoded as %3A and %25.
+const UnixScheme = "unix"
+
+// unixHost stores the Host header sent to Unix domain socket servers.
+const unixHost = "localhost"
+
+// ParseUnixTarget parses the given Unix domain socket target URL,
+// returning the socket path and the target base path, if any.
+func ParseUnixTarget(uri string) (socket string, path string, err error) {
+	prefix := UnixScheme + "://"
+	if !strings.HasPrefix(uri, prefix) {
+		return "", "", errors.New("forward: invalid unix target URL: " + uri)
+	}
+
+	socket = strings.TrimPrefix(uri, prefix)
+	if i := strings.Index(socket, ":"); i >= 0 {
+		socket, path = socket[:i], socket[i+1:]
+	}
+	socket, err = url.PathUnescape(socket)
+	if err != nil {
+		return "", "", errors.New("forward: invalid unix target socket path: " + uri)
+	}
+	if socket == "" {
+		return "", "", errors.New("forward: unix target URL must define the socket path: " + uri)
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return "", "", errors.New("forward: unix target URL path must be absolute: " + uri)
+	}
+	return socket, path, nil
+}
+
+// UnixTarget returns the Unix domain socket target URL for the given
+// socket path and optional base path, encoding the socket path as needed.
+func UnixTarget(socket, path string) string {
+	socket = strings.NewReplacer("%", "%25", ":", "%3A").Replace(socket)
+	if path != "" {
+		return UnixScheme + "://" + socket + ":" + path
+	}
+	return UnixScheme + "://" + socket
+}
+
+// unixTarget returns the HTTP target URL for the given Unix domain socket target URL.
+func unixTarget(uri string) (*url.URL, string, error) {
+	socket, path, err := ParseUnixTarget(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	target, err := url.Parse("http://" + unixHost + path)
+	if err != nil {
+		return nil, "", err
+	}
+	return target, socket, nil
+}
+
+// transportWithUnixSocket returns a copy of the given transport who dials the given socket.
+func transportWithUnixSocket(rt http.RoundTripper, socket string) (http.RoundTripper, error) {
+	transport, ok := rt.(*http.Transport)
+	if !ok {
+		return nil, errors.New("forward: unix targets require an *http.Transport")
+	}
+
+	transport = transport.Clone()
+	transport.Proxy = nil
+	transport.Dial = nil
+	transport.DialContext = unixDialer(socket, 30*time.Second)
+	return transport, nil
+}
+
+// unixDialer returns a dial function who connects to the given socket
+// regardless of the network address.
+func unixDialer(socket string, timeout time.Duration) dialFunc {
+	dialer := &net.Dialer{Timeout: timeout}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, "unix", socket)
+	}
+}
@@ -0,0 +1,137 @@
+package forward
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/websocket"
+)
+
+func newUnixServer(t *testing.T, handler http.Handler) (*httptest.Server, string) {
+	dir, err := os.MkdirTemp("", "vinxi")
+	st.Expect(t, err, nil)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "app.sock")
+	listener, err := net.Listen("unix", socket)
+	st.Expect(t, err, nil)
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	return srv, socket
+}
+
+func TestUnixTarget(t *testing.T) {
+	var path, host string
+	srv, socket := newUnixServer(t, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path, host = req.URL.Path, req.Host
+		w.Write([]byte("hello"))
+	}))
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To("unix://" + socket + ":/api"))
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL + "/users")
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, path, "/api/users")
+	st.Expect(t, host, "localhost")
+}
+
+func TestUnixTargetColon(t *testing.T) {
+	dir, err := os.MkdirTemp("", "vinxi:v2")
+	st.Expect(t, err, nil)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "app:v2.sock")
+	listener, err := net.Listen("unix", socket)
+	st.Expect(t, err, nil)
+	var path string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.Path
+		w.Write([]byte("hello"))
+	}))
+	srv.Listener.Close()
+	srv.Listener = listener
+	srv.Start()
+	defer srv.Close()
+
+	target := UnixTarget(socket, "/api")
+	parsed, base, err := ParseUnixTarget(target)
+	st.Expect(t, err, nil)
+	st.Expect(t, parsed, socket)
+	st.Expect(t, base, "/api")
+
+	proxy := testutils.NewHandler(To(target))
+	defer proxy.Close()
+
+	res, body, err := testutils.Get(proxy.URL + "/users")
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, string(body), "hello")
+	st.Expect(t, path, "/api/users")
+}
+
+func TestUnixTargetUnavailable(t *testing.T) {
+	proxy := testutils.NewHandler(To("unix:///non/existent/app.sock"))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusBadGateway)
+}
+
+func TestUnixTargetWebsocket(t *testing.T) {
+	srv, socket := newUnixServer(t, websocket.Handler(func(conn *websocket.Conn) {
+		conn.Write([]byte("ok"))
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To("unix://" + socket))
+	defer proxy.Close()
+
+	resp, err := sendWebsocketRequest(proxy.Listener.Addr().String(), "/ws", "echo", nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, resp, "ok")
+}
+
+func TestParseUnixTarget(t *testing.T) {
+	cases := []struct {
+		uri, socket, path string
+		valid             bool
+	}{
+		{"unix:///run/app.sock", "/run/app.sock", "", true},
+		{"unix:///run/app.sock:/api/v1", "/run/app.sock", "/api/v1", true},
+		{"unix://app.sock:/", "app.sock", "/", true},
+		{"unix://", "", "", false},
+		{"unix:///run/app%3Av2.sock:/api", "/run/app:v2.sock", "/api", true},
+		{"unix:///run/100%25.sock", "/run/100%.sock", "", true},
+		{"unix:///run/app.sock:api", "", "", false},
+		{"unix:///run/app%zz.sock", "", "", false},
+		{"http://localhost", "", "", false},
+	}
+
+	for _, c := range cases {
+		socket, path, err := ParseUnixTarget(c.uri)
+		st.Expect(t, err == nil, c.valid)
+		st.Expect(t, socket, c.socket)
+		st.Expect(t, path, c.path)
+	}
+
+	_, err := New(Target("unix://"))
+	st.Reject(t, err, nil)
+
+	_, err = New(Target("unix:///run/app.sock"), RoundTripper(&countTransport{}))
+	st.Reject(t, err, nil)
+}
@@ -0,0 +1,89 @@
+package forward
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+// DefaultViaPseudonym stores the default pseudonym identifying the current
+// vinxi process in the Via header, used if the request does not define
+// the pseudonym of the proxy instance who handles it.
+var DefaultViaPseudonym = "vinxi-" + utils.NewID()
+
+// viaKey is the request context key used to store the Via pseudonym.
+type viaKey struct{}
+
+// ViaPseudonym defines the pseudonym identifying the proxy instance in the Via header,
+// used to detect and reject requests looping through the same proxy.
+// An empty pseudonym disables both the Via header and the loop detection.
+// By default, the pseudonym defined via WithViaPseudonym is used.
+func ViaPseudonym(pseudonym string) OptSetter {
+	return func(f *Forwarder) error {
+		if strings.ContainsAny(pseudonym, " \t,()") {
+			return fmt.Errorf("forward: invalid Via pseudonym: %q", pseudonym)
+		}
+		f.via = &pseudonym
+		return nil
+	}
+}
+
+// WithViaPseudonym returns a shallow copy of the given request who defines the
+// pseudonym of the proxy instance who handles it, such as the vinxi instance ID,
+// used by the forwarders without an explicit ViaPseudonym.
+func WithViaPseudonym(req *http.Request, pseudonym string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), viaKey{}, pseudonym))
+}
+
+// RequestViaPseudonym returns the Via pseudonym defined in the given request, if any.
+func RequestViaPseudonym(req *http.Request) (string, bool) {
+	pseudonym, ok := req.Context().Value(viaKey{}).(string)
+	return pseudonym, ok
+}
+
+// viaPseudonym returns the Via pseudonym used to forward the given request.
+func (f *Forwarder) viaPseudonym(req *http.Request) string {
+	if f.via != nil {
+		return *f.via
+	}
+	if pseudonym, ok := RequestViaPseudonym(req); ok {
+		return pseudonym
+	}
+	return DefaultViaPseudonym
+}
+
+// isLoop checks if the given request was already forwarded by the proxy
+// identified by the given pseudonym.
+func isLoop(req *http.Request, pseudonym string) bool {
+	for _, value := range req.Header[Via] {
+		for _, entry := range strings.Split(value, ",") {
+			fields := strings.Fields(entry)
+			if len(fields) > 1 && fields[1] == pseudonym {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// appendVia appends the Via header entry of the proxy identified by the given pseudonym.
+func appendVia(req *http.Request, pseudonym string) {
+	entry := fmt.Sprintf("%d.%d %s", req.ProtoMajor, req.ProtoMinor, pseudonym)
+	if prior := req.Header[Via]; len(prior) > 0 {
+		entry = strings.Join(prior, ", ") + ", " + entry
+	}
+	req.Header.Set(Via, entry)
+}
+
+// appendResponseVia appends the Via header entry of the proxy identified
+// by the given pseudonym to the upstream response headers.
+func appendResponseVia(res *http.Response, pseudonym string) {
+	entry := fmt.Sprintf("%d.%d %s", res.ProtoMajor, res.ProtoMinor, pseudonym)
+	if prior := res.Header[Via]; len(prior) > 0 {
+		entry = strings.Join(prior, ", ") + ", " + entry
+	}
+	res.Header.Set(Via, entry)
+}
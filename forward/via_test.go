@@ -0,0 +1,97 @@
+package forward
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+)
+
+func TestViaHeader(t *testing.T) {
+	var via string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		via = req.Header.Get(Via)
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL, ViaPseudonym("edge")))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL, testutils.Header(Via, "1.0 fred, 1.1 p.example.net"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, via, "1.0 fred, 1.1 p.example.net, 1.1 edge")
+
+	res, _, err = testutils.Get(proxy.URL, testutils.Header(Via, "1.1 edge (vinxi)"))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusLoopDetected)
+}
+
+func TestViaLoopDetection(t *testing.T) {
+	calls := 0
+	var proxy *httptest.Server
+	proxy = testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		calls++
+		To(proxy.URL)(w, req)
+	})
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusLoopDetected)
+	st.Expect(t, calls, 2)
+}
+
+func TestViaDisabled(t *testing.T) {
+	var via string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		via = req.Header.Get(Via)
+	})
+	defer srv.Close()
+
+	proxy := testutils.NewHandler(To(srv.URL, ViaPseudonym("")))
+	defer proxy.Close()
+
+	res, _, err := testutils.Get(proxy.URL, testutils.Header(Via, "1.1 "+DefaultViaPseudonym))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusOK)
+	st.Expect(t, via, "1.1 "+DefaultViaPseudonym)
+	st.Expect(t, res.Header.Get(Via), "")
+
+	_, err = New(ViaPseudonym("foo bar"))
+	st.Reject(t, err, nil)
+}
+
+func TestViaRequestPseudonym(t *testing.T) {
+	var via string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		via = req.Header.Get(Via)
+		w.Header().Set(Via, "1.1 upstream")
+	})
+	defer srv.Close()
+
+	fwd, err := New(Target(srv.URL))
+	st.Expect(t, err, nil)
+
+	w := httptest.NewRecorder()
+	fwd.ServeHTTP(w, WithViaPseudonym(httptest.NewRequest("GET", "/", nil), "instance"))
+	st.Expect(t, w.Code, http.StatusOK)
+	st.Expect(t, via, "1.1 instance")
+	st.Expect(t, w.Header().Get(Via), "1.1 upstream, 1.1 instance")
+
+	// Explicit pseudonyms take precedence
+	fwd, err = New(Target(srv.URL), ViaPseudonym("edge"))
+	st.Expect(t, err, nil)
+	w = httptest.NewRecorder()
+	fwd.ServeHTTP(w, WithViaPseudonym(httptest.NewRequest("GET", "/", nil), "instance"))
+	st.Expect(t, via, "1.1 edge")
+	st.Expect(t, w.Header().Get(Via), "1.1 upstream, 1.1 edge")
+
+	// The default pseudonym is used otherwise
+	w = httptest.NewRecorder()
+	To(srv.URL)(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, via, "1.1 "+DefaultViaPseudonym)
+	st.Expect(t, w.Header().Get(Via), "1.1 upstream, 1.1 "+DefaultViaPseudonym)
+}
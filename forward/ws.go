@@ -1,81 +1,216 @@
 package forward
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
-	"gopkg.in/vinxi/vinxi.v0/utils"
+	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
-	"strings"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+var (
+	// DefaultWebsocketDialTimeout stores the default maximum time to dial the upstream server.
+	DefaultWebsocketDialTimeout = 30 * time.Second
+	// DefaultWebsocketHandshakeTimeout stores the default maximum time to complete the upstream handshake.
+	DefaultWebsocketHandshakeTimeout = 30 * time.Second
+	// DefaultWebsocketCloseTimeout stores the default maximum time to wait for the peer
+	// to close its side of the connection once the other side has been closed.
+	DefaultWebsocketCloseTimeout = 5 * time.Second
 )
 
+// ErrWebsocketIdle is used when a websocket connection is closed due to inactivity.
+var ErrWebsocketIdle = errors.New("forward: websocket connection idle timeout")
+
+// WebsocketTimeouts defines the websocket forwarder timeouts.
+type WebsocketTimeouts struct {
+	// Dial defines the maximum time to establish the upstream connection,
+	// including the TLS handshake.
+	// Defaults to DefaultWebsocketDialTimeout.
+	Dial time.Duration
+	// Handshake defines the maximum time to write the upgrade request
+	// and read the upstream handshake response.
+	// Defaults to DefaultWebsocketHandshakeTimeout.
+	Handshake time.Duration
+	// Idle defines the maximum time the connection can be idle,
+	// with no data in any direction. Zero means no idle timeout.
+	Idle time.Duration
+	// Close defines the maximum time to wait for the peer to close its
+	// side of the connection once the other side has been closed.
+	// Defaults to DefaultWebsocketCloseTimeout.
+	Close time.Duration
+}
+
 // websocketForwarder is a handler that can reverse proxy
 // websocket traffic
 type websocketForwarder struct {
 	rewriter        ReqRewriter
+	timeouts        WebsocketTimeouts
 	TLSClientConfig *tls.Config
+	interceptor     WebsocketInterceptor
+	maxMessageSize  int64
+	proxyProtocol   int
+	unixSocket      string
+	observers       []Observer
+}
+
+// frameAware reports whether the websocket messages must be parsed
+// instead of blindly copying the traffic.
+func (f *websocketForwarder) frameAware() bool {
+	return f.interceptor != nil || f.maxMessageSize > 0
 }
 
 // serveHTTP forwards websocket traffic
 func (f *websocketForwarder) serveHTTP(w http.ResponseWriter, req *http.Request, ctx *handlerContext) {
-	outReq := f.copyRequest(req)
-	host := outReq.URL.Host
-	dial := net.Dial
-
-	// if host does not specify a port, use the default http port
-	if !strings.Contains(host, ":") {
-		if outReq.URL.Scheme == "wss" {
-			host = host + ":443"
-		} else {
-			host = host + ":80"
-		}
-	}
+	obs, outReq := newObservation(f.observers, f.copyRequest(req))
 
-	if outReq.URL.Scheme == "wss" {
-		if f.TLSClientConfig == nil {
-			f.TLSClientConfig = &tls.Config{}
-		}
-		dial = func(network, address string) (net.Conn, error) {
-			return tls.Dial("tcp", host, f.TLSClientConfig)
-		}
+	targetConn, err := f.dial(req, outReq.URL)
+	if err != nil {
+		ctx.log.Errorf("Error dialing `%v`: %v, request ID: %v", outReq.URL.Host, err, utils.RequestID(req))
+		obs.done(0, err)
+		ctx.errHandler.ServeHTTP(w, req, err)
+		return
 	}
+	defer targetConn.Close()
 
-	targetConn, err := dial("tcp", host)
+	// Write the upgrade request and read the upstream handshake response
+	targetConn.SetDeadline(time.Now().Add(f.timeouts.Handshake))
+	if err = outReq.Write(targetConn); err != nil {
+		ctx.log.Errorf("Unable to copy request to target: %v, request ID: %v", err, utils.RequestID(req))
+		obs.done(0, err)
+		ctx.errHandler.ServeHTTP(w, req, err)
+		return
+	}
+	targetReader := bufio.NewReader(targetConn)
+	res, err := http.ReadResponse(targetReader, outReq)
 	if err != nil {
-		ctx.log.Errorf("Error dialing `%v`: %v", host, err)
+		ctx.log.Errorf("Unable to read the upstream handshake response: %v, request ID: %v", err, utils.RequestID(req))
+		obs.done(0, err)
 		ctx.errHandler.ServeHTTP(w, req, err)
 		return
 	}
+	targetConn.SetDeadline(time.Time{})
+	obs.response(res)
+	if via, _ := RequestViaPseudonym(req); via != "" {
+		appendResponseVia(res, via)
+	}
+
+	// If the upstream server refuses the upgrade, just reply with its response
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		defer res.Body.Close()
+		ctx.log.Infof("Websocket upgrade refused by %v, code: %v", outReq.URL, res.StatusCode)
+		utils.CopyHeaders(w.Header(), res.Header)
+		w.WriteHeader(res.StatusCode)
+		written, err := io.Copy(w, res.Body)
+		obs.done(written, err)
+		return
+	}
+
 	hijacker, ok := w.(http.Hijacker)
 	if !ok {
-		ctx.log.Errorf("Unable to hijack the connection: %v", err)
+		err = errors.New("forward: response writer cannot be hijacked")
+		ctx.log.Errorf("Unable to hijack the connection: %v, request ID: %v", err, utils.RequestID(req))
+		obs.done(0, err)
 		ctx.errHandler.ServeHTTP(w, req, err)
 		return
 	}
-	underlyingConn, _, err := hijacker.Hijack()
+	clientConn, clientBuf, err := hijacker.Hijack()
 	if err != nil {
-		ctx.log.Errorf("Unable to hijack the connection: %v", err)
+		ctx.log.Errorf("Unable to hijack the connection: %v, request ID: %v", err, utils.RequestID(req))
+		obs.done(0, err)
 		ctx.errHandler.ServeHTTP(w, req, err)
 		return
 	}
 	// it is now caller's responsibility to Close the underlying connection
-	defer underlyingConn.Close()
-	defer targetConn.Close()
+	defer clientConn.Close()
 
-	// write the modified incoming request to the dialed connection
-	if err = outReq.Write(targetConn); err != nil {
-		ctx.log.Errorf("Unable to copy request to target: %v", err)
-		ctx.errHandler.ServeHTTP(w, req, err)
+	// Reply to the client with the upstream handshake response.
+	// The round trip completes once the handshake is done.
+	err = writeHandshake(clientConn, res)
+	obs.done(0, err)
+	if err != nil {
+		ctx.log.Errorf("Unable to write the handshake response to the client: %v, request ID: %v", err, utils.RequestID(req))
 		return
 	}
-	errc := make(chan error, 2)
-	replicate := func(dst io.Writer, src io.Reader) {
-		_, err := io.Copy(dst, src)
-		errc <- err
+
+	// Data already buffered during the handshake must be sent first
+	clientSrc := io.MultiReader(buffered(clientBuf.Reader), clientConn)
+	targetSrc := io.MultiReader(buffered(targetReader), targetConn)
+
+	t := newTunnel(clientConn, targetConn, f.timeouts.Idle, f.timeouts.Close)
+	if f.frameAware() {
+		t.interceptor = f.interceptor
+		t.maxMessageSize = f.maxMessageSize
+		t.req = outReq
+	}
+	if err = t.run(clientSrc, targetSrc); err != nil {
+		ctx.log.Infof("Websocket connection to %v closed: %v", outReq.URL, err)
 	}
-	go replicate(targetConn, underlyingConn)
-	go replicate(underlyingConn, targetConn)
-	<-errc
+}
+
+// dial establishes the connection with the upstream server,
+// writing the PROXY protocol header first, if enabled.
+func (f *websocketForwarder) dial(req *http.Request, u *url.URL) (net.Conn, error) {
+	ctx := req.Context()
+	secure := u.Scheme == "wss" || u.Scheme == "https"
+
+	// if host does not specify a port, use the default port for the scheme
+	host := u.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		if secure {
+			host = net.JoinHostPort(host, "443")
+		} else {
+			host = net.JoinHostPort(host, "80")
+		}
+	}
+
+	// The dial timeout includes the TLS handshake
+	ctx, cancel := context.WithTimeout(ctx, f.timeouts.Dial)
+	defer cancel()
+
+	network := "tcp"
+	if f.unixSocket != "" {
+		network, host = "unix", f.unixSocket
+	}
+
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, network, host)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.proxyProtocol != 0 {
+		if _, err = conn.Write(proxyHeader(req, f.proxyProtocol)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if !secure {
+		return conn, nil
+	}
+
+	config := &tls.Config{}
+	if f.TLSClientConfig != nil {
+		config = f.TLSClientConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	tlsConn := tls.Client(conn, config)
+	if err = tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
 }
 
 // copyRequest makes a copy of the specified request.
@@ -85,5 +220,275 @@ func (f *websocketForwarder) copyRequest(req *http.Request) (outReq *http.Reques
 	outReq.URL = utils.CopyURL(req.URL)
 	outReq.URL.Scheme = req.URL.Scheme
 	outReq.URL.Host = req.URL.Host
+
+	outReq.Header = make(http.Header)
+	utils.CopyHeaders(outReq.Header, req.Header)
+
+	if f.rewriter != nil {
+		f.rewriter.Rewrite(outReq)
+	}
+
+	// Restore the upgrade headers, since hop-by-hop headers are removed by rewriters
+	outReq.Header.Set(Connection, "Upgrade")
+	outReq.Header.Set(Upgrade, req.Header.Get(Upgrade))
+
+	// Extensions, such as compression, cannot be negotiated if the messages are parsed
+	if f.frameAware() {
+		outReq.Header.Del(SecWebsocketExtensions)
+	}
 	return outReq
 }
+
+// writeHandshake writes the upstream handshake response to the client connection.
+func writeHandshake(w io.Writer, res *http.Response) error {
+	if _, err := fmt.Fprintf(w, "HTTP/1.1 %s\r\n", res.Status); err != nil {
+		return err
+	}
+	if err := res.Header.Write(w); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\r\n")
+	return err
+}
+
+// buffered returns a reader with the data already buffered by the given reader.
+func buffered(r *bufio.Reader) io.Reader {
+	data, _ := r.Peek(r.Buffered())
+	return bytes.NewReader(data)
+}
+
+// closeWriter is implemented by connections supporting half-close.
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// tunnel represents a bidirectional websocket connection between
+// the client and the upstream server.
+type tunnel struct {
+	client net.Conn
+	target net.Conn
+	// idle defines the maximum idle time, zero means no limit.
+	idle time.Duration
+	// grace defines the time to wait for the peer to close its side.
+	grace time.Duration
+	// interceptor, maxMessageSize and req are only used in frame-aware mode.
+	interceptor    WebsocketInterceptor
+	maxMessageSize int64
+	req            *http.Request
+	// last stores the last activity time in unix nanoseconds.
+	last int64
+	once sync.Once
+	done chan struct{}
+	// expired is set once the tunnel is closed due to inactivity.
+	expired int32
+}
+
+// newTunnel creates a new tunnel between the given connections.
+func newTunnel(client, target net.Conn, idle, grace time.Duration) *tunnel {
+	return &tunnel{
+		client: client,
+		target: target,
+		idle:   idle,
+		grace:  grace,
+		last:   time.Now().UnixNano(),
+		done:   make(chan struct{}),
+	}
+}
+
+// run replicates the traffic in both directions until both peers close
+// the connection, the connection is idle or the close timeout is exceeded.
+func (t *tunnel) run(clientSrc, targetSrc io.Reader) error {
+	errc := make(chan error, 2)
+	if t.maxMessageSize > 0 {
+		client := &peer{conn: t.client, last: &t.last}
+		target := &peer{conn: t.target, last: &t.last, mask: true}
+		go t.relay(FromClient, clientSrc, target, client, errc)
+		go t.relay(FromServer, targetSrc, client, target, errc)
+	} else {
+		go t.replicate(t.target, clientSrc, errc)
+		go t.replicate(t.client, targetSrc, errc)
+	}
+	go t.watch()
+	defer t.stop()
+
+	// Once one side is closed, the peer has a limited time to close its side
+	err := <-errc
+	timer := time.NewTimer(t.grace)
+	defer timer.Stop()
+
+	select {
+	case err2 := <-errc:
+		if err == nil {
+			err = err2
+		}
+	case <-timer.C:
+		t.stop()
+		<-errc
+	}
+
+	if atomic.LoadInt32(&t.expired) == 1 {
+		return ErrWebsocketIdle
+	}
+	return err
+}
+
+// replicate copies the data from the source to the destination connection,
+// half-closing the destination connection once the source is consumed.
+func (t *tunnel) replicate(dst net.Conn, src io.Reader, errc chan<- error) {
+	_, err := io.Copy(activityWriter{dst, &t.last}, src)
+	if cw, ok := dst.(closeWriter); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	errc <- err
+}
+
+// relay reads the websocket messages from the source, passes them to the
+// interceptor, if any, and writes them to the destination peer.
+// Protocol errors and interceptor close actions close both peers.
+func (t *tunnel) relay(dir WebsocketDirection, src io.Reader, dst, from *peer, errc chan<- error) {
+	reader := &messageReader{r: src, max: t.maxMessageSize}
+	for {
+		opcode, payload, err := reader.next()
+		if err == io.EOF {
+			dst.closeWrite()
+			errc <- nil
+			return
+		}
+		if err != nil {
+			closePeers(closeCode(err), from, dst)
+			errc <- err
+			return
+		}
+
+		msg := &WebsocketMessage{Direction: dir, Opcode: opcode, Payload: payload, Request: t.req}
+		action := ActionForward
+		if t.interceptor != nil {
+			action = t.interceptor.Intercept(msg)
+		}
+
+		switch action {
+		case ActionDrop:
+			continue
+		case ActionClose:
+			closePeers(ClosePolicyViolation, from, dst)
+			errc <- ErrWebsocketIntercepted
+			return
+		}
+
+		if msg.Opcode.IsControl() && len(msg.Payload) > maxControlPayload {
+			closePeers(CloseInternalError, from, dst)
+			errc <- ErrWebsocketProtocol
+			return
+		}
+		if err := dst.write(msg.Opcode, msg.Payload); err != nil {
+			from.closeWrite()
+			errc <- err
+			return
+		}
+	}
+}
+
+// watch closes the tunnel if the connection is idle for too long.
+func (t *tunnel) watch() {
+	if t.idle <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(t.idle / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			last := time.Unix(0, atomic.LoadInt64(&t.last))
+			if time.Since(last) >= t.idle {
+				atomic.StoreInt32(&t.expired, 1)
+				t.stop()
+				return
+			}
+		}
+	}
+}
+
+// stop closes both connections, unblocking any pending copy.
+func (t *tunnel) stop() {
+	t.once.Do(func() {
+		close(t.done)
+		t.client.Close()
+		t.target.Close()
+	})
+}
+
+// peer represents one side of a frame-aware tunnel.
+// Writes are serialized since both relays can close the peer.
+type peer struct {
+	sync.Mutex
+	conn   net.Conn
+	last   *int64
+	mask   bool
+	closed bool
+}
+
+// write writes a websocket frame to the peer, unless it has been closed.
+func (p *peer) write(opcode WebsocketOpcode, payload []byte) error {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return nil
+	}
+	return writeFrame(activityWriter{p.conn, p.last}, opcode, payload, p.mask)
+}
+
+// close sends a close frame with the given status code and half-closes the peer.
+// The peer connection is fully closed once the tunnel is stopped.
+func (p *peer) close(code int) {
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		return
+	}
+	writeFrame(p.conn, OpClose, closePayload(code), p.mask)
+	p.closeConn()
+}
+
+// closeWrite half-closes the peer connection.
+func (p *peer) closeWrite() {
+	p.Lock()
+	defer p.Unlock()
+	if !p.closed {
+		p.closeConn()
+	}
+}
+
+// closeConn must be called with the lock held.
+func (p *peer) closeConn() {
+	p.closed = true
+	if cw, ok := p.conn.(closeWriter); ok {
+		cw.CloseWrite()
+	} else {
+		p.conn.Close()
+	}
+}
+
+// closePeers closes the given peers with the given status code.
+func closePeers(code int, peers ...*peer) {
+	for _, p := range peers {
+		p.close(code)
+	}
+}
+
+// activityWriter records the last write time in the given timestamp.
+type activityWriter struct {
+	io.Writer
+	last *int64
+}
+
+// Write writes the given data and records the activity.
+func (w activityWriter) Write(buf []byte) (int, error) {
+	atomic.StoreInt64(w.last, time.Now().UnixNano())
+	return w.Writer.Write(buf)
+}
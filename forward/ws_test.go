@@ -1 +1,297 @@
 package forward
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"golang.org/x/net/websocket"
+)
+
+// rawUpgrade sends a websocket upgrade request to the given server address
+// returning the connection and the handshake response.
+func rawUpgrade(t *testing.T, addr string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	st.Expect(t, err, nil)
+
+	fmt.Fprintf(conn, "GET /ws HTTP/1.1\r\nHost: %s\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", addr)
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	st.Expect(t, err, nil)
+	return conn, reader, res
+}
+
+// hijackUpgrade accepts the websocket upgrade and returns the hijacked connection.
+func hijackUpgrade(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter) {
+	conn, buf, _ := w.(http.Hijacker).Hijack()
+	conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	return conn, buf
+}
+
+func newWebsocketProxy(t *testing.T, target string, setters ...OptSetter) *httptest.Server {
+	f, err := New(setters...)
+	st.Expect(t, err, nil)
+	return testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.Path
+		req.URL = testutils.ParseURI(target)
+		req.URL.Path = path
+		f.ServeHTTP(w, req)
+	})
+}
+
+func TestWebsocketForwardedHeaders(t *testing.T) {
+	var outHeaders http.Header
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		outHeaders = req.Header
+		conn, _ := hijackUpgrade(w)
+		conn.Close()
+	})
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL)
+	defer proxy.Close()
+
+	conn, _, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+
+	st.Expect(t, res.StatusCode, http.StatusSwitchingProtocols)
+	st.Expect(t, res.Header.Get(Upgrade), "websocket")
+	st.Expect(t, outHeaders.Get(XForwardedFor), "127.0.0.1")
+	st.Expect(t, outHeaders.Get(XForwardedProto), "http")
+	st.Expect(t, outHeaders.Get(Connection), "Upgrade")
+	st.Expect(t, outHeaders.Get(Upgrade), "websocket")
+}
+
+func TestWebsocketUpgradeRefused(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Reason", "forbidden")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("not allowed"))
+	})
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL)
+	defer proxy.Close()
+
+	conn, _, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, http.StatusForbidden)
+	st.Expect(t, res.Header.Get("X-Reason"), "forbidden")
+	st.Expect(t, string(body), "not allowed")
+}
+
+func TestWebsocketHandshakeTimeout(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		<-done
+	})
+	defer srv.Close()
+	defer close(done)
+
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketTimeout(WebsocketTimeouts{Handshake: 20 * time.Millisecond}))
+	defer proxy.Close()
+
+	conn, _, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+	st.Expect(t, res.StatusCode, http.StatusGatewayTimeout)
+}
+
+func TestWebsocketHalfClose(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		conn, buf := hijackUpgrade(w)
+		defer conn.Close()
+		// Read until the client closes its side, then reply
+		data, _ := ioutil.ReadAll(io.MultiReader(buf.Reader, conn))
+		conn.Write([]byte("bye " + string(data)))
+	})
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL)
+	defer proxy.Close()
+
+	conn, reader, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+	st.Expect(t, res.StatusCode, http.StatusSwitchingProtocols)
+
+	conn.Write([]byte("hello"))
+	conn.(*net.TCPConn).CloseWrite()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := ioutil.ReadAll(reader)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(data), "bye hello")
+}
+
+func TestWebsocketIdleTimeout(t *testing.T) {
+	done := make(chan bool)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		conn, _ := hijackUpgrade(w)
+		defer conn.Close()
+		<-done
+	})
+	defer srv.Close()
+	defer close(done)
+
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketTimeout(WebsocketTimeouts{Idle: 20 * time.Millisecond}))
+	defer proxy.Close()
+
+	conn, reader, res := rawUpgrade(t, proxy.Listener.Addr().String())
+	defer conn.Close()
+	st.Expect(t, res.StatusCode, http.StatusSwitchingProtocols)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := reader.ReadByte()
+	st.Expect(t, err, io.EOF)
+}
+
+func TestSecureWebsocketTraffic(t *testing.T) {
+	srv := httptest.NewTLSServer(websocket.Handler(func(conn *websocket.Conn) {
+		conn.Write([]byte("ok"))
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	target := "wss://" + srv.Listener.Addr().String()
+	proxy := newWebsocketProxy(t, target, WebsocketTLSConfig(&tls.Config{InsecureSkipVerify: true}))
+	defer proxy.Close()
+
+	resp, err := sendWebsocketRequest(proxy.Listener.Addr().String(), "/ws", "echo", nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, resp, "ok")
+}
+
+// dialWebsocket opens a websocket client connection to the given server address.
+func dialWebsocket(t *testing.T, addr string, header http.Header) *websocket.Conn {
+	config := newWebsocketConfig(addr, "/ws")
+	for key, values := range header {
+		config.Header[key] = values
+	}
+	conn, err := websocket.DialConfig(config)
+	st.Expect(t, err, nil)
+	return conn
+}
+
+func newEchoServer() *httptest.Server {
+	return httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		io.Copy(conn, conn)
+	}))
+}
+
+func TestWebsocketInterceptorModify(t *testing.T) {
+	srv := newEchoServer()
+	defer srv.Close()
+
+	directions := make(chan WebsocketDirection, 2)
+	interceptor := WebsocketInterceptorFunc(func(msg *WebsocketMessage) WebsocketAction {
+		if msg.Opcode == OpText {
+			directions <- msg.Direction
+			msg.Payload = append(msg.Payload, []byte(" "+msg.Direction.String())...)
+		}
+		return ActionForward
+	})
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketInterception(interceptor))
+	defer proxy.Close()
+
+	resp, err := sendWebsocketRequest(proxy.Listener.Addr().String(), "/ws", "hello", nil)
+	st.Expect(t, err, nil)
+	st.Expect(t, resp, "hello client server")
+	st.Expect(t, <-directions, FromClient)
+	st.Expect(t, <-directions, FromServer)
+}
+
+func TestWebsocketInterceptorDrop(t *testing.T) {
+	srv := newEchoServer()
+	defer srv.Close()
+
+	interceptor := WebsocketInterceptorFunc(func(msg *WebsocketMessage) WebsocketAction {
+		if string(msg.Payload) == "drop" {
+			return ActionDrop
+		}
+		return ActionForward
+	})
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketInterception(interceptor))
+	defer proxy.Close()
+
+	conn := dialWebsocket(t, proxy.Listener.Addr().String(), nil)
+	defer conn.Close()
+
+	st.Expect(t, websocket.Message.Send(conn, "drop"), nil)
+	st.Expect(t, websocket.Message.Send(conn, "keep"), nil)
+
+	var msg string
+	st.Expect(t, websocket.Message.Receive(conn, &msg), nil)
+	st.Expect(t, msg, "keep")
+}
+
+func TestWebsocketInterceptorClose(t *testing.T) {
+	closed := make(chan error, 1)
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		var msg string
+		closed <- websocket.Message.Receive(conn, &msg)
+	}))
+	defer srv.Close()
+
+	interceptor := WebsocketInterceptorFunc(func(msg *WebsocketMessage) WebsocketAction {
+		return ActionClose
+	})
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketInterception(interceptor))
+	defer proxy.Close()
+
+	conn := dialWebsocket(t, proxy.Listener.Addr().String(), nil)
+	defer conn.Close()
+
+	st.Expect(t, websocket.Message.Send(conn, "bad"), nil)
+
+	var msg string
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	st.Expect(t, websocket.Message.Receive(conn, &msg), io.EOF)
+	st.Expect(t, <-closed, io.EOF)
+}
+
+func TestWebsocketMaxMessageSize(t *testing.T) {
+	srv := newEchoServer()
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketMaxMessageSize(4))
+	defer proxy.Close()
+
+	conn := dialWebsocket(t, proxy.Listener.Addr().String(), nil)
+	defer conn.Close()
+
+	var msg string
+	st.Expect(t, websocket.Message.Send(conn, "ping"), nil)
+	st.Expect(t, websocket.Message.Receive(conn, &msg), nil)
+	st.Expect(t, msg, "ping")
+
+	st.Expect(t, websocket.Message.Send(conn, "hello world"), nil)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	st.Expect(t, websocket.Message.Receive(conn, &msg), io.EOF)
+}
+
+func TestWebsocketInterceptorExtensions(t *testing.T) {
+	extensions := make(chan string, 1)
+	srv := httptest.NewServer(websocket.Handler(func(conn *websocket.Conn) {
+		extensions <- conn.Request().Header.Get(SecWebsocketExtensions)
+	}))
+	defer srv.Close()
+
+	proxy := newWebsocketProxy(t, srv.URL, WebsocketMaxMessageSize(1024))
+	defer proxy.Close()
+
+	header := http.Header{SecWebsocketExtensions: {"permessage-deflate"}}
+	conn := dialWebsocket(t, proxy.Listener.Addr().String(), header)
+	defer conn.Close()
+	st.Expect(t, <-extensions, "")
+}
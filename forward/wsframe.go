@@ -0,0 +1,303 @@
+package forward
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// WebsocketOpcode represents a RFC 6455 websocket frame opcode.
+type WebsocketOpcode byte
+
+// Websocket frame opcodes defined by RFC 6455.
+const (
+	OpContinuation WebsocketOpcode = 0x0
+	OpText         WebsocketOpcode = 0x1
+	OpBinary       WebsocketOpcode = 0x2
+	OpClose        WebsocketOpcode = 0x8
+	OpPing         WebsocketOpcode = 0x9
+	OpPong         WebsocketOpcode = 0xA
+)
+
+// IsControl reports whether the opcode represents a control frame.
+func (op WebsocketOpcode) IsControl() bool {
+	return op&0x8 != 0
+}
+
+// Websocket close status codes used by the forwarder.
+const (
+	CloseNormal          = 1000
+	CloseProtocolError   = 1002
+	ClosePolicyViolation = 1008
+	CloseMessageTooBig   = 1009
+	CloseInternalError   = 1011
+)
+
+// maxControlPayload stores the maximum payload size of control frames.
+const maxControlPayload = 125
+
+// DefaultWebsocketMaxMessageSize stores the default maximum websocket message
+// size in bytes accepted by the forwarder in frame-aware mode.
+var DefaultWebsocketMaxMessageSize int64 = 1 << 20
+
+var (
+	// ErrWebsocketProtocol is used when a peer violates the websocket protocol.
+	ErrWebsocketProtocol = errors.New("forward: websocket protocol error")
+	// ErrWebsocketMessageTooBig is used when a websocket message exceeds the maximum size.
+	ErrWebsocketMessageTooBig = errors.New("forward: websocket message too big")
+	// ErrWebsocketIntercepted is used when a websocket connection is closed by the interceptor.
+	ErrWebsocketIntercepted = errors.New("forward: websocket connection closed by interceptor")
+)
+
+// WebsocketDirection represents the direction of a websocket message.
+type WebsocketDirection int
+
+const (
+	// FromClient identifies messages sent by the client to the upstream server.
+	FromClient WebsocketDirection = iota
+	// FromServer identifies messages sent by the upstream server to the client.
+	FromServer
+)
+
+// String returns the direction human friendly name.
+func (d WebsocketDirection) String() string {
+	if d == FromClient {
+		return "client"
+	}
+	return "server"
+}
+
+// WebsocketAction represents the action to perform with an intercepted message.
+type WebsocketAction int
+
+const (
+	// ActionForward forwards the message, including any modification, to the peer.
+	ActionForward WebsocketAction = iota
+	// ActionDrop discards the message.
+	ActionDrop
+	// ActionClose discards the message and closes the connection
+	// in both directions with a policy violation status.
+	ActionClose
+)
+
+// WebsocketMessage represents a websocket message intercepted by the forwarder.
+// Fragmented messages are reassembled and forwarded as a single frame.
+// Control messages, such as ping or close, are intercepted as well.
+type WebsocketMessage struct {
+	// Direction defines who sent the message.
+	Direction WebsocketDirection
+	// Opcode defines the message type.
+	Opcode WebsocketOpcode
+	// Payload stores the unmasked message data.
+	// Interceptors can replace it in order to modify the message.
+	Payload []byte
+	// Request stores the upgrade request sent to the upstream server.
+	Request *http.Request
+}
+
+// WebsocketInterceptor can inspect, modify, drop or close the connection
+// for every message exchanged between the client and the upstream server.
+// Interceptors are called concurrently for each direction.
+type WebsocketInterceptor interface {
+	Intercept(msg *WebsocketMessage) WebsocketAction
+}
+
+// WebsocketInterceptorFunc represents the function interface for websocket interceptors.
+type WebsocketInterceptorFunc func(msg *WebsocketMessage) WebsocketAction
+
+// Intercept calls f(msg).
+func (f WebsocketInterceptorFunc) Intercept(msg *WebsocketMessage) WebsocketAction {
+	return f(msg)
+}
+
+// wsFrame represents a single websocket frame.
+type wsFrame struct {
+	fin     bool
+	opcode  WebsocketOpcode
+	payload []byte
+}
+
+// readFrame reads and unmasks a websocket frame from the given reader.
+// Frames with a payload bigger than max are rejected.
+func readFrame(r io.Reader, max int64) (*wsFrame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	// Reserved bits are only valid if an extension was negotiated
+	if header[0]&0x70 != 0 {
+		return nil, ErrWebsocketProtocol
+	}
+
+	frame := &wsFrame{
+		fin:    header[0]&0x80 != 0,
+		opcode: WebsocketOpcode(header[0] & 0x0F),
+	}
+	masked := header[1]&0x80 != 0
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if ext[0]&0x80 != 0 {
+			return nil, ErrWebsocketProtocol
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if frame.opcode.IsControl() && (length > maxControlPayload || !frame.fin) {
+		return nil, ErrWebsocketProtocol
+	}
+	if length > max {
+		return nil, ErrWebsocketMessageTooBig
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, key[:]); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	}
+
+	frame.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, frame.payload); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	if masked {
+		maskBytes(key, frame.payload)
+	}
+	return frame, nil
+}
+
+// writeFrame writes a final websocket frame with the given opcode and payload,
+// masking it with a random key if mask is true.
+func writeFrame(w io.Writer, opcode WebsocketOpcode, payload []byte, mask bool) error {
+	buf := make([]byte, 0, 14+len(payload))
+	buf = append(buf, 0x80|byte(opcode))
+
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		buf = append(buf, maskBit|byte(length))
+	case length <= 0xFFFF:
+		buf = append(buf, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(buf[len(buf)-2:], uint16(length))
+	default:
+		buf = append(buf, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(length))
+	}
+
+	if !mask {
+		buf = append(buf, payload...)
+		_, err := w.Write(buf)
+		return err
+	}
+
+	var key [4]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return err
+	}
+	buf = append(buf, key[:]...)
+	start := len(buf)
+	buf = append(buf, payload...)
+	maskBytes(key, buf[start:])
+	_, err := w.Write(buf)
+	return err
+}
+
+// maskBytes applies the websocket masking algorithm to the given data.
+func maskBytes(key [4]byte, data []byte) {
+	for i := range data {
+		data[i] ^= key[i%4]
+	}
+}
+
+// closePayload returns the close frame payload for the given status code.
+func closePayload(code int) []byte {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return payload
+}
+
+// closeCode returns the close status code to reply with for the given error.
+func closeCode(err error) int {
+	switch err {
+	case ErrWebsocketMessageTooBig:
+		return CloseMessageTooBig
+	case ErrWebsocketProtocol:
+		return CloseProtocolError
+	case ErrWebsocketIntercepted:
+		return ClosePolicyViolation
+	}
+	return CloseInternalError
+}
+
+// unexpectedEOF converts io.EOF into io.ErrUnexpectedEOF,
+// since the frame was only partially read.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// messageReader reads complete websocket messages, reassembling fragmented frames.
+type messageReader struct {
+	r   io.Reader
+	max int64
+	// opcode and payload store the fragmented message being read, if any.
+	opcode  WebsocketOpcode
+	payload []byte
+}
+
+// next reads the next websocket message.
+// Control frames interleaved with fragmented messages are returned immediately.
+func (m *messageReader) next() (WebsocketOpcode, []byte, error) {
+	for {
+		frame, err := readFrame(m.r, m.max-int64(len(m.payload)))
+		if err != nil {
+			if err == io.EOF && m.payload != nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, err
+		}
+
+		if frame.opcode.IsControl() {
+			return frame.opcode, frame.payload, nil
+		}
+
+		switch {
+		case frame.opcode == OpContinuation && m.payload == nil:
+			return 0, nil, ErrWebsocketProtocol
+		case frame.opcode != OpContinuation && m.payload != nil:
+			return 0, nil, ErrWebsocketProtocol
+		case frame.opcode != OpContinuation:
+			m.opcode = frame.opcode
+			m.payload = []byte{}
+		}
+
+		m.payload = append(m.payload, frame.payload...)
+		if frame.fin {
+			payload := m.payload
+			m.payload = nil
+			return m.opcode, payload, nil
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package forward
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestWebsocketFrameRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		[]byte("hello"),
+		bytes.Repeat([]byte("a"), 300),
+		bytes.Repeat([]byte("b"), 70000),
+	}
+
+	for _, payload := range payloads {
+		for _, mask := range []bool{false, true} {
+			buf := &bytes.Buffer{}
+			st.Expect(t, writeFrame(buf, OpBinary, payload, mask), nil)
+
+			frame, err := readFrame(buf, int64(len(payload)))
+			st.Expect(t, err, nil)
+			st.Expect(t, frame.fin, true)
+			st.Expect(t, frame.opcode, OpBinary)
+			st.Expect(t, frame.payload, payload)
+		}
+	}
+}
+
+func TestWebsocketFrameTooBig(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writeFrame(buf, OpText, []byte("hello"), true)
+	_, err := readFrame(buf, 4)
+	st.Expect(t, err, ErrWebsocketMessageTooBig)
+}
+
+func TestWebsocketFrameInvalid(t *testing.T) {
+	// Reserved bits set
+	_, err := readFrame(strings.NewReader("\xc1\x00"), 10)
+	st.Expect(t, err, ErrWebsocketProtocol)
+
+	// Fragmented control frame
+	_, err = readFrame(strings.NewReader("\x09\x00"), 10)
+	st.Expect(t, err, ErrWebsocketProtocol)
+
+	// Truncated payload
+	_, err = readFrame(strings.NewReader("\x81\x05hel"), 10)
+	st.Expect(t, err, io.ErrUnexpectedEOF)
+}
+
+func TestWebsocketMessageReader(t *testing.T) {
+	// Fragmented text message with an interleaved ping
+	data := "\x01\x03hel" + "\x89\x01p" + "\x80\x02lo" + "\x82\x01!"
+	reader := &messageReader{r: strings.NewReader(data), max: 10}
+
+	opcode, payload, err := reader.next()
+	st.Expect(t, err, nil)
+	st.Expect(t, opcode, OpPing)
+	st.Expect(t, string(payload), "p")
+
+	opcode, payload, err = reader.next()
+	st.Expect(t, err, nil)
+	st.Expect(t, opcode, OpText)
+	st.Expect(t, string(payload), "hello")
+
+	opcode, payload, err = reader.next()
+	st.Expect(t, err, nil)
+	st.Expect(t, opcode, OpBinary)
+	st.Expect(t, string(payload), "!")
+
+	_, _, err = reader.next()
+	st.Expect(t, err, io.EOF)
+}
+
+func TestWebsocketMessageReaderLimit(t *testing.T) {
+	data := "\x01\x03hel" + "\x80\x02lo"
+	reader := &messageReader{r: strings.NewReader(data), max: 4}
+	_, _, err := reader.next()
+	st.Expect(t, err, ErrWebsocketMessageTooBig)
+
+	reader = &messageReader{r: strings.NewReader("\x80\x02lo"), max: 4}
+	_, _, err = reader.next()
+	st.Expect(t, err, ErrWebsocketProtocol)
+}
@@ -3,10 +3,12 @@
 package layer
 
 import (
+	"io"
 	"net/http"
 	"sync"
 
 	"gopkg.in/vinxi/vinxi.v0/context"
+	"gopkg.in/vinxi/vinxi.v0/utils"
 )
 
 const (
@@ -18,22 +20,16 @@ const (
 
 // FinalHandler stores the default http.Handler used as final middleware chain.
 // You can customize this handler in order to reply with a default error response.
+// The error response is rendered using the request error renderer.
 var FinalHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(502)
-	w.Write([]byte("Bad Gateway"))
+	utils.RenderError(w, r, http.StatusBadGateway, nil)
 })
 
 // FinalErrorHandler stores the default http.Handler used as final middleware chain.
 // You can customize this handler in order to reply with a default error response.
+// The panic details are not exposed to the client.
 var FinalErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-	msg := "unknown panic"
-	err := context.GetError(r, "vinxi.error")
-	if err != nil {
-		msg = err.Error()
-	}
-
-	w.WriteHeader(500)
-	w.Write([]byte("Proxy error: " + msg))
+	utils.RenderError(w, r, http.StatusInternalServerError, context.GetError(r, "vinxi.error"))
 })
 
 // Runnable represents the required interface for a runnable
@@ -75,6 +71,8 @@ type Layer struct {
 	sync.RWMutex
 	// finalHandler stores the final middleware chain handler.
 	finalHandler http.Handler
+	// closer stores the owned final handler to close once it's replaced.
+	closer io.Closer
 	// parent stores the parent middleware layer to use. Use SetParent(parent).
 	parent Middleware
 	// Pool stores the phase-specific middleware handlers stack.
@@ -107,7 +105,25 @@ func (s *Layer) UsePriority(phase string, priority Priority, handler ...interfac
 // This handler is tipically responsible of replying with a custom response
 // or error (e.g: cannot route the request).
 func (s *Layer) UseFinalHandler(fn http.Handler) {
+	s.useFinalHandler(fn, nil)
+}
+
+// UseOwnedFinalHandler defines an http.Handler created by the layer owner,
+// such as balancers, as final middleware call chain handler.
+// The handler is closed once it's replaced if it implements io.Closer.
+func (s *Layer) UseOwnedFinalHandler(fn http.Handler) {
+	closer, _ := fn.(io.Closer)
+	s.useFinalHandler(fn, closer)
+}
+
+// useFinalHandler replaces the final handler, closing the previous owned one.
+func (s *Layer) useFinalHandler(fn http.Handler, closer io.Closer) {
+	prev := s.closer
 	s.finalHandler = fn
+	s.closer = closer
+	if prev != nil && interface{}(prev) != interface{}(fn) {
+		prev.Close()
+	}
 }
 
 // SetParent sets a new middleware layer as parent layer,
@@ -2,6 +2,7 @@ package layer
 
 import (
 	"net/http"
+	"strings"
 	"sync"
 	"testing"
 
@@ -50,7 +51,7 @@ func TestNoHandlerRegistered(t *testing.T) {
 	mw.Run("request", w, req, nil)
 
 	st.Expect(t, w.Code, 502)
-	st.Expect(t, string(w.Body), "Bad Gateway")
+	st.Expect(t, strings.SplitN(string(w.Body), "\n", 2)[0], "Bad Gateway")
 }
 
 func TestFinalErrorHandling(t *testing.T) {
@@ -69,7 +70,7 @@ func TestFinalErrorHandling(t *testing.T) {
 	mw.Run("request", w, req, nil)
 
 	st.Expect(t, w.Code, 500)
-	st.Expect(t, string(w.Body), "Proxy error: unknown panic")
+	st.Expect(t, strings.SplitN(string(w.Body), "\n", 2)[0], "Internal Server Error")
 }
 
 func TestUseFinalHandler(t *testing.T) {
@@ -88,6 +89,34 @@ func TestUseFinalHandler(t *testing.T) {
 	st.Expect(t, string(w.Body), "vinxi: service unavailable")
 }
 
+type closerHandler struct {
+	closed bool
+}
+
+func (h *closerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {}
+
+func (h *closerHandler) Close() error {
+	h.closed = true
+	return nil
+}
+
+func TestUseFinalHandlerClose(t *testing.T) {
+	mw := New()
+	handler := &closerHandler{}
+
+	mw.UseOwnedFinalHandler(handler)
+	mw.UseOwnedFinalHandler(handler)
+	st.Expect(t, handler.closed, false)
+
+	mw.UseFinalHandler(http.NotFoundHandler())
+	st.Expect(t, handler.closed, true)
+
+	shared := &closerHandler{}
+	mw.UseFinalHandler(shared)
+	mw.UseFinalHandler(http.NotFoundHandler())
+	st.Expect(t, shared.closed, false)
+}
+
 func TestRegisterPlugin(t *testing.T) {
 	mw := New()
 
@@ -356,7 +385,7 @@ func TestParentLayerPanicFinalHandler(t *testing.T) {
 	st.Expect(t, w.Code, 500)
 	st.Expect(t, w.Header().Get("foo"), "foo")
 	st.Expect(t, w.Header().Get("error"), "foo")
-	st.Expect(t, string(w.Body), "Proxy error: unknown panic")
+	st.Expect(t, strings.SplitN(string(w.Body), "\n", 2)[0], "Internal Server Error")
 }
 
 func TestParentLayerChildPanicHandler(t *testing.T) {
@@ -400,7 +429,7 @@ func TestParentLayerChildPanicHandler(t *testing.T) {
 	st.Expect(t, w.Code, 500)
 	st.Expect(t, w.Header().Get("foo"), "foo")
 	st.Expect(t, w.Header().Get("error"), "parent")
-	st.Expect(t, string(w.Body), "Proxy error: unknown panic")
+	st.Expect(t, strings.SplitN(string(w.Body), "\n", 2)[0], "Internal Server Error")
 }
 
 func BenchmarkLayerRun(b *testing.B) {
@@ -6,6 +6,8 @@ var rules scopesController
 var scopes scopesController
 var plugins pluginsController
 var instances instancesController
+var balancers balancersController
+var splits splitsController
 
 // routes stores the registered routes.
 var routes = []*Route{}
@@ -56,6 +58,15 @@ func init() {
 	route("POST", "/scopes/:scope/rules/:rule", rules.Create)
 	route("DELETE", "/scopes/:scope/rules/:rule", rules.Delete)
 
+	// Balancers routes
+	route("GET", "/balancers", balancers.List)
+	route("GET", "/balancers/:balancer", balancers.Get)
+
+	// Traffic splits routes
+	route("GET", "/splits", splits.List)
+	route("GET", "/splits/:split", splits.Get)
+	route("PUT", "/splits/:split", splits.Update)
+
 	// Instances routes
 	route("GET", "/instances", instances.List)
 	route("GET", "/instances/:instance", instances.Get)
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"net/http"
 
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/canary"
 	"gopkg.in/vinxi/vinxi.v0/plugin"
 	"gopkg.in/vinxi/vinxi.v0/rule"
 )
@@ -20,6 +22,8 @@ type Context struct {
 	Response     http.ResponseWriter
 	Rule         rule.Rule
 	Plugin       plugin.Plugin
+	Balancer     *balancer.Balancer
+	Split        *canary.Splitter
 }
 
 // ParseBody parses the body.
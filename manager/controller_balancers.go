@@ -0,0 +1,55 @@
+package manager
+
+import "gopkg.in/vinxi/vinxi.v0/balancer"
+
+// JSONUpstream represents the balancer upstream entity for JSON serialization.
+type JSONUpstream struct {
+	URL          string `json:"url"`
+	Weight       int    `json:"weight"`
+	Healthy      bool   `json:"healthy"`
+	HealthError  string `json:"healthError,omitempty"`
+	Circuit      string `json:"circuit"`
+	CircuitError string `json:"circuitError,omitempty"`
+	Active       int64  `json:"active"`
+}
+
+// JSONBalancer represents the balancer entity for JSON serialization.
+type JSONBalancer struct {
+	ID        string         `json:"id"`
+	Upstreams []JSONUpstream `json:"upstreams"`
+}
+
+func createBalancer(b *balancer.Balancer) JSONBalancer {
+	upstreams := []JSONUpstream{}
+	for _, u := range b.Upstreams() {
+		upstream := JSONUpstream{URL: u.URL, Weight: u.Weight, Healthy: u.Healthy(), Active: u.Active()}
+		if err := u.HealthError(); err != nil {
+			upstream.HealthError = err.Error()
+		}
+		upstream.Circuit = u.Circuit().String()
+		if err := u.CircuitError(); err != nil {
+			upstream.CircuitError = err.Error()
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return JSONBalancer{ID: b.ID(), Upstreams: upstreams}
+}
+
+func createBalancers(balancers []*balancer.Balancer) []JSONBalancer {
+	list := []JSONBalancer{}
+	for _, b := range balancers {
+		list = append(list, createBalancer(b))
+	}
+	return list
+}
+
+// balancersController represents the balancers entity HTTP controller.
+type balancersController struct{}
+
+func (balancersController) List(ctx *Context) {
+	ctx.SendOk(createBalancers(balancer.All()))
+}
+
+func (balancersController) Get(ctx *Context) {
+	ctx.SendOk(createBalancer(ctx.Balancer))
+}
@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+)
+
+func TestBalancersController(t *testing.T) {
+	b, err := balancer.New([]balancer.Upstream{{URL: "http://10.0.0.1", Weight: 2}})
+	st.Expect(t, err, nil)
+	defer b.Close()
+
+	w := httptest.NewRecorder()
+	ctx := &Context{Request: httptest.NewRequest("GET", "/balancers/"+b.ID(), nil), Response: w, Balancer: b}
+	balancers.Get(ctx)
+	st.Expect(t, w.Code, 200)
+
+	data := JSONBalancer{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &data), nil)
+	st.Expect(t, data.ID, b.ID())
+	st.Expect(t, data.Upstreams, []JSONUpstream{{URL: "http://10.0.0.1", Weight: 2, Healthy: true, Circuit: "closed"}})
+
+	w = httptest.NewRecorder()
+	balancers.List(&Context{Request: httptest.NewRequest("GET", "/balancers", nil), Response: w})
+	list := []JSONBalancer{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &list), nil)
+	st.Expect(t, len(list) > 0, true)
+}
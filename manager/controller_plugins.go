@@ -36,24 +36,16 @@ func createPlugin(p plugin.Plugin) JSONPlugin {
 // pluginsController represents the plugins entity HTTP controller.
 type pluginsController struct{}
 
-func (pluginsController) List(ctx *Context) {
-	var layer *plugin.Layer
-	if ctx.AdminPlugins != nil {
-		layer = ctx.AdminPlugins
-	} else if ctx.Scope != nil {
-		layer = ctx.Scope.Plugins
-	} else {
-		layer = ctx.Manager.Plugins
-	}
-	ctx.SendOk(createPlugins(layer.All()))
+func (p pluginsController) List(ctx *Context) {
+	ctx.SendOk(createPlugins(p.layer(ctx).All()))
 }
 
 func (pluginsController) Get(ctx *Context) {
 	ctx.SendOk(createPlugin(ctx.Plugin))
 }
 
-func (pluginsController) Delete(ctx *Context) {
-	if ctx.Manager.RemovePlugin(ctx.Plugin.ID()) {
+func (p pluginsController) Delete(ctx *Context) {
+	if p.layer(ctx).Remove(ctx.Plugin.ID()) {
 		ctx.SendNoContent()
 	} else {
 		ctx.SendError(500, "Cannot remove plugin")
@@ -100,3 +92,14 @@ func (pluginsController) registerPlugin(ctx *Context, instance plugin.Plugin) {
 		ctx.Manager.UsePlugin(instance)
 	}
 }
+
+// layer returns the plugins layer of the requested entity.
+func (pluginsController) layer(ctx *Context) *plugin.Layer {
+	if ctx.AdminPlugins != nil {
+		return ctx.AdminPlugins
+	}
+	if ctx.Scope != nil {
+		return ctx.Scope.Plugins
+	}
+	return ctx.Manager.Plugins
+}
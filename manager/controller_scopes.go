@@ -43,7 +43,13 @@ func (scopesController) Get(ctx *Context) {
 }
 
 func (scopesController) Delete(ctx *Context) {
-	if ctx.Manager.RemoveScope(ctx.Scope.ID) {
+	var removed bool
+	if ctx.Instance != nil {
+		removed = ctx.Instance.RemoveScope(ctx.Scope.ID)
+	} else {
+		removed = ctx.Manager.RemoveScope(ctx.Scope.ID)
+	}
+	if removed {
 		ctx.SendNoContent()
 	} else {
 		ctx.SendError(500, "Cannot remove scope")
@@ -1 +1,29 @@
 package manager
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+	_ "gopkg.in/vinxi/vinxi.v0/plugins/balancer"
+)
+
+func TestScopesControllerDelete(t *testing.T) {
+	registered := len(balancer.All())
+	p, err := plugin.Init("balancer", config.Config{"upstreams": "http://localhost"})
+	st.Expect(t, err, nil)
+	st.Expect(t, len(balancer.All()), registered+1)
+
+	m := New()
+	scope := m.NewScope("foo", "")
+	scope.UsePlugin(p)
+
+	w := httptest.NewRecorder()
+	scopes.Delete(&Context{Request: httptest.NewRequest("DELETE", "/scopes/"+scope.ID, nil), Response: w, Manager: m, Scope: scope})
+	st.Expect(t, w.Code, 204)
+	st.Expect(t, len(m.Scopes()), 0)
+	st.Expect(t, len(balancer.All()), registered)
+}
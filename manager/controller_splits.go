@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"net/http"
+
+	"gopkg.in/vinxi/vinxi.v0/canary"
+)
+
+// JSONVariant represents the traffic split variant entity for JSON serialization.
+type JSONVariant struct {
+	Name     string `json:"name"`
+	URL      string `json:"url,omitempty"`
+	Weight   int    `json:"weight"`
+	Requests uint64 `json:"requests"`
+}
+
+// JSONSplit represents the traffic split entity for JSON serialization.
+type JSONSplit struct {
+	ID       string        `json:"id"`
+	Variants []JSONVariant `json:"variants"`
+}
+
+func createSplit(s *canary.Splitter) JSONSplit {
+	variants := []JSONVariant{}
+	for _, v := range s.Variants() {
+		variants = append(variants, JSONVariant{Name: v.Name, URL: v.URL, Weight: v.Weight, Requests: v.Requests()})
+	}
+	return JSONSplit{ID: s.ID(), Variants: variants}
+}
+
+func createSplits(splitters []*canary.Splitter) []JSONSplit {
+	list := []JSONSplit{}
+	for _, s := range splitters {
+		list = append(list, createSplit(s))
+	}
+	return list
+}
+
+// splitsController represents the traffic splits entity HTTP controller.
+type splitsController struct{}
+
+func (splitsController) List(ctx *Context) {
+	ctx.SendOk(createSplits(canary.All()))
+}
+
+func (splitsController) Get(ctx *Context) {
+	ctx.SendOk(createSplit(ctx.Split))
+}
+
+func (splitsController) Update(ctx *Context) {
+	type data struct {
+		Weights map[string]int `json:"weights"`
+	}
+
+	var body data
+	if err := ctx.ParseBody(&body); err != nil {
+		return
+	}
+	if len(body.Weights) == 0 {
+		ctx.SendError(http.StatusBadRequest, "Missing required param: weights")
+		return
+	}
+
+	if err := ctx.Split.SetWeights(body.Weights); err != nil {
+		ctx.SendError(http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx.SendOk(createSplit(ctx.Split))
+}
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/canary"
+)
+
+func TestSplitsController(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {})
+	s, err := canary.New([]canary.Variant{
+		{Name: "stable", Weight: 100, Handler: handler},
+		{Name: "canary", Weight: 0, Handler: handler},
+	})
+	st.Expect(t, err, nil)
+	defer s.Close()
+
+	req := httptest.NewRequest("PUT", "/splits/"+s.ID(), strings.NewReader(`{"weights": {"stable": 90, "canary": 10}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	splits.Update(&Context{Request: req, Response: w, Split: s})
+	st.Expect(t, w.Code, 200)
+
+	data := JSONSplit{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &data), nil)
+	st.Expect(t, data.ID, s.ID())
+	st.Expect(t, data.Variants, []JSONVariant{{Name: "stable", Weight: 90}, {Name: "canary", Weight: 10}})
+
+	req = httptest.NewRequest("PUT", "/splits/"+s.ID(), strings.NewReader(`{"weights": {"stable": 90}}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	splits.Update(&Context{Request: req, Response: w, Split: s})
+	st.Expect(t, w.Code, 400)
+	st.Expect(t, s.Variants()[0].Weight, 90)
+
+	w = httptest.NewRecorder()
+	splits.List(&Context{Request: httptest.NewRequest("GET", "/splits", nil), Response: w})
+	list := []JSONSplit{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &list), nil)
+	st.Expect(t, len(list) > 0, true)
+}
@@ -77,7 +77,7 @@ func (i *Instance) GetScope(name string) *Scope {
 	return nil
 }
 
-// RemoveScope removes a registered scope.
+// RemoveScope removes a registered scope and flushes its plugins.
 // Returns false if the scope cannot be found.
 func (i *Instance) RemoveScope(name string) bool {
 	i.sm.Lock()
@@ -86,6 +86,7 @@ func (i *Instance) RemoveScope(name string) bool {
 	for x, scope := range i.scopes {
 		if scope.ID == name || scope.Name == name {
 			i.scopes = append(i.scopes[:x], i.scopes[x+1:]...)
+			scope.FlushPlugins()
 			return true
 		}
 	}
@@ -1 +1,26 @@
 package manager
+
+import (
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+	_ "gopkg.in/vinxi/vinxi.v0/plugins/balancer"
+)
+
+func TestInstanceRemoveScope(t *testing.T) {
+	registered := len(balancer.All())
+	p, err := plugin.Init("balancer", config.Config{"upstreams": "http://localhost"})
+	st.Expect(t, err, nil)
+
+	instance := NewInstance("foo", "", vinxi.New())
+	scope := NewScope("bar", "")
+	scope.UsePlugin(p)
+	instance.UseScope(scope)
+
+	st.Expect(t, instance.RemoveScope(scope.ID), true)
+	st.Expect(t, len(balancer.All()), registered)
+}
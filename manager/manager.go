@@ -173,7 +173,7 @@ func (m *Manager) Scopes() []*Scope {
 	return m.scopes
 }
 
-// RemoveScope removes a registered scope.
+// RemoveScope removes a registered scope and flushes its plugins.
 // Returns false if the scope cannot be found.
 func (m *Manager) RemoveScope(name string) bool {
 	m.sm.Lock()
@@ -182,6 +182,7 @@ func (m *Manager) RemoveScope(name string) bool {
 	for i, scope := range m.scopes {
 		if scope.ID == name || scope.Name == name {
 			m.scopes = append(m.scopes[:i], m.scopes[i+1:]...)
+			scope.FlushPlugins()
 			return true
 		}
 	}
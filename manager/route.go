@@ -3,6 +3,9 @@ package manager
 import (
 	"net/http"
 	"regexp"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/canary"
 )
 
 // RouteHandler represents HTTP router handler function
@@ -79,6 +82,24 @@ func (c *Route) handle(ctx *Context) {
 		}
 	}
 
+	balancerID := ctx.Request.URL.Query().Get(":balancer")
+	if balancerID != "" {
+		ctx.Balancer = balancer.Get(balancerID)
+		if ctx.Balancer == nil {
+			ctx.SendNotFound("Balancer not found")
+			return
+		}
+	}
+
+	splitID := ctx.Request.URL.Query().Get(":split")
+	if splitID != "" {
+		ctx.Split = canary.Get(splitID)
+		if ctx.Split == nil {
+			ctx.SendNotFound("Split not found")
+			return
+		}
+	}
+
 	// Finally run the router if all path validations are ok
 	c.Handler(ctx)
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/dchest/uniuri"
 	"gopkg.in/vinxi/vinxi.v0/plugin"
 	"gopkg.in/vinxi/vinxi.v0/rule"
+	"gopkg.in/vinxi/vinxi.v0/utils"
 )
 
 // Scope represents the HTTP configuration scope who can
@@ -22,6 +23,9 @@ type Scope struct {
 	// Description is used to store the scope human
 	// friendly description.
 	Description string
+	// ErrorRenderer optionally stores the renderer used to reply
+	// with error responses to the requests matching the scope.
+	ErrorRenderer utils.ErrorRenderer `json:"-"`
 }
 
 // NewScope creates a new Scope instance
@@ -75,6 +79,9 @@ func (s *Scope) HandleHTTP(h http.Handler) http.Handler {
 			h.ServeHTTP(w, r)
 			return
 		}
+		if s.ErrorRenderer != nil {
+			r = utils.WithErrorRenderer(r, s.ErrorRenderer)
+		}
 		s.Plugins.HandleHTTP(w, r, h)
 	})
 }
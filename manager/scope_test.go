@@ -1 +1,27 @@
 package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+func TestScopeErrorRenderer(t *testing.T) {
+	scope := NewScope("default", "")
+	scope.ErrorRenderer = utils.ErrorRendererFunc(func(w http.ResponseWriter, req *http.Request, status int, err error) {
+		w.WriteHeader(status)
+		w.Write([]byte("scope error"))
+	})
+
+	final := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		utils.RenderError(w, req, http.StatusBadGateway, nil)
+	})
+
+	w := httptest.NewRecorder()
+	scope.HandleHTTP(final).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusBadGateway)
+	st.Expect(t, w.Body.String(), "scope error")
+}
@@ -0,0 +1,313 @@
+// Package mirror implements a traffic mirroring middleware who sends a copy
+// of the incoming requests to a secondary upstream server, such as a new
+// version of a service, while the client only receives the primary response.
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	vcontext "gopkg.in/vinxi/vinxi.v0/context"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+var (
+	// DefaultMaxBodySize stores the default maximum request body size
+	// in bytes to buffer in order to mirror the request.
+	DefaultMaxBodySize int64 = 1 << 20
+
+	// DefaultTimeout stores the default maximum time to wait for a mirrored request.
+	DefaultTimeout = 5 * time.Second
+
+	// DefaultMaxConcurrency stores the default maximum number of in-flight mirrored requests.
+	DefaultMaxConcurrency = 100
+)
+
+// Stats stores the mirrored requests counters.
+type Stats struct {
+	// Succeeded stores the mirrored requests replied with a non 5xx status.
+	Succeeded uint64 `json:"succeeded"`
+	// Failed stores the mirrored requests who failed or were replied with a 5xx status.
+	Failed uint64 `json:"failed"`
+	// Skipped stores the sampled requests who could not be mirrored, such as
+	// due to the body size limit or too many in-flight mirrored requests.
+	Skipped uint64 `json:"skipped"`
+}
+
+// OptSetter represents the mirror setter function.
+type OptSetter func(m *Mirror) error
+
+// Percentage defines the percentage of requests to mirror, from 0 to 100.
+// Defaults to 100.
+func Percentage(percentage float64) OptSetter {
+	return func(m *Mirror) error {
+		if percentage < 0 || percentage > 100 {
+			return errors.New("mirror: percentage must be between 0 and 100")
+		}
+		m.percentage = percentage
+		return nil
+	}
+}
+
+// Timeout defines the maximum time to wait for every mirrored request.
+func Timeout(timeout time.Duration) OptSetter {
+	return func(m *Mirror) error {
+		if timeout <= 0 {
+			return errors.New("mirror: timeout must be positive")
+		}
+		m.timeout = timeout
+		return nil
+	}
+}
+
+// MaxBodySize defines the maximum request body size to buffer in order to
+// mirror the request. Requests with bigger bodies are not mirrored.
+func MaxBodySize(size int64) OptSetter {
+	return func(m *Mirror) error {
+		if size < 0 {
+			return errors.New("mirror: max body size cannot be negative")
+		}
+		m.maxBodySize = size
+		return nil
+	}
+}
+
+// MaxConcurrency defines the maximum number of in-flight mirrored requests.
+// Requests are not mirrored while the limit is reached.
+func MaxConcurrency(n int) OptSetter {
+	return func(m *Mirror) error {
+		if n < 1 {
+			return errors.New("mirror: max concurrency must be greater than zero")
+		}
+		m.concurrency = make(chan struct{}, n)
+		return nil
+	}
+}
+
+// Forward defines the forwarder options used with the mirror upstream server.
+func Forward(opts ...forward.OptSetter) OptSetter {
+	return func(m *Mirror) error {
+		m.forward = append(m.forward, opts...)
+		return nil
+	}
+}
+
+// Logger specifies the logger to use.
+func Logger(l utils.Logger) OptSetter {
+	return func(m *Mirror) error {
+		m.log = l
+		return nil
+	}
+}
+
+// Mirror sends a copy of the sampled requests to the mirror upstream server
+// asynchronously, discarding its response.
+type Mirror struct {
+	target      string
+	percentage  float64
+	timeout     time.Duration
+	maxBodySize int64
+	concurrency chan struct{}
+	forward     []forward.OptSetter
+	handler     http.Handler
+	log         utils.Logger
+	stats       Stats
+	pending     sync.WaitGroup
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// New creates a new traffic mirror who sends the requests to the given upstream URL.
+func New(target string, setters ...OptSetter) (*Mirror, error) {
+	m := &Mirror{
+		target:      target,
+		percentage:  100,
+		timeout:     DefaultTimeout,
+		maxBodySize: DefaultMaxBodySize,
+		rand:        rand.New(rand.NewSource(rand.Int63())),
+	}
+	for _, s := range setters {
+		if err := s(m); err != nil {
+			return nil, err
+		}
+	}
+	if m.concurrency == nil {
+		m.concurrency = make(chan struct{}, DefaultMaxConcurrency)
+	}
+	if m.log == nil {
+		m.log = utils.NullLogger
+	}
+
+	opts := append([]forward.OptSetter{forward.Target(target), forward.Logger(m.log)}, m.forward...)
+	fwd, err := forward.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.handler = fwd
+	return m, nil
+}
+
+// Stats returns the mirrored requests counters.
+func (m *Mirror) Stats() Stats {
+	return Stats{
+		Succeeded: atomic.LoadUint64(&m.stats.Succeeded),
+		Failed:    atomic.LoadUint64(&m.stats.Failed),
+		Skipped:   atomic.LoadUint64(&m.stats.Skipped),
+	}
+}
+
+// Wait waits until the in-flight mirrored requests complete.
+func (m *Mirror) Wait() {
+	m.pending.Wait()
+}
+
+// HandleHTTP mirrors the sampled requests and calls the next handler
+// who replies with the primary response.
+func (m *Mirror) HandleHTTP(w http.ResponseWriter, req *http.Request, h http.Handler) {
+	if m.sampled() {
+		m.mirror(req)
+	}
+	h.ServeHTTP(w, req)
+}
+
+// sampled decides if the current request should be mirrored.
+func (m *Mirror) sampled() bool {
+	if m.percentage >= 100 {
+		return true
+	}
+	m.randMu.Lock()
+	defer m.randMu.Unlock()
+	return m.rand.Float64()*100 < m.percentage
+}
+
+// mirror sends a copy of the given request to the mirror upstream in background.
+func (m *Mirror) mirror(req *http.Request) {
+	if utils.IsWebsocketRequest(req) {
+		m.skip(req, "websocket requests cannot be mirrored")
+		return
+	}
+
+	select {
+	case m.concurrency <- struct{}{}:
+	default:
+		m.skip(req, "too many in-flight mirrored requests")
+		return
+	}
+
+	body, ok, err := bufferBody(req, m.maxBodySize)
+	if err != nil || !ok {
+		<-m.concurrency
+		m.skip(req, "request body cannot be buffered")
+		return
+	}
+
+	// The mirrored request is not canceled when the primary request completes
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+	outReq := req.Clone(ctx)
+	if via, ok := forward.RequestViaPseudonym(req); ok {
+		outReq = forward.WithViaPseudonym(outReq, via)
+	}
+	outReq.Body = http.NoBody
+	if body != nil {
+		outReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		defer func() { <-m.concurrency }()
+		defer cancel()
+		m.send(outReq)
+	}()
+}
+
+// send sends the given request to the mirror upstream, recording the result.
+func (m *Mirror) send(req *http.Request) {
+	w := &discardWriter{header: make(http.Header)}
+	m.handler.ServeHTTP(w, req)
+
+	if w.status >= 500 {
+		atomic.AddUint64(&m.stats.Failed, 1)
+		m.log.Warningf("Mirrored request to %v failed, code: %v", m.target, w.status)
+		return
+	}
+	atomic.AddUint64(&m.stats.Succeeded, 1)
+}
+
+// skip records the given request as not mirrored.
+func (m *Mirror) skip(req *http.Request, reason string) {
+	atomic.AddUint64(&m.stats.Skipped, 1)
+	m.log.Infof("Skipping mirror of %v %v: %v", req.Method, req.URL, reason)
+}
+
+// bufferBody reads the request body up to the given max size, restoring it
+// for the primary request. If the body is bigger than the max size or
+// cannot be read, false is returned, meaning the request cannot be mirrored.
+func bufferBody(req *http.Request, max int64) ([]byte, bool, error) {
+	if req.Body == nil || req.ContentLength == 0 {
+		return nil, true, nil
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(req.Body, max+1))
+	if err != nil || int64(len(body)) > max {
+		restoreBody(req, readCloser{io.MultiReader(bytes.NewReader(body), req.Body), req.Body})
+		return nil, false, err
+	}
+
+	req.Body.Close()
+	restoreBody(req, ioutil.NopCloser(bytes.NewReader(body)))
+	return body, true, nil
+}
+
+// restoreBody replaces the request body,
+// keeping the vinxi context values stored in the previous one.
+func restoreBody(req *http.Request, body io.ReadCloser) {
+	var values map[interface{}]interface{}
+	if _, ok := req.Body.(vcontext.ReadCloser); ok {
+		values = vcontext.GetAll(req)
+	}
+	req.Body = body
+	for key, value := range values {
+		vcontext.Set(req, key, value)
+	}
+}
+
+// readCloser composes an io.Reader with a different io.Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// discardWriter implements a http.ResponseWriter who discards
+// the mirrored response, recording its status code.
+type discardWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *discardWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
@@ -0,0 +1,189 @@
+package mirror
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/context"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+)
+
+// primary replies with the received request body.
+var primary = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	w.Write(append([]byte("primary:"), body...))
+})
+
+// serve handles the given request through the mirror and the primary handler.
+func serve(m *Mirror, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	m.HandleHTTP(w, req, primary)
+	return w
+}
+
+func TestMirror(t *testing.T) {
+	var mutex sync.Mutex
+	var mirrored []string
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := ioutil.ReadAll(req.Body)
+		mutex.Lock()
+		mirrored = append(mirrored, req.Method+" "+req.URL.RequestURI()+" "+string(body))
+		mutex.Unlock()
+		w.Write([]byte("mirror"))
+	})
+	defer srv.Close()
+
+	m, err := New(srv.URL)
+	st.Expect(t, err, nil)
+
+	w := serve(m, httptest.NewRequest("POST", "/foo?bar=baz", strings.NewReader("hello")))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Body.String(), "primary:hello")
+
+	w = serve(m, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Body.String(), "primary:")
+
+	m.Wait()
+	st.Expect(t, len(mirrored), 2)
+	st.Expect(t, strings.Contains(strings.Join(mirrored, ","), "POST /foo?bar=baz hello"), true)
+	st.Expect(t, m.Stats(), Stats{Succeeded: 2})
+}
+
+func TestMirrorVia(t *testing.T) {
+	via := make(chan string, 1)
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		via <- req.Header.Get(forward.Via)
+	})
+	defer srv.Close()
+
+	m, err := New(srv.URL)
+	st.Expect(t, err, nil)
+	serve(m, forward.WithViaPseudonym(httptest.NewRequest("GET", "/", nil), "instance"))
+	m.Wait()
+	st.Expect(t, <-via, "1.1 instance")
+}
+
+func TestMirrorFailures(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	defer srv.Close()
+	closed := testutils.NewHandler(primary)
+	closed.Close()
+
+	m, err := New(srv.URL)
+	st.Expect(t, err, nil)
+	serve(m, httptest.NewRequest("GET", "/", nil))
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Failed: 1})
+
+	m, err = New(closed.URL)
+	st.Expect(t, err, nil)
+	w := serve(m, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 200)
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Failed: 1})
+}
+
+func TestMirrorDoesNotDelayPrimary(t *testing.T) {
+	release := make(chan struct{})
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	})
+	defer srv.Close()
+
+	m, err := New(srv.URL, Timeout(time.Second), MaxConcurrency(1))
+	st.Expect(t, err, nil)
+
+	start := time.Now()
+	w := serve(m, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Body.String(), "primary:")
+	st.Expect(t, time.Since(start) < 500*time.Millisecond, true)
+
+	// The in-flight limit is reached, so the request is not mirrored
+	serve(m, httptest.NewRequest("GET", "/", nil))
+	close(release)
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Succeeded: 1, Skipped: 1})
+}
+
+func TestMirrorTimeout(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	defer srv.Close()
+
+	m, err := New(srv.URL, Timeout(20*time.Millisecond))
+	st.Expect(t, err, nil)
+	serve(m, httptest.NewRequest("GET", "/", nil))
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Failed: 1})
+}
+
+func TestMirrorMaxBodySize(t *testing.T) {
+	srv := testutils.NewHandler(primary)
+	defer srv.Close()
+
+	m, err := New(srv.URL, MaxBodySize(4))
+	st.Expect(t, err, nil)
+	w := serve(m, httptest.NewRequest("POST", "/", strings.NewReader("hello world")))
+	st.Expect(t, w.Body.String(), "primary:hello world")
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Skipped: 1})
+}
+
+func TestMirrorContextBody(t *testing.T) {
+	srv := testutils.NewHandler(primary)
+	defer srv.Close()
+
+	m, err := New(srv.URL)
+	st.Expect(t, err, nil)
+
+	// Bodyless requests wrapped by the vinxi context are mirrored
+	req := httptest.NewRequest("GET", "/", nil)
+	context.Set(req, "foo", "bar")
+	serve(m, req)
+	st.Expect(t, context.GetString(req, "foo"), "bar")
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	context.Set(req, "foo", "bar")
+	w := serve(m, req)
+	st.Expect(t, w.Body.String(), "primary:hello")
+	st.Expect(t, context.GetString(req, "foo"), "bar")
+
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{Succeeded: 2})
+}
+
+func TestMirrorPercentage(t *testing.T) {
+	srv := testutils.NewHandler(primary)
+	defer srv.Close()
+
+	m, err := New(srv.URL, Percentage(0))
+	st.Expect(t, err, nil)
+	for i := 0; i < 10; i++ {
+		serve(m, httptest.NewRequest("GET", "/", nil))
+	}
+	m.Wait()
+	st.Expect(t, m.Stats(), Stats{})
+
+	m, err = New(srv.URL, Percentage(50))
+	st.Expect(t, err, nil)
+	sampled := 0
+	for i := 0; i < 1000; i++ {
+		if m.sampled() {
+			sampled++
+		}
+	}
+	st.Expect(t, sampled > 400 && sampled < 600, true)
+
+	_, err = New(srv.URL, Percentage(101))
+	st.Reject(t, err, nil)
+}
@@ -3,6 +3,9 @@ package mux
 import (
 	"net/http"
 	"regexp"
+	"strings"
+
+	"gopkg.in/vinxi/vinxi.v0/utils"
 )
 
 // Matcher represents the function interface implemented by matchers
@@ -58,3 +61,32 @@ func MatchHeader(key, pattern string) Matcher {
 		return rex.MatchString(req.Header.Get(key))
 	}
 }
+
+// MatchGRPC matches gRPC requests.
+func MatchGRPC() Matcher {
+	return func(req *http.Request) bool {
+		return utils.IsGRPCRequest(req)
+	}
+}
+
+// MatchGRPCService matches gRPC requests for the given fully qualified
+// service name, such as "helloworld.Greeter".
+func MatchGRPCService(service string) Matcher {
+	return MatchGRPCMethod(service, "")
+}
+
+// MatchGRPCMethod matches gRPC requests for the given fully qualified
+// service name and method. An empty method matches any service method.
+func MatchGRPCMethod(service, method string) Matcher {
+	return func(req *http.Request) bool {
+		if !utils.IsGRPCRequest(req) {
+			return false
+		}
+		// gRPC request paths are defined as: /{service}/{method}
+		parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/"), "/")
+		if len(parts) != 2 || parts[0] != service {
+			return false
+		}
+		return method == "" || parts[1] == method
+	}
+}
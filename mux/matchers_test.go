@@ -110,3 +110,30 @@ func TestMatchRequestHeader(t *testing.T) {
 		st.Expect(t, MatchHeader(test.key, test.value)(req), test.matches)
 	}
 }
+
+func TestMatchGRPCMethod(t *testing.T) {
+	cases := []struct {
+		service string
+		method  string
+		path    string
+		matches bool
+	}{
+		{"helloworld.Greeter", "SayHello", "/helloworld.Greeter/SayHello", true},
+		{"helloworld.Greeter", "", "/helloworld.Greeter/SayHello", true},
+		{"helloworld.Greeter", "SayBye", "/helloworld.Greeter/SayHello", false},
+		{"helloworld.Greeter", "", "/helloworld.Other/SayHello", false},
+		{"helloworld.Greeter", "", "/helloworld.Greeter/SayHello/foo", false},
+	}
+
+	for _, test := range cases {
+		req := newRequest()
+		req.URL.Path = test.path
+		req.Header.Set("Content-Type", "application/grpc")
+		st.Expect(t, MatchGRPCMethod(test.service, test.method)(req), test.matches)
+	}
+
+	req := newRequest()
+	req.URL.Path = "/helloworld.Greeter/SayHello"
+	st.Expect(t, MatchGRPCService("helloworld.Greeter")(req), false)
+	st.Expect(t, MatchGRPC()(req), false)
+}
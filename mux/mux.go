@@ -5,6 +5,7 @@ package mux
 import (
 	"net/http"
 
+	"gopkg.in/vinxi/vinxi.v0/canary"
 	"gopkg.in/vinxi/vinxi.v0/layer"
 )
 
@@ -76,6 +77,13 @@ func (m *Mux) UseFinalHandler(handler http.Handler) *Mux {
 	return m
 }
 
+// Split splits the matched traffic across the given variants based on their weights.
+// The splitter is registered as middleware, since the mux final handler
+// is not used when the mux runs as middleware of a parent layer.
+func (m *Mux) Split(variants []canary.Variant, opts ...canary.OptSetter) *Mux {
+	return m.Use(canary.Must(canary.New(variants, opts...)))
+}
+
 // HandleHTTP returns the function handler to match an incoming HTTP transacion
 // and trigger the equivalent middleware phase.
 func (m *Mux) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
@@ -35,3 +35,20 @@ func Query(key, pattern string) *Mux {
 func Header(key, pattern string) *Mux {
 	return Match(MatchHeader(key, pattern))
 }
+
+// GRPC returns a new multiplexer who matches gRPC requests.
+func GRPC() *Mux {
+	return Match(MatchGRPC())
+}
+
+// GRPCService returns a new multiplexer who matches gRPC requests
+// based on the given fully qualified service name.
+func GRPCService(service string) *Mux {
+	return Match(MatchGRPCService(service))
+}
+
+// GRPCMethod returns a new multiplexer who matches gRPC requests
+// based on the given fully qualified service name and method.
+func GRPCMethod(service, method string) *Mux {
+	return Match(MatchGRPCMethod(service, method))
+}
@@ -1,6 +1,7 @@
 package plugin
 
 import (
+	"io"
 	"net/http"
 	"sync"
 )
@@ -51,14 +52,19 @@ func (l *Layer) All() []Plugin {
 	return l.pool
 }
 
-// Flush removes all the registered plugins.
+// Flush removes all the registered plugins, closing them.
 func (l *Layer) Flush() {
 	l.rwm.Lock()
+	pool := l.pool
 	l.pool = []Plugin{}
 	l.rwm.Unlock()
+
+	for _, plugin := range pool {
+		closePlugin(plugin)
+	}
 }
 
-// Remove removes a plugin looking by its unique identifier.
+// Remove removes a plugin looking by its unique identifier, closing it.
 func (l *Layer) Remove(id string) bool {
 	l.rwm.Lock()
 	defer l.rwm.Unlock()
@@ -66,6 +72,7 @@ func (l *Layer) Remove(id string) bool {
 	for i, plugin := range l.pool {
 		if plugin.ID() == id {
 			l.pool = append(l.pool[:i], l.pool[i+1:]...)
+			closePlugin(plugin)
 			return true
 		}
 	}
@@ -73,6 +80,14 @@ func (l *Layer) Remove(id string) bool {
 	return false
 }
 
+// closePlugin releases the resources held by the given plugin,
+// if it implements io.Closer.
+func closePlugin(plugin Plugin) {
+	if closer, ok := plugin.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
 // HandleHTTP triggers the plugins layer call chain.
 // This function is designed to be executed by top-level middleware layers.
 func (l *Layer) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
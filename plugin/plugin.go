@@ -1,7 +1,9 @@
 package plugin
 
 import (
+	"io"
 	"net/http"
+	"sync"
 
 	"github.com/dchest/uniuri"
 	"gopkg.in/vinxi/vinxi.v0/config"
@@ -34,6 +36,8 @@ type plugin struct {
 	name        string
 	description string
 	handler     Handler
+	closer      io.Closer
+	closeOnce   sync.Once
 	config      config.Config
 	metadata    config.Config
 }
@@ -53,13 +57,22 @@ func NewWithConfig(info Info, opts config.Config) (Plugin, error) {
 		return nil, err
 	}
 
-	return &plugin{
+	p := &plugin{
 		id:          uniuri.New(),
 		name:        info.Name,
 		description: info.Description,
 		config:      opts,
-		handler:     info.Factory(opts),
-	}, nil
+	}
+	if info.ClosableFactory != nil {
+		handler, closer, err := info.ClosableFactory(opts)
+		if err != nil {
+			return nil, err
+		}
+		p.handler, p.closer = handler, closer
+	} else {
+		p.handler = info.Factory(opts)
+	}
+	return p, nil
 }
 
 // ID returns the plugin identifer.
@@ -84,12 +97,27 @@ func (p *plugin) Config() config.Config {
 	return p.config
 }
 
-// Config returns the plugin human readable description about
-// what the plugin does and for what it's designed.
+// Metadata returns the plugin metadata, provided by the
+// plugin closer if it implements MetadataProvider.
 func (p *plugin) Metadata() config.Config {
+	if provider, ok := p.closer.(MetadataProvider); ok {
+		return provider.Metadata()
+	}
 	return p.metadata
 }
 
+// Close releases the resources held by the plugin handler, if any.
+// Plugins are closed by the plugin layer once removed.
+func (p *plugin) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		if p.closer != nil {
+			err = p.closer.Close()
+		}
+	})
+	return err
+}
+
 // HandleHTTP implements the required plugin HTTP handler interface
 // triggered by the plugin layer during the incoming request call chain.
 func (p *plugin) HandleHTTP(h http.Handler) http.Handler {
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"errors"
+	"io"
 
 	"gopkg.in/vinxi/vinxi.v0/config"
 )
@@ -15,6 +16,18 @@ var Plugins = make(map[string]Info)
 // Factory represents the plugin factory function interface.
 type Factory func(config.Config) Handler
 
+// ClosableFactory represents the factory function interface of the plugins
+// who hold resources, such as background goroutines, returning the io.Closer
+// used to release them once the plugin is removed.
+// The io.Closer can be nil and errors are returned to the plugin constructor caller.
+type ClosableFactory func(config.Config) (Handler, io.Closer, error)
+
+// MetadataProvider is optionally implemented by the io.Closer returned by
+// ClosableFactory to expose live plugin metadata, such as counters.
+type MetadataProvider interface {
+	Metadata() config.Config
+}
+
 // NewFunc represents the Plugin constructor factory function interface.
 type NewFunc func(config.Config) (Plugin, error)
 
@@ -24,11 +37,13 @@ type Validator func(interface{}, config.Config) error
 // Info represents the plugin entity fields
 // storing the name, description and factory function
 // used to initialize the fields.
+// ClosableFactory is used instead of Factory, if defined.
 type Info struct {
-	Name        string  `json:"name,omitempty"`
-	Description string  `json:"description,omitempty"`
-	Params      Params  `json:"params,omitempty"`
-	Factory     Factory `json:"-"`
+	Name            string          `json:"name,omitempty"`
+	Description     string          `json:"description,omitempty"`
+	Params          Params          `json:"params,omitempty"`
+	Factory         Factory         `json:"-"`
+	ClosableFactory ClosableFactory `json:"-"`
 }
 
 // Params represents the list of supported config fields by plugins.
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"errors"
+	"math"
 
 	"gopkg.in/vinxi/vinxi.v0/config"
 )
@@ -40,13 +41,27 @@ func Validate(params Params, opts config.Config) error {
 
 		// Cast type to verify type contract
 		var kind string
-		switch value.(type) {
+		switch v := value.(type) {
 		case string:
 			kind = "string"
 		case int:
 			kind = "int"
+			// Integers are valid float params
+			if field.Type == "float" {
+				value = float64(v)
+				opts.Set(name, value)
+				kind = "float"
+			}
 		case bool:
 			kind = "bool"
+		case float64:
+			kind = "float"
+			// JSON numbers are decoded as float64, so cast integers accordingly
+			if field.Type == "int" && v == math.Trunc(v) {
+				value = int(v)
+				opts.Set(name, value)
+				kind = "int"
+			}
 		}
 
 		if kind != field.Type {
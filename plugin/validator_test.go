@@ -1 +1,48 @@
 package plugin
+
+import (
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/config"
+)
+
+func TestValidateTypes(t *testing.T) {
+	params := Params{
+		Field{Name: "name", Type: "string", Mandatory: true},
+		Field{Name: "retries", Type: "int", Default: 1},
+		Field{Name: "enabled", Type: "bool"},
+	}
+
+	opts := config.Config{"name": "foo", "enabled": true}
+	st.Expect(t, Validate(params, opts), nil)
+	st.Expect(t, opts.GetInt("retries"), 1)
+
+	st.Reject(t, Validate(params, config.Config{"retries": 1}), nil)
+	st.Reject(t, Validate(params, config.Config{"name": 1}), nil)
+	st.Reject(t, Validate(params, config.Config{"name": "foo", "enabled": "true"}), nil)
+}
+
+func TestValidateJSONNumbers(t *testing.T) {
+	params := Params{Field{Name: "retries", Type: "int"}}
+
+	opts := config.Config{"retries": float64(3)}
+	st.Expect(t, Validate(params, opts), nil)
+	st.Expect(t, opts.GetInt("retries"), 3)
+
+	st.Reject(t, Validate(params, config.Config{"retries": 1.5}), nil)
+}
+
+func TestValidateFloats(t *testing.T) {
+	params := Params{Field{Name: "ratio", Type: "float"}}
+
+	opts := config.Config{"ratio": 0.5}
+	st.Expect(t, Validate(params, opts), nil)
+	st.Expect(t, opts.GetFloat("ratio"), 0.5)
+
+	opts = config.Config{"ratio": 2}
+	st.Expect(t, Validate(params, opts), nil)
+	st.Expect(t, opts.GetFloat("ratio"), 2.0)
+
+	st.Reject(t, Validate(params, config.Config{"ratio": "0.5"}), nil)
+}
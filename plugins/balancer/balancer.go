@@ -0,0 +1,290 @@
+package balancer
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+const (
+	// Name defines the plugin semantic identifier.
+	Name = "balancer"
+	// Description defines the plugin friendly description.
+	Description = "Balance HTTP traffic across multiple upstream servers"
+)
+
+func upstreamsValidator(value interface{}, opts config.Config) error {
+	upstreams, err := balancer.ParseUpstreams(value.(string))
+	if err != nil {
+		return err
+	}
+	b, err := balancer.New(upstreams)
+	if err != nil {
+		return err
+	}
+	return b.Close()
+}
+
+func positiveValidator(value interface{}, opts config.Config) error {
+	if value.(int) < 0 {
+		return errors.New("balancer: numeric params cannot be negative")
+	}
+	return nil
+}
+
+func percentageValidator(value interface{}, opts config.Config) error {
+	if percentage := value.(int); percentage < 0 || percentage > 100 {
+		return errors.New("balancer: percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+func algorithmValidator(value interface{}, opts config.Config) error {
+	_, err := balancer.NewPicker(value.(string))
+	return err
+}
+
+func hashKeyValidator(value interface{}, opts config.Config) error {
+	_, err := balancer.ParseHashKey(value.(string))
+	return err
+}
+
+// params defines the rule specific configuration params.
+var params = append(plugin.Params{
+	plugin.Field{
+		Name:        "upstreams",
+		Type:        "string",
+		Description: "Comma separated list of upstream server URLs with optional weights",
+		Examples:    []string{"http://10.0.0.1:8080, http://10.0.0.2:8080", "http://10.0.0.1:8080 weight=3, http://10.0.0.2:8080"},
+		Mandatory:   true,
+		Validator:   upstreamsValidator,
+	},
+}, balancerParams...)
+
+// balancerParams defines the balancing configuration params shared by the balancer plugins.
+var balancerParams = plugin.Params{
+	plugin.Field{
+		Name:        "algorithm",
+		Type:        "string",
+		Description: "Balancing algorithm",
+		Examples:    []string{balancer.RoundRobin, balancer.WeightedRoundRobin, balancer.LeastConnections, balancer.RandomTwoChoices, balancer.IPHash, balancer.ConsistentHash},
+		Default:     balancer.WeightedRoundRobin,
+		Validator:   algorithmValidator,
+	},
+	plugin.Field{
+		Name:        "hashKey",
+		Type:        "string",
+		Description: "Request key used by the consistent hashing algorithm, defaults to the client IP",
+		Examples:    []string{"ip", "header:X-User-Id", "cookie:session", "query:user"},
+		Validator:   hashKeyValidator,
+	},
+	plugin.Field{
+		Name:        "stickyCookie",
+		Type:        "string",
+		Description: "Name of the cookie issued to stick clients to the same upstream",
+		Examples:    []string{balancer.DefaultAffinityCookie},
+	},
+	plugin.Field{
+		Name:        "stripPrefix",
+		Type:        "string",
+		Description: "Path prefix to remove from the request path before forwarding",
+		Examples:    []string{"/api"},
+	},
+	plugin.Field{
+		Name:        "healthCheck",
+		Type:        "bool",
+		Description: "Enable the active upstream health checks",
+	},
+	plugin.Field{
+		Name:        "healthPath",
+		Type:        "string",
+		Description: "HTTP path to probe, TCP connect checks are used if empty",
+		Examples:    []string{"/health"},
+	},
+	plugin.Field{
+		Name:        "healthStatus",
+		Type:        "int",
+		Description: "Expected health check response status code",
+		Examples:    []string{"200", "204"},
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "healthInterval",
+		Type:        "int",
+		Description: "Milliseconds between health checks",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "healthTimeout",
+		Type:        "int",
+		Description: "Maximum milliseconds to wait for every health check",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "healthRise",
+		Type:        "int",
+		Description: "Consecutive successful checks to consider an upstream healthy",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "healthFall",
+		Type:        "int",
+		Description: "Consecutive failed checks to consider an upstream unhealthy",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "circuitBreaker",
+		Type:        "bool",
+		Description: "Eject upstreams who fail consecutively using a circuit breaker",
+	},
+	plugin.Field{
+		Name:        "breakerFailures",
+		Type:        "int",
+		Description: "Consecutive 5xx responses or connection errors to open the upstream circuit",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "breakerTimeout",
+		Type:        "int",
+		Description: "Milliseconds the upstream circuit stays open before allowing trial requests",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "breakerHalfOpenRequests",
+		Type:        "int",
+		Description: "Successful trial requests required to close the upstream circuit",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "hedgeDelay",
+		Type:        "int",
+		Description: "Milliseconds to wait for an upstream response before sending GET and HEAD requests to another upstream, disabled if zero",
+		Examples:    []string{"50", "200"},
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "hedgeBudget",
+		Type:        "int",
+		Description: "Maximum percentage of requests who can be hedged",
+		Examples:    []string{"10", "100"},
+		Validator:   percentageValidator,
+	},
+}
+
+// Plugin exposes the rule metadata information.
+// Mostly used internally.
+var Plugin = plugin.Info{
+	Name:            Name,
+	Description:     Description,
+	ClosableFactory: factory,
+	Params:          params,
+}
+
+// factory represents the rule factory function
+// designed to be called via rules constructor.
+// The balancer is closed once the plugin is removed.
+func factory(opts config.Config) (plugin.Handler, io.Closer, error) {
+	upstreams, err := balancer.ParseUpstreams(opts.GetString("upstreams"))
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := balancer.New(upstreams, balancerOptions(opts)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return handler(b), b, nil
+}
+
+// New creates a new balancer plugin for the given upstreams and algorithm.
+// An empty algorithm uses the weighted round robin algorithm.
+func New(upstreams []balancer.Upstream, algorithm string) (plugin.Plugin, error) {
+	opts := config.Config{"upstreams": formatUpstreams(upstreams)}
+	if algorithm != "" {
+		opts.Set("algorithm", algorithm)
+	}
+	return plugin.NewWithConfig(Plugin, opts)
+}
+
+// handler returns the plugin handler who forwards the traffic to the given balancer.
+func handler(b *balancer.Balancer) plugin.Handler {
+	return func(h http.Handler) http.Handler {
+		return b
+	}
+}
+
+// balancerOptions creates the balancer options based on the given plugin config.
+func balancerOptions(opts config.Config) []balancer.OptSetter {
+	setters := []balancer.OptSetter{balancer.Algorithm(opts.GetString("algorithm"))}
+	if opts.GetString("algorithm") == balancer.ConsistentHash {
+		key, _ := balancer.ParseHashKey(opts.GetString("hashKey"))
+		setters = append(setters, balancer.Custom(balancer.NewConsistentHash(key)))
+	}
+	if name := opts.GetString("stickyCookie"); name != "" {
+		setters = append(setters, balancer.StickyCookie(balancer.Affinity{Name: name}))
+	}
+	if prefix := opts.GetString("stripPrefix"); prefix != "" {
+		setters = append(setters, balancer.Forward(forward.StripPrefix(prefix)))
+	}
+
+	if opts.GetBool("healthCheck") {
+		setters = append(setters, balancer.CheckHealth(healthCheck(opts)))
+	}
+	if opts.GetBool("circuitBreaker") {
+		setters = append(setters, balancer.CircuitBreaker(breaker(opts)))
+	}
+	if delay := opts.GetInt("hedgeDelay"); delay > 0 {
+		setters = append(setters, balancer.Hedging(balancer.Hedge{
+			Delay:  time.Duration(delay) * time.Millisecond,
+			Budget: float64(opts.GetInt("hedgeBudget")),
+		}))
+	}
+	return setters
+}
+
+// healthCheck creates the upstream health checks based on the given plugin config.
+func healthCheck(opts config.Config) balancer.HealthCheck {
+	return balancer.HealthCheck{
+		Path:     opts.GetString("healthPath"),
+		Status:   opts.GetInt("healthStatus"),
+		Interval: time.Duration(opts.GetInt("healthInterval")) * time.Millisecond,
+		Timeout:  time.Duration(opts.GetInt("healthTimeout")) * time.Millisecond,
+		Rise:     opts.GetInt("healthRise"),
+		Fall:     opts.GetInt("healthFall"),
+	}
+}
+
+// breaker creates the upstream circuit breaker based on the given plugin config.
+func breaker(opts config.Config) balancer.Breaker {
+	return balancer.Breaker{
+		Failures:         opts.GetInt("breakerFailures"),
+		OpenTimeout:      time.Duration(opts.GetInt("breakerTimeout")) * time.Millisecond,
+		HalfOpenRequests: opts.GetInt("breakerHalfOpenRequests"),
+	}
+}
+
+// formatUpstreams formats the given upstreams as plugin param.
+func formatUpstreams(upstreams []balancer.Upstream) string {
+	list := ""
+	for i, upstream := range upstreams {
+		if i > 0 {
+			list += ", "
+		}
+		list += upstream.URL
+		if upstream.Weight > 0 {
+			list += " weight=" + strconv.Itoa(upstream.Weight)
+		}
+	}
+	return list
+}
+
+func init() {
+	plugin.Register(Plugin)
+	plugin.Register(DiscoveryPlugin)
+}
@@ -0,0 +1,131 @@
+package balancer
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+func TestPlugin(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(req.URL.Path))
+	}))
+	defer srv.Close()
+
+	p, err := plugin.Init(Name, config.Config{"upstreams": srv.URL + " weight=2", "stripPrefix": "/api"})
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Config().GetString("algorithm"), balancer.WeightedRoundRobin)
+
+	w := httptest.NewRecorder()
+	p.HandleHTTP(nil).ServeHTTP(w, httptest.NewRequest("GET", "/api/users", nil))
+	st.Expect(t, w.Code, http.StatusOK)
+	st.Expect(t, w.Body.String(), "/users")
+}
+
+func TestPluginClose(t *testing.T) {
+	registered := len(balancer.All())
+	p, err := plugin.Init(Name, config.Config{"upstreams": "http://localhost", "healthCheck": true})
+	st.Expect(t, err, nil)
+	st.Expect(t, len(balancer.All()), registered+1)
+
+	layer := plugin.NewLayer()
+	layer.Use(p)
+	st.Expect(t, layer.Remove(p.ID()), true)
+	st.Expect(t, len(balancer.All()), registered)
+}
+
+func TestNew(t *testing.T) {
+	p, err := New([]balancer.Upstream{{URL: "http://10.0.0.1", Weight: 3}, {URL: "http://10.0.0.2"}}, balancer.LeastConnections)
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Name(), Name)
+	st.Expect(t, p.Config().GetString("upstreams"), "http://10.0.0.1 weight=3, http://10.0.0.2")
+	st.Expect(t, p.Config().GetString("algorithm"), balancer.LeastConnections)
+}
+
+func TestPluginParams(t *testing.T) {
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "algorithm": balancer.IPHash})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "algorithm": "foo"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost weight=foo"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{})
+	st.Reject(t, err, nil)
+}
+
+func TestHealthCheckParams(t *testing.T) {
+	opts := config.Config{"healthPath": "/health", "healthInterval": 500, "healthRise": 1}
+	check := healthCheck(opts)
+	st.Expect(t, check.Path, "/health")
+	st.Expect(t, check.Interval, 500*time.Millisecond)
+	st.Expect(t, check.Rise, 1)
+
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "healthCheck": true, "healthFall": -1})
+	st.Reject(t, err, nil)
+}
+
+func TestBreakerParams(t *testing.T) {
+	opts := config.Config{"breakerFailures": 3, "breakerTimeout": 1000}
+	b := breaker(opts)
+	st.Expect(t, b.Failures, 3)
+	st.Expect(t, b.OpenTimeout, time.Second)
+	st.Expect(t, b.HalfOpenRequests, 0)
+
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "circuitBreaker": true, "breakerFailures": 3})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "circuitBreaker": true, "breakerTimeout": -1})
+	st.Reject(t, err, nil)
+}
+
+func TestHedgeParams(t *testing.T) {
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "hedgeDelay": 50, "hedgeBudget": 20})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "hedgeDelay": 50, "hedgeBudget": 150})
+	st.Reject(t, err, nil)
+}
+
+func TestStickyParams(t *testing.T) {
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "algorithm": balancer.ConsistentHash, "hashKey": "header:X-User-Id", "stickyCookie": "sticky"})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"upstreams": "http://localhost", "algorithm": balancer.ConsistentHash, "hashKey": "foo"})
+	st.Reject(t, err, nil)
+}
+
+func TestDiscoveryPlugin(t *testing.T) {
+	file, err := ioutil.TempFile("", "services*.yaml")
+	st.Expect(t, err, nil)
+	defer os.Remove(file.Name())
+	file.WriteString("api:\n  - http://localhost\n")
+	file.Close()
+
+	registered := len(balancer.All())
+	p, err := NewDiscovery(file.Name(), "api")
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Name(), DiscoveryName)
+	st.Expect(t, len(balancer.All()), registered+1)
+
+	// The service discovery and its balancer are closed with the plugin
+	st.Expect(t, p.(io.Closer).Close(), nil)
+	st.Expect(t, len(balancer.All()), registered)
+
+	_, err = NewDiscovery(file.Name(), "web")
+	st.Reject(t, err, nil)
+
+	_, err = NewDiscovery("missing.yaml", "api")
+	st.Reject(t, err, nil)
+}
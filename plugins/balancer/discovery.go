@@ -0,0 +1,108 @@
+package balancer
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/discovery"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+const (
+	// DiscoveryName defines the discovery plugin semantic identifier.
+	DiscoveryName = "discovery"
+	// DiscoveryDescription defines the discovery plugin friendly description.
+	DiscoveryDescription = "Balance HTTP traffic across the upstream servers of a discovered service"
+)
+
+func fileValidator(value interface{}, opts config.Config) error {
+	_, err := discovery.File(value.(string)).Services()
+	return err
+}
+
+func serviceValidator(value interface{}, opts config.Config) error {
+	services, err := discovery.File(opts.GetString("file")).Services()
+	if err != nil {
+		return err
+	}
+	if _, ok := services[value.(string)]; !ok {
+		return errors.New("discovery: service not found: " + value.(string))
+	}
+	return nil
+}
+
+// discoveryParams defines the discovery plugin specific configuration params.
+var discoveryParams = append(plugin.Params{
+	plugin.Field{
+		Name:        "file",
+		Type:        "string",
+		Description: "JSON or YAML file defining the upstream servers of every service",
+		Examples:    []string{"/etc/vinxi/services.json", "/etc/vinxi/services.yaml"},
+		Mandatory:   true,
+		Validator:   fileValidator,
+	},
+	plugin.Field{
+		Name:        "service",
+		Type:        "string",
+		Description: "Service name whose upstream servers receive the traffic",
+		Mandatory:   true,
+		Validator:   serviceValidator,
+	},
+	plugin.Field{
+		Name:        "interval",
+		Type:        "int",
+		Description: "Milliseconds between service file checks",
+		Validator:   positiveValidator,
+	},
+}, balancerParams...)
+
+// DiscoveryPlugin exposes the discovery plugin metadata information.
+// Mostly used internally.
+var DiscoveryPlugin = plugin.Info{
+	Name:            DiscoveryName,
+	Description:     DiscoveryDescription,
+	ClosableFactory: discoveryFactory,
+	Params:          discoveryParams,
+}
+
+// discoveryFactory represents the discovery plugin factory function
+// designed to be called via rules constructor.
+// The service discovery and its balancer are closed once the plugin is removed.
+func discoveryFactory(opts config.Config) (plugin.Handler, io.Closer, error) {
+	setters := []discovery.OptSetter{}
+	if interval := opts.GetInt("interval"); interval > 0 {
+		setters = append(setters, discovery.Interval(time.Duration(interval)*time.Millisecond))
+	}
+
+	d, err := discovery.New(discovery.File(opts.GetString("file")), setters...)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := d.Balancer(opts.GetString("service"), balancerOptions(opts)...)
+	if err != nil {
+		d.Close()
+		return nil, nil, err
+	}
+	return handler(b), discoveryCloser{d, b}, nil
+}
+
+// discoveryCloser closes the discovery plugin balancer and its service discovery.
+type discoveryCloser struct {
+	discovery *discovery.Discovery
+	balancer  *balancer.Balancer
+}
+
+// Close implements the io.Closer interface.
+func (c discoveryCloser) Close() error {
+	c.balancer.Close()
+	return c.discovery.Close()
+}
+
+// NewDiscovery creates a new discovery plugin who balances the traffic across
+// the upstream servers of the given service defined in the given file.
+func NewDiscovery(file, service string) (plugin.Plugin, error) {
+	return plugin.NewWithConfig(DiscoveryPlugin, config.Config{"file": file, "service": service})
+}
@@ -1,9 +1,13 @@
 package forward
 
 import (
+	"crypto/tls"
 	"errors"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"gopkg.in/vinxi/vinxi.v0/config"
 	"gopkg.in/vinxi/vinxi.v0/forward"
@@ -22,10 +26,62 @@ func validator(value interface{}, opts config.Config) error {
 	if uri == "" {
 		return errors.New("forward: url param cannot be empty")
 	}
-	_, err := url.Parse(uri)
+	if strings.HasPrefix(uri, forward.UnixScheme+"://") {
+		_, _, err := forward.ParseUnixTarget(uri)
+		return err
+	}
+	u, err := url.Parse(uri)
 	if err != nil {
 		return errors.New("forward: invalid URL (" + err.Error() + ")")
 	}
+	if u.Host == "" {
+		return errors.New("forward: URL must be absolute")
+	}
+	return nil
+}
+
+func statusValidator(value interface{}, opts config.Config) error {
+	if _, err := parseStatusCodes(value.(string)); err != nil {
+		return errors.New("forward: invalid retry status codes (" + err.Error() + ")")
+	}
+	return nil
+}
+
+func proxyProtocolValidator(value interface{}, opts config.Config) error {
+	if version := value.(int); version != forward.ProxyProtocolV1 && version != forward.ProxyProtocolV2 {
+		return errors.New("forward: PROXY protocol version must be 1 or 2")
+	}
+	return nil
+}
+
+func networksValidator(value interface{}, opts config.Config) error {
+	_, err := forward.ParseNetworks(strings.Split(value.(string), ",")...)
+	return err
+}
+
+func certificateValidator(value interface{}, opts config.Config) error {
+	keyFile := opts.GetString("tlsKeyFile")
+	if keyFile == "" {
+		return errors.New("forward: tlsKeyFile param is required by tlsCertFile")
+	}
+	_, err := tls.LoadX509KeyPair(value.(string), keyFile)
+	return err
+}
+
+func caValidator(value interface{}, opts config.Config) error {
+	_, err := forward.LoadCertPool(value.(string))
+	return err
+}
+
+func tlsVersionValidator(value interface{}, opts config.Config) error {
+	_, err := forward.ParseTLSVersion(value.(string))
+	return err
+}
+
+func positiveValidator(value interface{}, opts config.Config) error {
+	if value.(int) < 0 {
+		return errors.New("forward: numeric params cannot be negative")
+	}
 	return nil
 }
 
@@ -38,6 +94,120 @@ var params = plugin.Params{
 		Mandatory:   true,
 		Validator:   validator,
 	},
+	plugin.Field{
+		Name:        "stripPrefix",
+		Type:        "string",
+		Description: "Path prefix to remove from the request path before forwarding",
+		Examples:    []string{"/api"},
+	},
+	plugin.Field{
+		Name:        "timeout",
+		Type:        "int",
+		Description: "Maximum milliseconds for the whole upstream round trip",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "connectTimeout",
+		Type:        "int",
+		Description: "Maximum milliseconds to establish the upstream connection",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "responseHeaderTimeout",
+		Type:        "int",
+		Description: "Maximum milliseconds to wait for the upstream response headers",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "retries",
+		Type:        "int",
+		Description: "Maximum number of retries for failed idempotent requests",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "retryBackoff",
+		Type:        "int",
+		Description: "Milliseconds to wait before the first retry, doubled on every retry",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "retryMethods",
+		Type:        "string",
+		Description: "Comma separated list of HTTP methods to retry",
+		Examples:    []string{"GET,HEAD", "GET,PUT,DELETE"},
+	},
+	plugin.Field{
+		Name:        "retryStatus",
+		Type:        "string",
+		Description: "Comma separated list of upstream response status codes to retry",
+		Examples:    []string{"502,503,504"},
+		Validator:   statusValidator,
+	},
+	plugin.Field{
+		Name:        "retryTimeouts",
+		Type:        "bool",
+		Description: "Retry requests who failed due to a network timeout",
+	},
+	plugin.Field{
+		Name:        "retryMaxBodySize",
+		Type:        "int",
+		Description: "Maximum request body size in bytes to buffer for retries",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "proxyProtocol",
+		Type:        "int",
+		Description: "PROXY protocol version to send the client address to upstream servers",
+		Examples:    []string{"1", "2"},
+		Validator:   proxyProtocolValidator,
+	},
+	plugin.Field{
+		Name:        "trustedProxies",
+		Type:        "string",
+		Description: "Comma separated list of networks whose forwarding headers are trusted",
+		Examples:    []string{"10.0.0.0/8", "10.0.0.0/8,192.168.1.10"},
+		Validator:   networksValidator,
+	},
+	plugin.Field{
+		Name:        "forwardedHeader",
+		Type:        "bool",
+		Description: "Parse and set the RFC 7239 Forwarded header",
+	},
+	plugin.Field{
+		Name:        "tlsCertFile",
+		Type:        "string",
+		Description: "Client certificate file presented to upstream servers",
+		Validator:   certificateValidator,
+	},
+	plugin.Field{
+		Name:        "tlsKeyFile",
+		Type:        "string",
+		Description: "Client certificate private key file",
+	},
+	plugin.Field{
+		Name:        "tlsCAFile",
+		Type:        "string",
+		Description: "CA certificates file used to verify upstream servers",
+		Validator:   caValidator,
+	},
+	plugin.Field{
+		Name:        "tlsServerName",
+		Type:        "string",
+		Description: "Server name sent via SNI and used to verify upstream servers",
+	},
+	plugin.Field{
+		Name:        "tlsMinVersion",
+		Type:        "string",
+		Description: "Minimum TLS version accepted with upstream servers",
+		Examples:    []string{"1.2", "1.3"},
+		Validator:   tlsVersionValidator,
+	},
+	plugin.Field{
+		Name:        "websocketMaxMessageSize",
+		Type:        "int",
+		Description: "Maximum websocket message size in bytes, enables websocket message inspection",
+		Validator:   positiveValidator,
+	},
 }
 
 // Plugin exposes the rule metadata information.
@@ -60,10 +230,113 @@ func New(url string) (plugin.Plugin, error) {
 	return plugin.NewWithConfig(Plugin, config.Config{"url": url})
 }
 
-func handler(opts config.Config) plugin.Handler {
+// NewInterceptor creates a new forward plugin who calls the given
+// interceptor for every proxied websocket message.
+func NewInterceptor(url string, interceptor forward.WebsocketInterceptor) (plugin.Plugin, error) {
+	info := Plugin
+	info.Factory = func(opts config.Config) plugin.Handler {
+		return handler(opts, forward.WebsocketInterception(interceptor))
+	}
+	return plugin.NewWithConfig(info, config.Config{"url": url})
+}
+
+func handler(opts config.Config, setters ...forward.OptSetter) plugin.Handler {
+	if prefix := opts.GetString("stripPrefix"); prefix != "" {
+		setters = append(setters, forward.StripPrefix(prefix))
+	}
+
+	timeouts := forward.Timeouts{
+		Total:          milliseconds(opts.GetInt("timeout")),
+		Connect:        milliseconds(opts.GetInt("connectTimeout")),
+		ResponseHeader: milliseconds(opts.GetInt("responseHeaderTimeout")),
+	}
+	setters = append(setters, forward.Timeout(timeouts))
+
+	if retries := opts.GetInt("retries"); retries > 0 {
+		setters = append(setters, forward.Retry(retryPolicy(opts)))
+	}
+
+	if version := opts.GetInt("proxyProtocol"); version > 0 {
+		setters = append(setters, forward.ProxyProtocol(version))
+	}
+
+	if networks := opts.GetString("trustedProxies"); networks != "" {
+		setters = append(setters, forward.TrustedProxies(strings.Split(networks, ",")...))
+	}
+	if opts.GetBool("forwardedHeader") {
+		setters = append(setters, forward.ForwardedHeader())
+	}
+
+	setters = append(setters, tlsOptions(opts)...)
+
+	if size := opts.GetInt("websocketMaxMessageSize"); size > 0 {
+		setters = append(setters, forward.WebsocketMaxMessageSize(int64(size)))
+	}
+
+	fwd := http.HandlerFunc(forward.To(opts.GetString("url"), setters...))
 	return func(h http.Handler) http.Handler {
-		return http.HandlerFunc(forward.To(opts.GetString("url")))
+		return fwd
+	}
+}
+
+// retryPolicy creates the forward retry policy based on the given plugin config.
+func retryPolicy(opts config.Config) forward.RetryPolicy {
+	policy := forward.RetryPolicy{
+		Attempts:    opts.GetInt("retries") + 1,
+		Backoff:     milliseconds(opts.GetInt("retryBackoff")),
+		Timeouts:    opts.GetBool("retryTimeouts"),
+		MaxBodySize: int64(opts.GetInt("retryMaxBodySize")),
+	}
+	if methods := opts.GetString("retryMethods"); methods != "" {
+		for _, method := range strings.Split(methods, ",") {
+			policy.Methods = append(policy.Methods, strings.ToUpper(strings.TrimSpace(method)))
+		}
+	}
+	policy.StatusCodes, _ = parseStatusCodes(opts.GetString("retryStatus"))
+	return policy
+}
+
+// tlsOptions creates the upstream TLS forwarder options based on the given plugin config.
+func tlsOptions(opts config.Config) []forward.OptSetter {
+	setters := []forward.OptSetter{}
+	if cert := opts.GetString("tlsCertFile"); cert != "" {
+		setters = append(setters, forward.ClientCertificate(cert, opts.GetString("tlsKeyFile")))
+	}
+	if ca := opts.GetString("tlsCAFile"); ca != "" {
+		setters = append(setters, forward.RootCAs(ca))
+	}
+	if name := opts.GetString("tlsServerName"); name != "" {
+		setters = append(setters, forward.ServerName(name))
+	}
+	if version, err := forward.ParseTLSVersion(opts.GetString("tlsMinVersion")); err == nil {
+		setters = append(setters, forward.MinTLSVersion(version))
+	}
+	return setters
+}
+
+// milliseconds returns the given number of milliseconds as time.Duration.
+func milliseconds(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
+
+// parseStatusCodes parses a comma separated list of HTTP status codes.
+func parseStatusCodes(list string) ([]int, error) {
+	codes := []int{}
+	for _, value := range strings.Split(list, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		code, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if code < 100 || code > 599 {
+			return nil, errors.New("invalid status code: " + value)
+		}
+		codes = append(codes, code)
 	}
+	return codes, nil
 }
 
 func init() {
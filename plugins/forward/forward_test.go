@@ -1 +1,99 @@
 package forward
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+func TestParseStatusCodes(t *testing.T) {
+	codes, err := parseStatusCodes("502, 503,504")
+	st.Expect(t, err, nil)
+	st.Expect(t, codes, []int{502, 503, 504})
+
+	codes, err = parseStatusCodes("")
+	st.Expect(t, err, nil)
+	st.Expect(t, len(codes), 0)
+
+	_, err = parseStatusCodes("502,foo")
+	st.Reject(t, err, nil)
+	_, err = parseStatusCodes("700")
+	st.Reject(t, err, nil)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	opts := config.Config{
+		"retries":       2,
+		"retryBackoff":  100,
+		"retryMethods":  "get, put",
+		"retryStatus":   "503",
+		"retryTimeouts": true,
+	}
+	policy := retryPolicy(opts)
+	st.Expect(t, policy.Attempts, 3)
+	st.Expect(t, policy.Backoff, 100*time.Millisecond)
+	st.Expect(t, policy.Methods, []string{"GET", "PUT"})
+	st.Expect(t, policy.StatusCodes, []int{503})
+	st.Expect(t, policy.Timeouts, true)
+}
+
+func TestPluginParams(t *testing.T) {
+	_, err := plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "retries": 2, "retryStatus": "503"})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "retries": -1})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "retryStatus": "foo"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "localhost"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "unix:///run/app.sock:/api"})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "unix://"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "proxyProtocol": 2})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "proxyProtocol": 3})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "trustedProxies": "10.0.0.0/8, 192.168.1.10", "forwardedHeader": true})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "trustedProxies": "10.0.0.0/33"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "https://localhost", "tlsServerName": "example.com", "tlsMinVersion": "1.2"})
+	st.Expect(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "https://localhost", "tlsMinVersion": "1.4"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "https://localhost", "tlsCertFile": "client.crt"})
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "https://localhost", "tlsCAFile": "missing.crt"})
+	st.Reject(t, err, nil)
+}
+
+func TestNewInterceptor(t *testing.T) {
+	interceptor := forward.WebsocketInterceptorFunc(func(msg *forward.WebsocketMessage) forward.WebsocketAction {
+		return forward.ActionForward
+	})
+	p, err := NewInterceptor("http://localhost", interceptor)
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Name(), Name)
+	st.Expect(t, p.Config().GetString("url"), "http://localhost")
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "websocketMaxMessageSize": -1})
+	st.Reject(t, err, nil)
+}
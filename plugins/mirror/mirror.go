@@ -0,0 +1,161 @@
+package mirror
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/forward"
+	"gopkg.in/vinxi/vinxi.v0/mirror"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+const (
+	// Name defines the plugin semantic identifier.
+	Name = "mirror"
+	// Description defines the plugin friendly description.
+	Description = "Mirror HTTP traffic to a secondary upstream server"
+)
+
+func validator(value interface{}, opts config.Config) error {
+	uri := value.(string)
+	if uri == "" {
+		return errors.New("mirror: url param cannot be empty")
+	}
+	if strings.HasPrefix(uri, forward.UnixScheme+"://") {
+		_, _, err := forward.ParseUnixTarget(uri)
+		return err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return errors.New("mirror: invalid URL (" + err.Error() + ")")
+	}
+	if u.Host == "" {
+		return errors.New("mirror: URL must be absolute")
+	}
+	return nil
+}
+
+func percentageValidator(value interface{}, opts config.Config) error {
+	if percentage := value.(float64); percentage < 0 || percentage > 100 {
+		return errors.New("mirror: percentage must be between 0 and 100")
+	}
+	return nil
+}
+
+func positiveValidator(value interface{}, opts config.Config) error {
+	if value.(int) < 0 {
+		return errors.New("mirror: numeric params cannot be negative")
+	}
+	return nil
+}
+
+// params defines the rule specific configuration params.
+var params = plugin.Params{
+	plugin.Field{
+		Name:        "url",
+		Type:        "string",
+		Description: "Mirror server URL",
+		Mandatory:   true,
+		Validator:   validator,
+	},
+	plugin.Field{
+		Name:        "percentage",
+		Type:        "float",
+		Description: "Percentage of requests to mirror",
+		Default:     100.0,
+		Examples:    []string{"0.5", "10", "100"},
+		Validator:   percentageValidator,
+	},
+	plugin.Field{
+		Name:        "timeout",
+		Type:        "int",
+		Description: "Maximum milliseconds to wait for every mirrored request",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "maxBodySize",
+		Type:        "int",
+		Description: "Maximum request body size in bytes to buffer, bigger requests are not mirrored",
+		Validator:   positiveValidator,
+	},
+	plugin.Field{
+		Name:        "maxConcurrency",
+		Type:        "int",
+		Description: "Maximum number of in-flight mirrored requests",
+		Validator:   positiveValidator,
+	},
+}
+
+// Plugin exposes the rule metadata information.
+// Mostly used internally.
+var Plugin = plugin.Info{
+	Name:            Name,
+	Description:     Description,
+	ClosableFactory: factory,
+	Params:          params,
+}
+
+// factory represents the rule factory function
+// designed to be called via rules constructor.
+func factory(opts config.Config) (plugin.Handler, io.Closer, error) {
+	m, err := mirror.New(opts.GetString("url"), options(opts)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return handler(m), stats{m}, nil
+}
+
+// stats exposes the mirrored requests counters as plugin metadata.
+type stats struct {
+	mirror *mirror.Mirror
+}
+
+// Metadata implements the plugin.MetadataProvider interface.
+func (s stats) Metadata() config.Config {
+	return config.Config{"stats": s.mirror.Stats()}
+}
+
+// Close implements the io.Closer interface.
+// In-flight mirrored requests are not awaited.
+func (s stats) Close() error {
+	return nil
+}
+
+// New creates a new mirror plugin who mirrors the given percentage of requests
+// to the given server URL.
+func New(url string, percentage float64) (plugin.Plugin, error) {
+	return plugin.NewWithConfig(Plugin, config.Config{"url": url, "percentage": percentage})
+}
+
+// handler returns the plugin handler who mirrors the traffic with the given mirror.
+func handler(m *mirror.Mirror) plugin.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.HandleHTTP(w, r, h)
+		})
+	}
+}
+
+// options creates the mirror options based on the given plugin config.
+func options(opts config.Config) []mirror.OptSetter {
+	setters := []mirror.OptSetter{mirror.Percentage(opts.GetFloat("percentage"))}
+	if timeout := opts.GetInt("timeout"); timeout > 0 {
+		setters = append(setters, mirror.Timeout(time.Duration(timeout)*time.Millisecond))
+	}
+	if size := opts.GetInt("maxBodySize"); size > 0 {
+		setters = append(setters, mirror.MaxBodySize(int64(size)))
+	}
+	if n := opts.GetInt("maxConcurrency"); n > 0 {
+		setters = append(setters, mirror.MaxConcurrency(n))
+	}
+	return setters
+}
+
+func init() {
+	plugin.Register(Plugin)
+}
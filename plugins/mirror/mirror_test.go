@@ -0,0 +1,58 @@
+package mirror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/nbio/st"
+	"github.com/vulcand/oxy/testutils"
+	"gopkg.in/vinxi/vinxi.v0/config"
+	"gopkg.in/vinxi/vinxi.v0/mirror"
+	"gopkg.in/vinxi/vinxi.v0/plugin"
+)
+
+func TestPluginParams(t *testing.T) {
+	p, err := New("http://localhost", 10)
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Name(), Name)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "timeout": 500, "maxBodySize": 1024, "maxConcurrency": 10})
+	st.Expect(t, err, nil)
+
+	p, err = New("http://localhost", 0.5)
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Config().GetFloat("percentage"), 0.5)
+
+	p, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "percentage": 25})
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Config().GetFloat("percentage"), 25.0)
+
+	_, err = New("http://localhost", 101)
+	st.Reject(t, err, nil)
+
+	_, err = New("localhost", 100)
+	st.Reject(t, err, nil)
+
+	_, err = plugin.NewWithConfig(Plugin, config.Config{"url": "http://localhost", "timeout": -1})
+	st.Reject(t, err, nil)
+}
+
+func TestPluginStats(t *testing.T) {
+	srv := testutils.NewHandler(func(w http.ResponseWriter, req *http.Request) {})
+	defer srv.Close()
+
+	p, err := New(srv.URL, 100)
+	st.Expect(t, err, nil)
+	st.Expect(t, p.Metadata()["stats"], mirror.Stats{})
+
+	handler := p.HandleHTTP(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	deadline := time.Now().Add(time.Second)
+	for p.Metadata()["stats"] != (mirror.Stats{Succeeded: 1}) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	st.Expect(t, p.Metadata()["stats"], mirror.Stats{Succeeded: 1})
+}
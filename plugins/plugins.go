@@ -3,6 +3,8 @@ package plugins
 import (
 	// Ugly but unique way to autoload subpackages
 	_ "gopkg.in/vinxi/vinxi.v0/plugins/auth"
+	_ "gopkg.in/vinxi/vinxi.v0/plugins/balancer"
 	_ "gopkg.in/vinxi/vinxi.v0/plugins/forward"
+	_ "gopkg.in/vinxi/vinxi.v0/plugins/mirror"
 	_ "gopkg.in/vinxi/vinxi.v0/plugins/static"
 )
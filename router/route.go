@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"net/url"
 
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/canary"
+	"gopkg.in/vinxi/vinxi.v0/discovery"
 	"gopkg.in/vinxi/vinxi.v0/forward"
 	"gopkg.in/vinxi/vinxi.v0/layer"
 )
@@ -46,8 +49,29 @@ func (r *Route) Match(path string) (url.Values, bool) {
 }
 
 // Forward defines the default URL to forward incoming traffic.
-func (r *Route) Forward(uri string) {
-	r.Layer.UseFinalHandler(http.HandlerFunc(forward.To(uri)))
+// Optional forwarder settings can be passed, such as forward.StripPrefix
+// to remove the matched route prefix from the forwarded path.
+func (r *Route) Forward(uri string, opts ...forward.OptSetter) {
+	r.Layer.UseFinalHandler(http.HandlerFunc(forward.To(uri, opts...)))
+}
+
+// Balance balances the incoming traffic across the given upstream servers.
+// The balancer is closed once the final handler is replaced.
+// Optional balancer settings can be passed, such as balancer.Algorithm.
+func (r *Route) Balance(upstreams []balancer.Upstream, opts ...balancer.OptSetter) {
+	r.Layer.UseOwnedFinalHandler(balancer.Must(balancer.New(upstreams, opts...)))
+}
+
+// Discover balances the incoming traffic across the upstream servers of the given discovered service.
+func (r *Route) Discover(d *discovery.Discovery, service string, opts ...balancer.OptSetter) {
+	r.Layer.UseOwnedFinalHandler(balancer.Must(d.Balancer(service, opts...)))
+}
+
+// Split splits the incoming traffic across the given variants based on their weights.
+// Optional splitter settings can be passed, such as canary.Sticky.
+// The splitter is closed once the final handler is replaced.
+func (r *Route) Split(variants []canary.Variant, opts ...canary.OptSetter) {
+	r.Layer.UseOwnedFinalHandler(canary.Must(canary.New(variants, opts...)))
 }
 
 // Use attaches a new middleware handler for incoming HTTP traffic.
@@ -8,8 +8,11 @@ import (
 	"net/url"
 	"strings"
 
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/discovery"
 	"gopkg.in/vinxi/vinxi.v0/forward"
 	"gopkg.in/vinxi/vinxi.v0/layer"
+	"gopkg.in/vinxi/vinxi.v0/utils"
 )
 
 var (
@@ -127,8 +130,21 @@ func New() *Router {
 }
 
 // Forward defines the default URL to forward incoming traffic.
-func (r *Router) Forward(uri string) *Router {
-	r.Layer.UseFinalHandler(http.HandlerFunc(forward.To(uri)))
+func (r *Router) Forward(uri string, opts ...forward.OptSetter) *Router {
+	r.Layer.UseFinalHandler(http.HandlerFunc(forward.To(uri, opts...)))
+	return r
+}
+
+// Balance balances the incoming traffic across the given upstream servers.
+// The balancer is closed once the final handler is replaced.
+func (r *Router) Balance(upstreams []balancer.Upstream, opts ...balancer.OptSetter) *Router {
+	r.Layer.UseOwnedFinalHandler(balancer.Must(balancer.New(upstreams, opts...)))
+	return r
+}
+
+// Discover balances the incoming traffic across the upstream servers of the given discovered service.
+func (r *Router) Discover(d *discovery.Discovery, service string, opts ...balancer.OptSetter) *Router {
+	r.Layer.UseOwnedFinalHandler(balancer.Must(d.Balancer(service, opts...)))
 	return r
 }
 
@@ -174,6 +190,12 @@ func (r *Router) All(path string) *Route {
 	return r.add("*", path, nil)
 }
 
+// GRPC will register a route for the given fully qualified gRPC service
+// name and method. An empty method matches any service method.
+func (r *Router) GRPC(service, method string) *Route {
+	return r.add("POST", "/"+service+"/"+method, nil)
+}
+
 // Route will register a new route for the given pattern and HTTP method.
 func (r *Router) Route(method, path string) *Route {
 	return r.add(method, path, nil)
@@ -274,7 +296,7 @@ func (r *Router) HandleHTTP(w http.ResponseWriter, req *http.Request, h http.Han
 
 	// If method not allowed behavior is enable,
 	if r.ForceMethodNotAllowed && r.isMethodNotAllowed(w, req) {
-		http.Error(w, "Method Not Allowed", 405)
+		utils.RenderError(w, req, http.StatusMethodNotAllowed, nil)
 		return
 	}
 
@@ -191,3 +191,22 @@ func routeExists(r *Router, method, path string) bool {
 	route, _ := r.FindRoute(method, path)
 	return route != nil
 }
+
+func TestRouterGRPC(t *testing.T) {
+	p := New()
+	p.GRPC("helloworld.Greeter", "SayHello")
+	p.GRPC("routeguide.RouteGuide", "")
+
+	route, err := p.FindRoute("POST", "/helloworld.Greeter/SayHello")
+	st.Expect(t, err, nil)
+	st.Expect(t, route.Pattern, "/helloworld.Greeter/SayHello")
+
+	route, err = p.FindRoute("POST", "/routeguide.RouteGuide/GetFeature")
+	st.Expect(t, err, nil)
+	st.Expect(t, route.Pattern, "/routeguide.RouteGuide/")
+
+	_, err = p.FindRoute("POST", "/helloworld.Greeter/SayBye")
+	st.Expect(t, err, ErrNoRouteMatch)
+	_, err = p.FindRoute("GET", "/helloworld.Greeter/SayHello")
+	st.Expect(t, err, ErrNoRouteMatch)
+}
@@ -4,6 +4,9 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 var (
@@ -26,6 +29,9 @@ type ServerOptions struct {
 	Forward      string `json:"forward,omitempty"`
 	CertFile     string `json:"certificate,omitempty"`
 	KeyFile      string `json:"-"`
+	// H2C enables HTTP/2 over cleartext TCP connections, such as for gRPC clients.
+	// HTTP/2 is always negotiated via ALPN with TLS servers.
+	H2C bool `json:"h2c,omitempty"`
 }
 
 // Server represents a simple wrapper around http.Server for better convenience
@@ -64,6 +70,7 @@ func NewServer(o ServerOptions) *Server {
 
 	vinxi := New()
 	vinxi.BindServer(svr)
+	bindProtocols(svr, o)
 
 	if o.Forward != "" {
 		vinxi.Forward(o.Forward)
@@ -83,3 +90,10 @@ func (s *Server) Listen() error {
 	}
 	return s.Server.ListenAndServe()
 }
+
+// bindProtocols enables the HTTP/2 protocol support in the given server.
+func bindProtocols(server *http.Server, o ServerOptions) {
+	if o.H2C {
+		server.Handler = h2c.NewHandler(server.Handler, &http2.Server{})
+	}
+}
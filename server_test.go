@@ -1 +1,30 @@
 package vinxi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/utils"
+)
+
+func TestServerH2C(t *testing.T) {
+	srv := NewServer(ServerOptions{H2C: true})
+	srv.UseFinalHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+
+	ts := httptest.NewServer(srv.Server.Handler)
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := utils.NewH2CTransport().RoundTrip(req)
+	st.Expect(t, err, nil)
+	defer res.Body.Close()
+
+	body := make([]byte, 8)
+	n, _ := res.Body.Read(body)
+	st.Expect(t, res.StatusCode, 200)
+	st.Expect(t, string(body[:n]), "HTTP/2.0")
+}
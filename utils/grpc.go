@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes used by the proxy.
+// See: https://github.com/grpc/grpc/blob/master/doc/statuscodes.md
+const (
+	GRPCStatusOK                = 0
+	GRPCStatusCanceled          = 1
+	GRPCStatusUnknown           = 2
+	GRPCStatusDeadlineExceeded  = 4
+	GRPCStatusPermissionDenied  = 7
+	GRPCStatusResourceExhausted = 8
+	GRPCStatusUnimplemented     = 12
+	GRPCStatusInternal          = 13
+	GRPCStatusUnavailable       = 14
+	GRPCStatusUnauthenticated   = 16
+)
+
+// GRPCContentType stores the gRPC MIME type prefix.
+const GRPCContentType = "application/grpc"
+
+// IsGRPCRequest determines if the given HTTP request is a gRPC request.
+func IsGRPCRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.Header.Get("Content-Type"), GRPCContentType)
+}
+
+// GRPCStatusCode maps the given HTTP status code to the proper gRPC status code.
+// Proxy specific codes, such as client cancellations or gateway timeouts,
+// are mapped to their gRPC equivalent.
+func GRPCStatusCode(code int) int {
+	switch code {
+	case http.StatusOK:
+		return GRPCStatusOK
+	case StatusClientClosedRequest:
+		return GRPCStatusCanceled
+	case http.StatusGatewayTimeout:
+		return GRPCStatusDeadlineExceeded
+	case http.StatusBadRequest, http.StatusInternalServerError:
+		return GRPCStatusInternal
+	case http.StatusUnauthorized:
+		return GRPCStatusUnauthenticated
+	case http.StatusForbidden:
+		return GRPCStatusPermissionDenied
+	case http.StatusNotFound:
+		return GRPCStatusUnimplemented
+	case http.StatusTooManyRequests:
+		return GRPCStatusResourceExhausted
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return GRPCStatusUnavailable
+	}
+	return GRPCStatusUnknown
+}
+
+// WriteGRPCError replies to a gRPC request with a trailers-only response
+// with the given gRPC status code and message.
+func WriteGRPCError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", GRPCContentType)
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if message != "" {
+		w.Header().Set("Grpc-Message", encodeGRPCMessage(message))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes the given gRPC status message.
+func encodeGRPCMessage(msg string) string {
+	var buf strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&buf, "%%%02X", c)
+	}
+	return buf.String()
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestIsGRPCRequest(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost/helloworld.Greeter/SayHello", nil)
+	st.Expect(t, IsGRPCRequest(req), false)
+
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	st.Expect(t, IsGRPCRequest(req), true)
+}
+
+func TestGRPCStatusCode(t *testing.T) {
+	cases := []struct {
+		code   int
+		status int
+	}{
+		{http.StatusOK, GRPCStatusOK},
+		{StatusClientClosedRequest, GRPCStatusCanceled},
+		{http.StatusGatewayTimeout, GRPCStatusDeadlineExceeded},
+		{http.StatusBadGateway, GRPCStatusUnavailable},
+		{http.StatusServiceUnavailable, GRPCStatusUnavailable},
+		{http.StatusInternalServerError, GRPCStatusInternal},
+		{http.StatusNotFound, GRPCStatusUnimplemented},
+		{http.StatusTeapot, GRPCStatusUnknown},
+	}
+
+	for _, test := range cases {
+		st.Expect(t, GRPCStatusCode(test.code), test.status)
+	}
+}
+
+func TestGRPCErrorHandler(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://localhost/helloworld.Greeter/SayHello", nil)
+	req.Header.Set("Content-Type", "application/grpc")
+	w := httptest.NewRecorder()
+
+	DefaultHandler.ServeHTTP(w, req, context.DeadlineExceeded)
+	st.Expect(t, w.Code, http.StatusOK)
+	st.Expect(t, w.Header().Get("Content-Type"), "application/grpc")
+	st.Expect(t, w.Header().Get("Grpc-Status"), "4")
+	st.Expect(t, w.Header().Get("Grpc-Message"), "Gateway Timeout")
+	st.Expect(t, w.Body.Len(), 0)
+}
+
+func TestEncodeGRPCMessage(t *testing.T) {
+	st.Expect(t, encodeGRPCMessage("Bad Gateway"), "Bad Gateway")
+	st.Expect(t, encodeGRPCMessage("100%\nok"), "100%25%0Aok")
+}
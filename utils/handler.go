@@ -1,11 +1,23 @@
 package utils
 
 import (
+	"context"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 )
 
+// StatusClientClosedRequest defines the non-standard status code used
+// when the client closes the connection before the response is sent.
+const StatusClientClosedRequest = 499
+
+// ErrLoopDetected is used when a request was already forwarded by the same proxy.
+var ErrLoopDetected = errors.New("proxy loop detected")
+
+// ErrUnavailable is used when there is no upstream server available to forward the request.
+var ErrUnavailable = errors.New("no upstream server available")
+
 // ErrorHandler represents the error-specific interface required by error handlers.
 type ErrorHandler interface {
 	ServeHTTP(w http.ResponseWriter, req *http.Request, err error)
@@ -20,20 +32,39 @@ type ErrorHandlerFunc func(http.ResponseWriter, *http.Request, error)
 // DefaultHandler stores the default error handled to be used, which is an no-op.
 var DefaultHandler ErrorHandler = &StdHandler{}
 
-// ServeHTTP replies with the proper status code based on the given error and writes the body.
+// ServeHTTP replies with the proper status code based on the given error and
+// renders the error response using the request error renderer.
+// gRPC requests are replied with the equivalent gRPC status instead.
 func (e *StdHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, err error) {
-	statusCode := http.StatusInternalServerError
-	if e, ok := err.(net.Error); ok {
-		if e.Timeout() {
-			statusCode = http.StatusGatewayTimeout
-		} else {
-			statusCode = http.StatusBadGateway
+	statusCode := ErrorStatusCode(err)
+	if req != nil && IsGRPCRequest(req) {
+		WriteGRPCError(w, GRPCStatusCode(statusCode), http.StatusText(statusCode))
+		return
+	}
+	RenderError(w, req, statusCode, err)
+}
+
+// ErrorStatusCode returns the HTTP status code to reply with based on the given proxy error.
+func ErrorStatusCode(err error) int {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrLoopDetected):
+		return http.StatusLoopDetected
+	case errors.Is(err, ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return http.StatusGatewayTimeout
 		}
-	} else if err == io.EOF {
-		statusCode = http.StatusBadGateway
+		return http.StatusBadGateway
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		return http.StatusBadGateway
 	}
-	w.WriteHeader(statusCode)
-	w.Write([]byte(http.StatusText(statusCode)))
+	return http.StatusInternalServerError
 }
 
 // ServeHTTP calls f(w, r).
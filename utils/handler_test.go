@@ -2,10 +2,17 @@ package utils
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strings"
+	"testing"
 
+	"github.com/nbio/st"
 	. "gopkg.in/check.v1"
 )
 
@@ -32,3 +39,23 @@ func (s *UtilsSuite) TestDefaultHandlerErrors(c *C) {
 
 	c.Assert(w.Code, Equals, http.StatusBadGateway)
 }
+
+func TestErrorStatusCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		code int
+	}{
+		{io.EOF, http.StatusBadGateway},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, http.StatusBadGateway},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout},
+		{&url.Error{Op: "Get", Err: context.DeadlineExceeded}, http.StatusGatewayTimeout},
+		{context.Canceled, StatusClientClosedRequest},
+		{ErrLoopDetected, http.StatusLoopDetected},
+		{ErrUnavailable, http.StatusServiceUnavailable},
+		{errors.New("foo"), http.StatusInternalServerError},
+	}
+
+	for _, test := range cases {
+		st.Expect(t, ErrorStatusCode(test.err), test.code)
+	}
+}
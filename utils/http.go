@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"context"
+	"crypto/tls"
 	"io"
 	"net"
 	"net/http"
@@ -8,6 +10,8 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"golang.org/x/net/http2"
 )
 
 // ProxyWriter helps to capture response headers and status code
@@ -183,11 +187,16 @@ func ConstainsHeader(req *http.Request, name, value string) bool {
 // Designed to be reused by multiple packages and efficient in terms of GC (won't leak).
 var DefaultTransport *http.Transport
 
-// init initializes the default transport
+// DefaultH2CTransport is the default HTTP/2 transport used for cleartext upstream servers.
+// Designed to be reused by multiple packages in order to multiplex requests over the same connections.
+var DefaultH2CTransport *http2.Transport
+
+// init initializes the default transports
 func init() {
 	var transport = NewDefaultPooledTransport()
 	EnsureTransporterFinalized(transport)
 	DefaultTransport = transport
+	DefaultH2CTransport = NewH2CTransport()
 }
 
 // EnsureTransporterFinalized will ensure that when the HTTP client is GCed
@@ -215,12 +224,33 @@ func NewDefaultTransport() *http.Transport {
 func NewDefaultPooledTransport() *http.Transport {
 	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
+		DialContext: (&net.Dialer{
 			Timeout:   30 * time.Second,
 			KeepAlive: 30 * time.Second,
-		}).Dial,
+		}).DialContext,
 		TLSHandshakeTimeout: 10 * time.Second,
 		DisableKeepAlives:   false,
 		MaxIdleConnsPerHost: 1,
+		// Negotiate HTTP/2 via ALPN with TLS servers
+		ForceAttemptHTTP2: true,
+	}
+}
+
+// NewH2CTransport returns a new HTTP/2 transport who talks to cleartext
+// servers using prior knowledge, without the HTTP/1.1 upgrade dance.
+// Requests to the same host are multiplexed over a single connection.
+func NewH2CTransport() *http2.Transport {
+	return &http2.Transport{
+		AllowHTTP:      true,
+		DialTLSContext: H2CDialer(30 * time.Second),
+	}
+}
+
+// H2CDialer returns a dial function for HTTP/2 transports
+// who establishes cleartext TCP connections with the given timeout.
+func H2CDialer(timeout time.Duration) func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+	return func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
 	}
 }
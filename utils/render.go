@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// XRequestID stores the request ID header key.
+const XRequestID = "X-Request-Id"
+
+// ProblemContentType stores the RFC 7807 problem details JSON content type.
+const ProblemContentType = "application/problem+json"
+
+// Error response formats negotiated via the Accept header.
+const (
+	FormatPlain = "plain"
+	FormatHTML  = "html"
+	FormatJSON  = "json"
+)
+
+// DefaultErrorTemplate stores the default HTML template used to render error pages.
+// The template is executed with an ErrorPage.
+var DefaultErrorTemplate = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>Request ID: <code>{{.RequestID}}</code></p>
+</body>
+</html>
+`))
+
+// DefaultErrorRenderer stores the error renderer used when no renderer
+// is defined in the request context.
+var DefaultErrorRenderer ErrorRenderer = &NegotiatedRenderer{Template: DefaultErrorTemplate}
+
+// ErrorRenderer represents the interface implemented by error responses renderers.
+// Renderers must not expose the error details to the client.
+type ErrorRenderer interface {
+	Render(w http.ResponseWriter, req *http.Request, status int, err error)
+}
+
+// ErrorRendererFunc represents the function interface for error renderers.
+type ErrorRendererFunc func(w http.ResponseWriter, req *http.Request, status int, err error)
+
+// Render calls f(w, req, status, err).
+func (f ErrorRendererFunc) Render(w http.ResponseWriter, req *http.Request, status int, err error) {
+	f(w, req, status, err)
+}
+
+// ErrorPage stores the data exposed to the client in error responses.
+type ErrorPage struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	RequestID string `json:"requestId"`
+}
+
+// NewErrorPage creates the error page data for the given request and status code.
+// A new request ID is generated if the request has none.
+func NewErrorPage(req *http.Request, status int) ErrorPage {
+	id := RequestID(req)
+	if id == "" {
+		id = NewID()
+	}
+	return ErrorPage{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		RequestID: id,
+	}
+}
+
+// NegotiatedRenderer renders error responses as HTML, problem details JSON
+// or plain text, based on the client Accept header.
+type NegotiatedRenderer struct {
+	// Template stores the HTML template executed with an ErrorPage.
+	Template *template.Template
+}
+
+// Render writes the error response in the format preferred by the client.
+func (r *NegotiatedRenderer) Render(w http.ResponseWriter, req *http.Request, status int, err error) {
+	page := NewErrorPage(req, status)
+	w.Header().Set(XRequestID, page.RequestID)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	format := NegotiateErrorFormat(req)
+	if format == FormatHTML && r.Template == nil {
+		format = FormatPlain
+	}
+
+	switch format {
+	case FormatJSON:
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(page)
+	case FormatHTML:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		r.Template.Execute(w, page)
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(status)
+		w.Write([]byte(page.Title + "\nRequest ID: " + page.RequestID + "\n"))
+	}
+}
+
+// errorRendererKey is the context key used to store the request error renderer.
+type errorRendererKey struct{}
+
+// WithErrorRenderer returns a shallow copy of the given request
+// who renders error responses using the given renderer.
+func WithErrorRenderer(req *http.Request, renderer ErrorRenderer) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), errorRendererKey{}, renderer))
+}
+
+// UseErrorRenderer returns a middleware who overrides the error renderer
+// used by the next handlers, such as the forwarder error handler.
+func UseErrorRenderer(renderer ErrorRenderer) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			h.ServeHTTP(w, WithErrorRenderer(req, renderer))
+		})
+	}
+}
+
+// RenderError writes the error response for the given status code using
+// the error renderer stored in the request context or the default one.
+func RenderError(w http.ResponseWriter, req *http.Request, status int, err error) {
+	renderer := DefaultErrorRenderer
+	if req != nil {
+		if r, ok := req.Context().Value(errorRendererKey{}).(ErrorRenderer); ok {
+			renderer = r
+		}
+	}
+	renderer.Render(w, req, status, err)
+}
+
+// RequestID returns the request ID defined in the request header, if any.
+// Use EnsureRequestID to assign a new one if not present.
+func RequestID(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	return req.Header.Get(XRequestID)
+}
+
+// EnsureRequestID returns the request ID defined in the request header,
+// assigning a new one to the request header if not present, so it is
+// sent to the upstream servers and can be correlated in the logs.
+func EnsureRequestID(req *http.Request) string {
+	id := req.Header.Get(XRequestID)
+	if id == "" {
+		id = NewID()
+		req.Header.Set(XRequestID, id)
+	}
+	return id
+}
+
+// NegotiateErrorFormat returns the error response format preferred
+// by the client based on the Accept header, using plain text by default.
+func NegotiateErrorFormat(req *http.Request) string {
+	if req == nil {
+		return FormatPlain
+	}
+
+	type mediaRange struct {
+		media string
+		q     float64
+	}
+	ranges := []mediaRange{}
+	for _, value := range strings.Split(strings.Join(req.Header.Values("Accept"), ","), ",") {
+		params := strings.Split(value, ";")
+		r := mediaRange{media: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+		for _, param := range params[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 && kv[0] == "q" {
+				r.q, _ = strconv.ParseFloat(kv[1], 64)
+			}
+		}
+		if r.media != "" && r.q > 0 {
+			ranges = append(ranges, r)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		switch {
+		case r.media == "application/json" || r.media == ProblemContentType:
+			return FormatJSON
+		case r.media == "text/html" || r.media == "application/xhtml+xml":
+			return FormatHTML
+		case r.media == "text/plain" || r.media == "text/*" || r.media == "*/*":
+			return FormatPlain
+		}
+	}
+	return FormatPlain
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nbio/st"
+)
+
+func TestNegotiateErrorFormat(t *testing.T) {
+	cases := []struct {
+		accept, format string
+	}{
+		{"", FormatPlain},
+		{"*/*", FormatPlain},
+		{"application/json", FormatJSON},
+		{"application/problem+json", FormatJSON},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", FormatHTML},
+		{"text/html;q=0.5, application/json", FormatJSON},
+		{"application/json;q=0, text/plain", FormatPlain},
+		{"image/png", FormatPlain},
+	}
+
+	for _, test := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", test.accept)
+		st.Expect(t, NegotiateErrorFormat(req), test.format)
+	}
+	st.Expect(t, NegotiateErrorFormat(nil), FormatPlain)
+}
+
+func TestRenderErrorJSON(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set(XRequestID, "abc")
+	w := httptest.NewRecorder()
+
+	RenderError(w, req, http.StatusBadGateway, errors.New("dial tcp 10.0.0.1:80: connection refused"))
+	st.Expect(t, w.Code, http.StatusBadGateway)
+	st.Expect(t, w.Header().Get("Content-Type"), ProblemContentType)
+	st.Expect(t, w.Header().Get(XRequestID), "abc")
+
+	page := ErrorPage{}
+	st.Expect(t, json.Unmarshal(w.Body.Bytes(), &page), nil)
+	st.Expect(t, page, ErrorPage{Type: "about:blank", Title: "Bad Gateway", Status: 502, RequestID: "abc"})
+}
+
+func TestRenderErrorHTML(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+
+	RenderError(w, req, http.StatusGatewayTimeout, nil)
+	st.Expect(t, w.Code, http.StatusGatewayTimeout)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+	st.Expect(t, strings.Contains(w.Body.String(), "<h1>504 Gateway Timeout</h1>"), true)
+	st.Expect(t, strings.Contains(w.Body.String(), w.Header().Get(XRequestID)), true)
+}
+
+func TestRenderErrorPlain(t *testing.T) {
+	w := httptest.NewRecorder()
+	RenderError(w, nil, http.StatusBadGateway, errors.New("internal details"))
+	st.Expect(t, w.Code, http.StatusBadGateway)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/plain; charset=utf-8")
+	st.Expect(t, w.Body.String(), "Bad Gateway\nRequest ID: "+w.Header().Get(XRequestID)+"\n")
+}
+
+func TestEnsureRequestID(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	st.Expect(t, RequestID(req), "")
+	st.Expect(t, RequestID(nil), "")
+
+	id := EnsureRequestID(req)
+	st.Reject(t, id, "")
+	st.Expect(t, req.Header.Get(XRequestID), id)
+	st.Expect(t, EnsureRequestID(req), id)
+	st.Expect(t, RequestID(req), id)
+}
+
+func TestUseErrorRenderer(t *testing.T) {
+	renderer := ErrorRendererFunc(func(w http.ResponseWriter, req *http.Request, status int, err error) {
+		w.WriteHeader(status)
+		w.Write([]byte("custom"))
+	})
+	handler := UseErrorRenderer(renderer)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		DefaultHandler.ServeHTTP(w, req, errors.New("foo"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, http.StatusInternalServerError)
+	st.Expect(t, w.Body.String(), "custom")
+}
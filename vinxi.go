@@ -5,7 +5,10 @@ import (
 	"os"
 	"runtime"
 
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/canary"
 	"gopkg.in/vinxi/vinxi.v0/context"
+	"gopkg.in/vinxi/vinxi.v0/discovery"
 	"gopkg.in/vinxi/vinxi.v0/forward"
 	"gopkg.in/vinxi/vinxi.v0/layer"
 	"gopkg.in/vinxi/vinxi.v0/mux"
@@ -122,14 +125,62 @@ func (v *Vinxi) All(path string) *router.Route {
 	return v.Route("*", path)
 }
 
+// GRPC will register a route for the given fully qualified gRPC service
+// name and method. An empty method matches any service method.
+func (v *Vinxi) GRPC(service, method string) *router.Route {
+	return v.Router.GRPC(service, method)
+}
+
 // Route will register a new route for the given pattern and HTTP method.
 func (v *Vinxi) Route(method, path string) *router.Route {
 	return v.Router.Route(method, path)
 }
 
 // Forward defines the default URL to forward incoming traffic.
-func (v *Vinxi) Forward(uri string) *Vinxi {
-	return v.UseFinalHandler(http.HandlerFunc(forward.To(uri)))
+func (v *Vinxi) Forward(uri string, opts ...forward.OptSetter) *Vinxi {
+	return v.UseFinalHandler(http.HandlerFunc(forward.To(uri, v.forwardOptions(opts)...)))
+}
+
+// Balance balances the incoming traffic across the given upstream servers.
+// The balancer is closed once the final handler is replaced.
+func (v *Vinxi) Balance(upstreams []balancer.Upstream, opts ...balancer.OptSetter) *Vinxi {
+	opts = append([]balancer.OptSetter{balancer.Forward(v.forwardOptions(nil)...)}, opts...)
+	v.Layer.UseOwnedFinalHandler(balancer.Must(balancer.New(upstreams, opts...)))
+	return v
+}
+
+// Discover balances the incoming traffic across the upstream servers of the given discovered service.
+func (v *Vinxi) Discover(d *discovery.Discovery, service string, opts ...balancer.OptSetter) *Vinxi {
+	opts = append([]balancer.OptSetter{balancer.Forward(v.forwardOptions(nil)...)}, opts...)
+	v.Layer.UseOwnedFinalHandler(balancer.Must(d.Balancer(service, opts...)))
+	return v
+}
+
+// Split splits the incoming traffic across the given variants based on their weights.
+// The splitter is closed once the final handler is replaced.
+func (v *Vinxi) Split(variants []canary.Variant, opts ...canary.OptSetter) *Vinxi {
+	opts = append([]canary.OptSetter{canary.Forward(v.forwardOptions(nil)...)}, opts...)
+	v.Layer.UseOwnedFinalHandler(canary.Must(canary.New(variants, opts...)))
+	return v
+}
+
+// ForwardProxy enables the forward proxy mode, forwarding the traffic to the
+// server defined in the absolute-form request URI and tunneling CONNECT requests.
+// Middleware and multiplexers can be used to allow or deny destinations.
+func (v *Vinxi) ForwardProxy(opts ...forward.OptSetter) *Vinxi {
+	return v.UseFinalHandler(http.HandlerFunc(forward.Proxy(v.forwardOptions(opts)...)))
+}
+
+// forwardOptions returns the instance specific forwarder options
+// followed by the given options.
+// The Via header identifies the instance by its metadata ID.
+func (v *Vinxi) forwardOptions(opts []forward.OptSetter) []forward.OptSetter {
+	return append([]forward.OptSetter{forward.ViaPseudonym(v.viaPseudonym())}, opts...)
+}
+
+// viaPseudonym returns the pseudonym identifying the instance in the Via header.
+func (v *Vinxi) viaPseudonym() string {
+	return "vinxi-" + v.Metadata.ID
 }
 
 // Use attaches a new middleware handler for incoming HTTP traffic.
@@ -181,6 +232,7 @@ func (v *Vinxi) NewServer(opts ServerOptions) *Server {
 	srv := NewServer(opts)
 	v.Metadata.ServerOptions = opts
 	v.BindServer(srv.Server)
+	bindProtocols(srv.Server, opts)
 	return srv
 }
 
@@ -198,8 +250,12 @@ func (v *Vinxi) BindServer(server *http.Server) {
 
 // ServeHTTP implements the required http.Handler interface to handle incoming traffic.
 func (v *Vinxi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Take the incoming request ID or assign a new one
+	utils.EnsureRequestID(r)
 	// Expose original incoming request host
 	context.Set(r, "vinxi.host", r.Host)
+	// Identify the instance in the Via header of every forwarder
+	r = forward.WithViaPseudonym(r, v.viaPseudonym())
 	// Define target URL
 	r.URL.Host = r.Host
 	// Run the incoming request middleware layer
@@ -4,8 +4,15 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/nbio/st"
+	"gopkg.in/vinxi/vinxi.v0/balancer"
+	"gopkg.in/vinxi/vinxi.v0/canary"
+	"gopkg.in/vinxi/vinxi.v0/discovery"
+	"gopkg.in/vinxi/vinxi.v0/mux"
+	forwardplugin "gopkg.in/vinxi/vinxi.v0/plugins/forward"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 )
 
@@ -23,3 +30,155 @@ func TestVinxi(t *testing.T) {
 	st.Expect(t, w.Code, 200)
 	st.Expect(t, w.Body.String(), "Hello world\n")
 }
+
+func TestVinxiForwardProxyDeny(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Hello world")
+	}))
+	defer ts.Close()
+
+	v := New()
+	v.ForwardProxy()
+	v.Mux(mux.MatchMethod("CONNECT"), mux.MatchHost("^127\\.0\\.0\\.1:")).Use(func(w http.ResponseWriter, r *http.Request, h http.Handler) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	proxy := httptest.NewServer(v)
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	transport := ts.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(proxyURL)
+	transport.TLSClientConfig.ServerName = "example.com"
+
+	_, err := (&http.Client{Transport: transport}).Get(ts.URL)
+	st.Reject(t, err, nil)
+	st.Expect(t, strings.Contains(err.Error(), "Forbidden"), true)
+
+	ts.URL = strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	res, err := (&http.Client{Transport: transport}).Get(ts.URL)
+	st.Expect(t, err, nil)
+	st.Expect(t, res.StatusCode, 200)
+}
+
+func TestVinxiForwardVia(t *testing.T) {
+	var via string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		via = r.Header.Get("Via")
+	}))
+	defer ts.Close()
+
+	v := New()
+	v.Forward(ts.URL)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	v.ServeHTTP(w, req)
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, via, "1.1 vinxi-"+v.Metadata.ID)
+	st.Expect(t, w.Header().Get("Via"), "1.1 vinxi-"+v.Metadata.ID)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Via", via)
+	v.ServeHTTP(w, req)
+	st.Expect(t, w.Code, http.StatusLoopDetected)
+}
+
+func TestVinxiBalance(t *testing.T) {
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name)
+		}))
+	}
+	a, b := newServer("a"), newServer("b")
+	defer a.Close()
+	defer b.Close()
+
+	v := New()
+	v.Get("/route").Balance([]balancer.Upstream{{URL: b.URL}})
+	v.Balance([]balancer.Upstream{{URL: a.URL}, {URL: b.URL}}, balancer.Algorithm(balancer.RoundRobin))
+
+	bodies := ""
+	for _, path := range []string{"/", "/", "/route"} {
+		w := httptest.NewRecorder()
+		v.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		st.Expect(t, w.Code, 200)
+		bodies += w.Body.String()
+	}
+	st.Expect(t, bodies, "abb")
+}
+
+func TestVinxiDiscover(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Via"))
+	}))
+	defer srv.Close()
+
+	d, err := discovery.New(discovery.ProviderFunc(func() (discovery.Services, error) {
+		return discovery.Services{"api": {{URL: srv.URL}}}, nil
+	}))
+	st.Expect(t, err, nil)
+	defer d.Close()
+
+	v := New()
+	v.Discover(d, "api")
+
+	w := httptest.NewRecorder()
+	v.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, strings.Contains(w.Body.String(), "vinxi-"+v.Metadata.ID), true)
+}
+
+func TestVinxiSplit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Via"))
+	}))
+	defer srv.Close()
+
+	variants := []canary.Variant{
+		{Name: "stable", URL: srv.URL, Weight: 100},
+		{Name: "canary", URL: "http://127.0.0.1:1", Weight: 0},
+	}
+	v := New()
+	v.Split(variants, canary.Name("vinxi"))
+	v.Get("/route").Split(variants, canary.Name("route"))
+	v.Mux(mux.MatchPath("/mux")).Split(variants, canary.Name("mux"))
+
+	for _, path := range []string{"/", "/route", "/mux"} {
+		w := httptest.NewRecorder()
+		v.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		st.Expect(t, w.Code, 200)
+		st.Expect(t, w.Body.String(), "1.1 vinxi-"+v.Metadata.ID)
+	}
+	for _, name := range []string{"vinxi", "route", "mux"} {
+		st.Expect(t, canary.Get(name).Variants()[0].Requests(), uint64(1))
+	}
+
+	// Replaced splitters are unregistered
+	st.Reject(t, canary.Get("vinxi"), (*canary.Splitter)(nil))
+	v.Forward(srv.URL)
+	st.Expect(t, canary.Get("vinxi"), (*canary.Splitter)(nil))
+}
+
+func TestVinxiRouteVia(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.Header.Get("Via"))
+	}))
+	defer ts.Close()
+
+	v := New()
+	v.Get("/forward").Forward(ts.URL)
+	v.Get("/balance").Balance([]balancer.Upstream{{URL: ts.URL}})
+	fwd, err := forwardplugin.New(ts.URL)
+	st.Expect(t, err, nil)
+	v.Get("/plugin").Use(fwd.HandleHTTP)
+
+	for _, path := range []string{"/forward", "/balance", "/plugin"} {
+		w := httptest.NewRecorder()
+		v.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		st.Expect(t, w.Code, 200)
+		st.Expect(t, w.Body.String(), "1.1 vinxi-"+v.Metadata.ID)
+		st.Expect(t, w.Header().Get("Via"), "1.1 vinxi-"+v.Metadata.ID)
+	}
+}
@@ -26,6 +26,8 @@ var (
 	aWriteTimeout = flag.Int("http-write-timeout", 60, "HTTP write timeout in seconds")
 	aMRelease     = flag.Int("mrelease", 30, "OS memory release inverval in seconds")
 	aCpus         = flag.Int("cpus", runtime.GOMAXPROCS(-1), "Number of cpu cores to use")
+	aH2C          = flag.Bool("h2c", false, "Enable HTTP/2 over cleartext connections")
+	aForwardProxy = flag.Bool("forward-proxy", false, "Enable forward proxy mode with CONNECT tunneling")
 )
 
 const usage = `vinxictl %s
@@ -41,6 +43,8 @@ Options:
   -v, -version              output version
   -c, -config               Config file path
   -f                        Target server URL to forward traffic by default
+  -h2c                      Enable HTTP/2 over cleartext connections, such as for gRPC
+  -forward-proxy            Enable forward proxy mode with CONNECT tunneling
   -mrelease <num>           OS memory release inverval in seconds [default: 30]
   -cpus <num>               Number of used cpu cores.
                             (default for current machine is %d cores)
@@ -67,6 +71,7 @@ func main() {
 	opts := vinxi.ServerOptions{
 		Port: port,
 		Addr: *aAddr,
+		H2C:  *aH2C,
 	}
 
 	// Create a memory release goroutine
@@ -77,7 +82,9 @@ func main() {
 	v := vinxi.New()
 
 	// Define target server to forward incoming traffic
-	if *aForward != "" {
+	if *aForwardProxy {
+		v.ForwardProxy()
+	} else if *aForward != "" {
 		v.Forward(*aForward)
 	}
 
@@ -117,6 +124,6 @@ func memoryRelease(interval int) {
 }
 
 func exitWithError(format string, args ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, args)
+	fmt.Fprintf(os.Stderr, format, args...)
 	os.Exit(1)
 }